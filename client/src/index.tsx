@@ -806,6 +806,7 @@ function App() {
           CBOR.encode({
             Op: MessageType.Connect,
             Target,
+            Password: password,
           })
         )
       },
@@ -912,7 +913,7 @@ function App() {
           const rows = builtins
             .map(
               (s: any) =>
-                `guibutton "${s.Alias} (^f2${s.NumClients} player${s.NumClients === 1 ? '' : 's'}^f7) - ${modeName(s.Mode)} ${s.Map}" "join ${s.Alias}"`
+                `guibutton "${s.Alias} (^f2${s.NumClients}${s.MaxClients > 0 ? `/${s.MaxClients}` : ''} player${s.NumClients === 1 ? '' : 's'}^f7) - ${modeName(s.Mode)} ${s.Map}" "join ${s.Alias}"`
             )
             .join("\n")
 
@@ -1014,6 +1015,17 @@ function App() {
         return
       }
 
+      if (serverMessage.Op === MessageType.Party) {
+        const { Leader, Members } = serverMessage
+        if (Members == null || Members.length === 0) {
+          log.info('you are not in a party')
+          return
+        }
+
+        log.info(`party (led by ${Leader}): ${Members.join(', ')}`)
+        return
+      }
+
       if (serverMessage.Op === MessageType.AuthFailed) {
         receiveAuthMessage(serverMessage)
         return
@@ -11,6 +11,7 @@ export enum MessageType {
   Command,
   DiscordCode,
   Packet,
+  Party,
 }
 
 export enum ENetEventType {
@@ -30,7 +31,7 @@ export type ServerInfo = {
 export type InfoMessage = {
   Op: MessageType.Info
   Master: ServerInfo[]
-  Cluster: { Alias: string; Map: string; Mode: number; NumClients: number; Description: string }[]
+  Cluster: { Alias: string; Map: string; Mode: number; NumClients: number; MaxClients: number; Description: string }[]
 }
 
 export type PacketMessage = {
@@ -58,9 +59,16 @@ export type ChatMessage = {
   Message: string
 }
 
+export type PartyMessage = {
+  Op: MessageType.Party
+  Leader: string
+  Members: string[] | null
+}
+
 export type ConnectMessage = {
   Op: MessageType.Connect
   Target: string
+  Password?: string
 }
 
 export type DisconnectMessage = {
@@ -116,6 +124,7 @@ export type ServerMessage =
   | AuthSucceededMessage
   | AuthFailedMessage
   | ChatMessage
+  | PartyMessage
 
 export type SocketMessage =
   | PacketMessage
@@ -11,7 +11,12 @@ import (
 
 	"github.com/cfoust/sour/pkg/assets"
 	"github.com/cfoust/sour/pkg/config"
+	"github.com/cfoust/sour/pkg/gameserver"
+	"github.com/cfoust/sour/pkg/server/accounts"
+	"github.com/cfoust/sour/pkg/server/bans"
 	"github.com/cfoust/sour/pkg/server/ingress"
+	"github.com/cfoust/sour/pkg/server/master"
+	"github.com/cfoust/sour/pkg/server/race"
 	"github.com/cfoust/sour/pkg/server/servers"
 	"github.com/cfoust/sour/pkg/server/service"
 	"github.com/cfoust/sour/pkg/server/static"
@@ -158,15 +163,39 @@ func serveCommand(configs []string) error {
 
 	go assetFetcher.PollDownloads(ctx)
 
+	auth, err := gameserver.NewAuthDomains(serverConfig.AuthDomains)
+	if err != nil {
+		return fmt.Errorf("failed to load auth domains: %w", err)
+	}
+
 	serverManager := servers.NewServerManager(
 		assetFetcher,
 		serverConfig.ServerDescription,
 		serverConfig.Presets,
+		auth,
 	)
+	banList, err := bans.New(serverConfig.BanPath)
+	if err != nil {
+		return fmt.Errorf("failed to load bans: %w", err)
+	}
+
+	raceRecords, err := race.NewRecords(serverConfig.RacePath)
+	if err != nil {
+		return fmt.Errorf("failed to load race records: %w", err)
+	}
+
+	db, err := accounts.Open(serverConfig.DBPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+
 	cluster := service.NewCluster(
 		ctx,
 		serverManager,
 		assetFetcher,
+		banList,
+		raceRecords,
+		db,
 		serverConfig,
 	)
 
@@ -175,8 +204,28 @@ func serveCommand(configs []string) error {
 		return err
 	}
 
+	if serverConfig.Master.Enabled {
+		masterServer := master.New(auth.Users(serverConfig.Master.AuthDomain))
+
+		address := fmt.Sprintf("0.0.0.0:%d", serverConfig.Master.Port)
+		err = masterServer.Listen(address)
+		if err != nil {
+			return fmt.Errorf("failed to start master server: %w", err)
+		}
+
+		go masterServer.Serve(ctx)
+
+		log.Info().
+			Str("type", "master").
+			Msgf("listening on tcp:%s", address)
+	}
+
 	newConnections := make(chan ingress.Connection)
-	wsIngress := ingress.NewWSIngress(newConnections, cluster)
+	wsIngress := ingress.NewWSIngress(
+		newConnections,
+		cluster,
+		serverConfig.Master.Address,
+	)
 	enet := make([]*ingress.ENetIngress, 0)
 	infoServices := make([]*servers.ServerInfoService, 0)
 	cluster.StartServers(ctx)
@@ -203,10 +252,15 @@ func serveCommand(configs []string) error {
 				serverInfo := servers.NewServerInfoService(server)
 
 				if enetConfig.ServerInfo.Server {
-					serverInfo = servers.NewServerInfoService(cluster)
+					serverInfo = servers.NewServerInfoService(cluster.InfoFor(server))
+				}
+
+				masterAddress := ""
+				if enetConfig.ServerInfo.Master {
+					masterAddress = serverConfig.Master.Address
 				}
 
-				err := serverInfo.Serve(ctx, enetConfig.Port+1, enetConfig.ServerInfo.Master)
+				err := serverInfo.Serve(ctx, enetConfig.Port+1, masterAddress)
 				if err != nil {
 					log.Fatal().Err(err).Msg("failed to start server info service")
 				}
@@ -219,6 +273,7 @@ func serveCommand(configs []string) error {
 	}
 	go cluster.PollUsers(ctx, newConnections)
 	go cluster.PollDuels(ctx)
+	go cluster.PollTeamMatches(ctx)
 
 	// Start periodic server list watcher/broadcasts for the web server browser
 	wsIngress.StartWatcher(ctx)
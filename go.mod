@@ -2,6 +2,11 @@ module github.com/cfoust/sour
 
 go 1.22.0
 
+require (
+	gorm.io/driver/sqlite v1.4.4
+	gorm.io/gorm v1.24.5
+)
+
 require (
 	cuelang.org/go v0.10.1 // indirect
 	github.com/alecthomas/kong v1.2.1 // indirect
@@ -34,7 +39,5 @@ require (
 	golang.org/x/text v0.19.0 // indirect
 	golang.org/x/time v0.0.0-20220224211638-0e9765cccd65 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	gorm.io/driver/sqlite v1.4.4 // indirect
-	gorm.io/gorm v1.24.5 // indirect
 	nhooyr.io/websocket v1.8.7 // indirect
 )
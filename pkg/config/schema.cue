@@ -20,17 +20,55 @@
 	exploreMode: bool | *false
 	// Skip maps in this root when in explore mode
 	exploreModeSkip: string | *""
-	config:          #SpaceConfig
+	// When every instance of the space has this many players, another one
+	// is started with the same preset and links. Zero uses the preset's
+	// maxClients.
+	capacity: uint | *0
+	// The most instances of the space that can run at once. Extra
+	// instances are shut down once they have been empty for a while.
+	instances: uint8 & >=1 | *1
+	config:    #SpaceConfig
 }
 
+#Weapon: "saw" | "shotgun" | "minigun" | "rocket" | "rifle" | "grenade" | "pistol"
+
 #GameServerConfig: {
 	maxClients: uint8 | *128
+	// Spectators do not take up player slots but have their own limit
+	maxSpectators: uint8 | *32
 	// Length of game in seconds
 	matchLength:      uint | *600
 	defaultGameSpeed: uint8 | *100
 	defaultMode:      "ffa" | "coop" | "insta" | "instateam" | "effic" | "efficteam" | "tac" | "tacteam" | "ctf" | "instactf" | "efficctf" | *"ffa"
 	defaultMap:       string | *"complex"
 	maps: [...string] | *[]
+	// Map variables (e.g. skybox, fog) that players cannot change in coop
+	// edit.
+	lockedVariables: [...string] | *[]
+	// Idle players are warned, then moved to spectators, and finally
+	// disconnected if the server is full. In seconds, zero disables a
+	// step.
+	idle: {
+		warnSeconds:     uint | *240
+		spectateSeconds: uint | *300
+		kickSeconds:     uint | *900
+	}
+	// Play instateam, efficteam, and tacteam in rounds. Players who die
+	// wait for the next round and the first team to win enough rounds
+	// wins the game.
+	clanArena: {
+		enabled: bool | *false
+		rounds:  uint | *5
+		// The longest a round can last
+		roundSeconds: uint | *120
+	}
+	// Play effic as gun game: each frag with the killer's current weapon
+	// moves them on to the next one in the ladder, which they get when they
+	// next spawn, and a frag with the last one wins.
+	gunGame: {
+		enabled: bool | *false
+		ladder: [...#Weapon] | *["rocket", "minigun", "shotgun", "rifle", "grenade", "pistol", "saw"]
+	}
 }
 
 #Preset: {
@@ -65,10 +103,69 @@
 	forceRespawn: "all" | "dead" | "none" | *"all"
 	pauseOnDeath: bool | *false
 	default:      bool | *false
+	// Players are matched with opponents whose rating is within
+	// searchWindow of theirs. Every searchGrowthSeconds they wait, the
+	// window grows by searchGrowth, up to maxSearchWindow (0 for no
+	// limit).
+	searchWindow:        uint | *100
+	searchGrowth:        uint | *50
+	searchGrowthSeconds: uint & >0 | *10
+	maxSearchWindow:     uint | *0
+	// Two players who just dueled are only matched again once both have
+	// waited this long
+	rematchSeconds: uint | *60
+	// How often queued players are told how the search is going
+	notifySeconds: uint & >0 | *30
+	// The map pool for a series. Before it starts, the players take turns
+	// vetoing and picking maps from it. If empty, every game is played on
+	// the preset's map.
+	maps: [...string] | *[]
+	// How many games a series lasts at most
+	bestOf: 1 | 3 | 5 | *1
+	// How long a player has to veto or pick a map before one is chosen
+	// for them at random
+	vetoSeconds: uint & >0 | *30
+}
+
+#TeamMatchType: {
+	name: string
+	// The preset has to start the server in a team mode (e.g. instateam
+	// or ctf)
+	preset: string
+	// How many players are on each of the two teams
+	teamSize:      uint & >=2 & <=4 | *2
+	warmupSeconds: uint | *60
+	gameSeconds:   uint | *600
+	default:       bool | *false
+}
+
+// Players who leave matchmade games before they end (or before they begin,
+// which is dodging them) cannot queue again for a while.
+#PenaltySettings: {
+	// How long an offence counts against a player
+	memoryHours: uint & >0 | *24
+	// How long a player cannot queue after each of their offences. The
+	// first offence gets the first cooldown and so on; any past the end
+	// get the last one.
+	cooldownSeconds: [...uint] | *[60, 300, 900, 3600]
+	// From this many offences on, leaving also costs a player this much
+	// rating on top of the loss
+	ratingPenaltyAfter: uint & >0 | *3
+	ratingPenalty:      uint | *25
 }
 
 #MatchmakingSettings: {
 	duel: [...#DuelType]
+	team: [...#TeamMatchType] | *[]
+	// How many duels of a type a player needs to play before they show up
+	// on its leaderboard (#top, #rank, and /api/leaderboard)
+	leaderboardMinGames: uint | *5
+	// How many of their challenges (#challenge and #rematch) two players
+	// can play for rating a day. Any more are unrated, so that friends
+	// cannot farm each other's rating. Challenges are never rated unless
+	// both players have authenticated.
+	ratedChallenges: uint | *2
+	penalties:       #PenaltySettings
 }
 
 #Port: uint16
@@ -120,11 +217,80 @@ assetStores: [...#AssetStore] | *[{
 	}
 }]
 
+#RateLimit: {
+	rate:  number
+	burst: uint
+}
+
+#AuthDomain: {
+	// The domain players use with /authkey, e.g. /authkey name key sour
+	name: string
+	users: [...{
+		name: string
+		// The public key printed by /genauthkey
+		publicKey: string
+		role:      "none" | "master" | "auth" | "admin" | *"auth"
+	}]
+}
+
 // Sour servers host game servers.
 #ServerSettings: {
 	// If set, used for caching assets.
 	cacheDirectory: string | *"/tmp/assets"
 
+	// Where bans and mutes are stored. If empty, they are only kept in
+	// memory and are lost when the server restarts.
+	banPath: string | *"bans.json"
+
+	// Where the best times on race maps are stored. If empty, they are
+	// only kept in memory.
+	racePath: string | *"races.json"
+
+	// The SQLite database that accounts and ratings are stored in. If
+	// empty, they are only kept in memory.
+	dbPath: string | *"sour.db"
+
+	// Players removed from a game for a harmless reason (e.g. a master
+	// kick or the game shutting down) are moved to this space instead of
+	// being disconnected. If empty, they are disconnected.
+	fallbackSpace: string | *"lobby"
+
+	// Local auth domains players can authenticate against with /sauth,
+	// /dauth, and auth-on-connect.
+	authDomains: [...#AuthDomain]
+
+	master: {
+		// The master server that game servers register with and that the
+		// server browser gets its list of servers from.
+		address: string | *"master.sauerbraten.org:28787"
+		// Whether to run a master server of our own.
+		enabled: bool | *false
+		// The TCP port our master server listens on.
+		port: #Port | *28787
+		// Users in this auth domain can authenticate through our master
+		// server on any game server that uses it, as with /auth.
+		authDomain: string | *""
+	}
+
+	// Limits on how quickly each client can send messages of each kind.
+	// Messages over the limit are dropped and the sender is warned.
+	flood: {
+		enabled: bool | *true
+		// rate is in messages per second, burst is how many can be
+		// sent at once. A rate of 0 disables the limit.
+		chat: #RateLimit & {rate: number | *1, burst: uint | *5}
+		sound: #RateLimit & {rate: number | *2, burst: uint | *10}
+		taunt: #RateLimit & {rate: number | *0.5, burst: uint | *3}
+		name: #RateLimit & {rate: number | *0.2, burst: uint | *3}
+		command: #RateLimit & {rate: number | *1, burst: uint | *5}
+		// Repeat offenders are muted, then kicked, after this many
+		// dropped messages within strikeWindow seconds. 0 disables it.
+		muteAfter:    uint | *10
+		kickAfter:    uint | *30
+		strikeWindow: uint | *60
+		muteSeconds:  uint | *300
+	}
+
 	// Information used to respond to server info requests
 	serverInfo: {
 		map:         string | *"Sourland"
@@ -2,6 +2,7 @@ package config
 
 import (
 	"github.com/cfoust/sour/pkg/gameserver"
+	"github.com/cfoust/sour/pkg/ratelimit"
 )
 
 type RespawnType string
@@ -22,6 +23,25 @@ type DuelType struct {
 	OvertimeSeconds uint
 	PauseOnDeath    bool
 	Default         bool
+	// Players are matched with opponents whose rating is within
+	// SearchWindow of theirs. Every SearchGrowthSeconds they wait, the
+	// window grows by SearchGrowth, up to MaxSearchWindow (if not zero).
+	SearchWindow        uint
+	SearchGrowth        uint
+	SearchGrowthSeconds uint
+	MaxSearchWindow     uint
+	// Two players who just dueled are only matched again once both have
+	// waited this long
+	RematchSeconds uint
+	// How often queued players are told how the search is going
+	NotifySeconds uint
+	// The map pool players veto and pick from before a series. If
+	// empty, every game is played on the preset's map.
+	Maps []string
+	// How many games a series lasts at most (1, 3 or 5)
+	BestOf uint
+	// How long a player has to veto or pick a map
+	VetoSeconds uint
 }
 
 type Preset struct {
@@ -48,7 +68,12 @@ type PresetSpace struct {
 	VotingCreates   bool
 	ExploreMode     bool
 	ExploreModeSkip string
-	Config          SpaceConfig
+	// How many players an instance holds before newcomers are sent to
+	// another one. Zero means the preset's MaxClients.
+	Capacity int
+	// The most instances of the space that can run at once
+	Instances int
+	Config    SpaceConfig
 }
 
 type ENetServerInfo struct {
@@ -78,13 +103,51 @@ type ServerServerInfo struct {
 	GameSpeed   int
 }
 
+// A TeamMatchType is a kind of matchmade team game, e.g. 2v2 instactf.
+type TeamMatchType struct {
+	Name string
+	// Must start the server in a team mode
+	Preset string
+	// How many players are on each of the two teams
+	TeamSize      uint
+	WarmupSeconds uint
+	GameSeconds   uint
+	Default       bool
+}
+
+type PenaltySettings struct {
+	MemoryHours        uint
+	CooldownSeconds    []uint
+	RatingPenaltyAfter uint
+	RatingPenalty      uint
+}
+
 type MatchmakingSettings struct {
 	Duel []DuelType
+	Team []TeamMatchType
+	// How many duels of a type a player needs to be on its leaderboard
+	LeaderboardMinGames uint
+	// How many rated duels two players can challenge each other to a day
+	RatedChallenges uint
+	Penalties       PenaltySettings
+}
+
+type MasterSettings struct {
+	Address    string
+	Enabled    bool
+	Port       int
+	AuthDomain string
 }
 
 type ServerSettings struct {
 	LogSessions       bool
 	DBPath            string
+	BanPath           string
+	RacePath          string
+	FallbackSpace     string
+	AuthDomains       []gameserver.AuthDomain
+	Master            MasterSettings
+	Flood             ratelimit.Config
 	LogDirectory      string
 	CacheDirectory    string
 	ServerInfo        ServerServerInfo
@@ -0,0 +1,241 @@
+package crypto
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Sauerbraten's auth keys are points on the NIST P-192 curve. Keys,
+// challenges, and answers are all exchanged as hex strings in the same
+// format the game uses (see shared/crypto.cpp).
+
+var (
+	curveP, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffffeffffffffffffffff", 16)
+	curveB, _ = new(big.Int).SetString("64210519e59c80e70fa7e9ab72243049feb8deecc146b9b1", 16)
+	baseX, _  = new(big.Int).SetString("188da80eb03090f67cbf20eb43a18800f4ff0afd82ff1012", 16)
+	baseY, _  = new(big.Int).SetString("07192b95ffc8da78631011ed6b24cdd573f977a11e794811", 16)
+
+	three = big.NewInt(3)
+)
+
+type point struct {
+	x, y *big.Int
+	// The point at infinity
+	infinity bool
+}
+
+func basePoint() point {
+	return point{x: new(big.Int).Set(baseX), y: new(big.Int).Set(baseY)}
+}
+
+func mod(value *big.Int) *big.Int {
+	return value.Mod(value, curveP)
+}
+
+func (p point) double() point {
+	if p.infinity || p.y.Sign() == 0 {
+		return point{infinity: true}
+	}
+
+	// lambda = (3x^2 - 3) / 2y
+	numerator := new(big.Int).Mul(p.x, p.x)
+	numerator.Mul(numerator, three)
+	numerator.Sub(numerator, three)
+	denominator := new(big.Int).Lsh(p.y, 1)
+	denominator.ModInverse(mod(denominator), curveP)
+	lambda := mod(numerator.Mul(numerator, denominator))
+
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, new(big.Int).Lsh(p.x, 1))
+	mod(x)
+
+	y := new(big.Int).Sub(p.x, x)
+	y.Mul(y, lambda)
+	y.Sub(y, p.y)
+	mod(y)
+
+	return point{x: x, y: y}
+}
+
+func (p point) add(q point) point {
+	if p.infinity {
+		return q
+	}
+	if q.infinity {
+		return p
+	}
+
+	if p.x.Cmp(q.x) == 0 {
+		if p.y.Cmp(q.y) == 0 {
+			return p.double()
+		}
+		return point{infinity: true}
+	}
+
+	// lambda = (y2 - y1) / (x2 - x1)
+	numerator := new(big.Int).Sub(q.y, p.y)
+	denominator := new(big.Int).Sub(q.x, p.x)
+	denominator.ModInverse(mod(denominator), curveP)
+	lambda := mod(numerator.Mul(numerator, denominator))
+
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, p.x)
+	x.Sub(x, q.x)
+	mod(x)
+
+	y := new(big.Int).Sub(p.x, x)
+	y.Mul(y, lambda)
+	y.Sub(y, p.y)
+	mod(y)
+
+	return point{x: x, y: y}
+}
+
+func (p point) mul(scalar *big.Int) point {
+	result := point{infinity: true}
+	for i := scalar.BitLen() - 1; i >= 0; i-- {
+		result = result.double()
+		if scalar.Bit(i) == 1 {
+			result = result.add(p)
+		}
+	}
+	return result
+}
+
+// Sauerbraten prints numbers as a series of 16-bit hex digits, so the
+// output is always a multiple of four characters long.
+func printDigits(value *big.Int) string {
+	if value == nil || value.Sign() == 0 {
+		return ""
+	}
+
+	digits := value.Text(16)
+	if remainder := len(digits) % 4; remainder != 0 {
+		digits = strings.Repeat("0", 4-remainder) + digits
+	}
+	return digits
+}
+
+// parseDigits reads hex digits until the first character that isn't one.
+func parseDigits(value string) *big.Int {
+	end := 0
+	for end < len(value) && strings.ContainsRune("0123456789abcdefABCDEF", rune(value[end])) {
+		end++
+	}
+
+	result := new(big.Int)
+	if end == 0 {
+		return result
+	}
+
+	result.SetString(value[:end], 16)
+	return result
+}
+
+// The first character of a point encodes the parity of y, the rest is x.
+func (p point) String() string {
+	sign := "+"
+	if !p.infinity && p.y.Bit(0) == 1 {
+		sign = "-"
+	}
+	return sign + printDigits(p.x)
+}
+
+func parsePoint(value string) (point, error) {
+	if len(value) == 0 {
+		return point{}, fmt.Errorf("empty point")
+	}
+
+	yBit := value[0] == '-'
+	x := parseDigits(value[1:])
+
+	// y^2 = x^3 - 3x + b
+	y2 := new(big.Int).Mul(x, x)
+	y2.Mul(y2, x)
+	y2.Sub(y2, new(big.Int).Mul(x, three))
+	y2.Add(y2, curveB)
+	mod(y2)
+
+	y := new(big.Int).ModSqrt(y2, curveP)
+	if y == nil {
+		return point{}, fmt.Errorf("'%s' is not on the curve", value)
+	}
+
+	if (y.Bit(0) == 1) != yBit {
+		y.Sub(curveP, y)
+		mod(y)
+	}
+
+	return point{x: x, y: y}, nil
+}
+
+// Interprets a hash as a little-endian number, like Sauerbraten does.
+func hashToScalar(data []byte) *big.Int {
+	hash := Tiger(data)
+	reversed := make([]byte, len(hash))
+	for i, b := range hash {
+		reversed[len(hash)-1-i] = b
+	}
+	return new(big.Int).SetBytes(reversed)
+}
+
+type PublicKey struct {
+	point point
+}
+
+func ParsePublicKey(value string) (*PublicKey, error) {
+	parsed, err := parsePoint(value)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKey{point: parsed}, nil
+}
+
+func (k *PublicKey) String() string {
+	return k.point.String()
+}
+
+// A challenge sent to a client along with the answer we expect.
+type Challenge struct {
+	Text   string
+	answer *big.Int
+}
+
+// GenerateChallenge creates a challenge only the owner of the private key
+// corresponding to key can answer.
+func GenerateChallenge(key *PublicKey, seed []byte) *Challenge {
+	scalar := hashToScalar(seed)
+
+	answer := key.point.mul(scalar)
+	secret := basePoint().mul(scalar)
+
+	return &Challenge{
+		Text:   secret.String(),
+		answer: answer.x,
+	}
+}
+
+func (c *Challenge) Check(answer string) bool {
+	if c.answer == nil {
+		return false
+	}
+	return parseDigits(answer).Cmp(c.answer) == 0
+}
+
+// AnswerChallenge does what the client does when it receives a challenge.
+func AnswerChallenge(privateKey string, challenge string) (string, error) {
+	parsed, err := parsePoint(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	answer := parsed.mul(parseDigits(privateKey))
+	return printDigits(answer.x), nil
+}
+
+// GenerateKeyPair derives a key pair from a seed, like /genauthkey.
+func GenerateKeyPair(seed string) (privateKey string, publicKey string) {
+	scalar := hashToScalar([]byte(seed))
+	return printDigits(scalar), basePoint().mul(scalar).String()
+}
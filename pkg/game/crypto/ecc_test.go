@@ -0,0 +1,31 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChallenge(t *testing.T) {
+	// The base point is on the curve
+	_, err := ParsePublicKey(basePoint().String())
+	require.NoError(t, err)
+
+	private, public := GenerateKeyPair("some seed")
+
+	key, err := ParsePublicKey(public)
+	require.NoError(t, err)
+	require.Equal(t, public, key.String())
+
+	challenge := GenerateChallenge(key, []byte("challenge seed"))
+
+	answer, err := AnswerChallenge(private, challenge.Text)
+	require.NoError(t, err)
+	require.True(t, challenge.Check(answer))
+
+	otherPrivate, _ := GenerateKeyPair("another seed")
+	wrong, err := AnswerChallenge(otherPrivate, challenge.Text)
+	require.NoError(t, err)
+	require.False(t, challenge.Check(wrong))
+	require.False(t, challenge.Check(""))
+}
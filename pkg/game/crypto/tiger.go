@@ -0,0 +1,197 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// A port of Sauerbraten's Tiger implementation (shared/crypto.cpp), which
+// the game uses to hash passwords and to seed auth challenges.
+
+const tigerPasses = 3
+
+var (
+	sboxes     [4 * 256]uint64
+	sboxesOnce sync.Once
+)
+
+func tigerRound(a, b, c *uint64, x uint64, mul uint64) {
+	*c ^= x
+	*a -= sboxes[(*c>>(0*8))&0xFF] ^
+		sboxes[256+(*c>>(2*8))&0xFF] ^
+		sboxes[256*2+(*c>>(4*8))&0xFF] ^
+		sboxes[256*3+(*c>>(6*8))&0xFF]
+	*b += sboxes[256*3+(*c>>(1*8))&0xFF] ^
+		sboxes[256*2+(*c>>(3*8))&0xFF] ^
+		sboxes[256+(*c>>(5*8))&0xFF] ^
+		sboxes[(*c>>(7*8))&0xFF]
+	*b *= mul
+}
+
+func compress(block []byte, state *[3]uint64) {
+	var x [8]uint64
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint64(block[i*8:])
+	}
+
+	a, b, c := state[0], state[1], state[2]
+	aa, bb, cc := a, b, c
+
+	for pass := 0; pass < tigerPasses; pass++ {
+		if pass != 0 {
+			x[0] -= x[7] ^ 0xA5A5A5A5A5A5A5A5
+			x[1] ^= x[0]
+			x[2] += x[1]
+			x[3] -= x[2] ^ ((^x[1]) << 19)
+			x[4] ^= x[3]
+			x[5] += x[4]
+			x[6] -= x[5] ^ ((^x[4]) >> 23)
+			x[7] ^= x[6]
+			x[0] += x[7]
+			x[1] -= x[0] ^ ((^x[7]) << 19)
+			x[2] ^= x[1]
+			x[3] += x[2]
+			x[4] -= x[3] ^ ((^x[2]) >> 23)
+			x[5] ^= x[4]
+			x[6] += x[5]
+			x[7] -= x[6] ^ 0x0123456789ABCDEF
+		}
+
+		var mul uint64 = 9
+		switch pass {
+		case 0:
+			mul = 5
+		case 1:
+			mul = 7
+		}
+
+		tigerRound(&a, &b, &c, x[0], mul)
+		tigerRound(&b, &c, &a, x[1], mul)
+		tigerRound(&c, &a, &b, x[2], mul)
+		tigerRound(&a, &b, &c, x[3], mul)
+		tigerRound(&b, &c, &a, x[4], mul)
+		tigerRound(&c, &a, &b, x[5], mul)
+		tigerRound(&a, &b, &c, x[6], mul)
+		tigerRound(&b, &c, &a, x[7], mul)
+
+		a, b, c = c, a, b
+	}
+
+	state[0] = a ^ aa
+	state[1] = b - bb
+	state[2] = c + cc
+}
+
+func getByte(value uint64, index int) byte {
+	return byte(value >> (8 * index))
+}
+
+func setByte(value *uint64, index int, b byte) {
+	shift := 8 * index
+	*value = (*value &^ (0xFF << shift)) | uint64(b)<<shift
+}
+
+func genSboxes() {
+	seed := []byte("Tiger - A Fast New Hash Function, by Ross Anderson and Eli Biham")
+	state := [3]uint64{
+		0x0123456789ABCDEF,
+		0xFEDCBA9876543210,
+		0xF096A5B4C3B2E187,
+	}
+
+	for i := range sboxes {
+		for col := 0; col < 8; col++ {
+			setByte(&sboxes[i], col, byte(i&0xFF))
+		}
+	}
+
+	abc := 2
+	for pass := 0; pass < 5; pass++ {
+		for i := 0; i < 256; i++ {
+			for sb := 0; sb < 1024; sb += 256 {
+				abc++
+				if abc >= 3 {
+					abc = 0
+					compress(seed, &state)
+				}
+
+				for col := 0; col < 8; col++ {
+					other := sb + int(getByte(state[abc], col))
+					value := getByte(sboxes[sb+i], col)
+					setByte(&sboxes[sb+i], col, getByte(sboxes[other], col))
+					setByte(&sboxes[other], col, value)
+				}
+			}
+		}
+	}
+}
+
+// Tiger computes the 192-bit Tiger hash of data.
+func Tiger(data []byte) [24]byte {
+	sboxesOnce.Do(genSboxes)
+
+	state := [3]uint64{
+		0x0123456789ABCDEF,
+		0xFEDCBA9876543210,
+		0xF096A5B4C3B2E187,
+	}
+
+	length := len(data)
+	for ; len(data) >= 64; data = data[64:] {
+		compress(data, &state)
+	}
+
+	var temp [64]byte
+	j := copy(temp[:], data)
+	temp[j] = 0x01
+	j++
+	for j&7 != 0 {
+		temp[j] = 0
+		j++
+	}
+
+	if j > 56 {
+		for j < 64 {
+			temp[j] = 0
+			j++
+		}
+		compress(temp[:], &state)
+		j = 0
+	}
+
+	for j < 56 {
+		temp[j] = 0
+		j++
+	}
+	binary.LittleEndian.PutUint64(temp[56:], uint64(length)<<3)
+	compress(temp[:], &state)
+
+	var result [24]byte
+	for i, chunk := range state {
+		binary.LittleEndian.PutUint64(result[i*8:], chunk)
+	}
+	return result
+}
+
+// HashString hashes a string the same way Sauerbraten's hashstring does,
+// including its unusual low-nibble-first hex encoding.
+func HashString(value string) string {
+	const digits = "0123456789abcdef"
+
+	hash := Tiger([]byte(value))
+
+	var result strings.Builder
+	for _, c := range hash {
+		result.WriteByte(digits[c&0xF])
+		result.WriteByte(digits[c>>4])
+	}
+	return result.String()
+}
+
+// HashPassword produces the password hash a client sends in N_CONNECT (and
+// N_SETMASTER) for the given client number and session.
+func HashPassword(cn int32, sessionID int32, password string) string {
+	return HashString(fmt.Sprintf("%d %d %s", cn, sessionID, password))
+}
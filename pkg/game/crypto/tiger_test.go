@@ -0,0 +1,20 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTiger(t *testing.T) {
+	for input, expected := range map[string]string{
+		"":    "3293AC630C13F0245F92BBB1766E16167A4E58492DDE73F3",
+		"abc": "2AAB1484E8C158F2BFB8C5FF41B57A525129131C957B5F93",
+		"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+-": "F71C8583902AFB879EDFE610F82C0D4786A3A534504486B5",
+	} {
+		hash := Tiger([]byte(input))
+		require.Equal(t, expected, strings.ToUpper(hex.EncodeToString(hash[:])), input)
+	}
+}
@@ -36,8 +36,9 @@ func (m AuthAns) Type() MessageCode { return N_AUTHANS }
 // N_AUTHKICK
 type AuthKick struct {
 	Description string
-	Answer      string
+	Name        string
 	Victim      int32
+	Reason      string
 }
 
 func (m AuthKick) Type() MessageCode { return N_AUTHKICK }
@@ -45,7 +46,7 @@ func (m AuthKick) Type() MessageCode { return N_AUTHKICK }
 // N_AUTHTRY
 type AuthTry struct {
 	Description string
-	Answer      string
+	Name        string
 }
 
 func (m AuthTry) Type() MessageCode { return N_AUTHTRY }
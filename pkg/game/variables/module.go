@@ -3,6 +3,7 @@ package variables
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 
 	"github.com/cfoust/sour/pkg/game/constants"
 	"github.com/cfoust/sour/pkg/utils"
@@ -153,7 +154,7 @@ var DEFAULT_VARIABLES = map[string]VariableConstraint{
 	"lightlod":          IntConstraint{0, 0, 10},
 	"lightprecision":    IntConstraint{1, 32, 1024},
 	"maptitle":          StringConstraint{"Untitled Map by Unknown"},
-	"mapversion":        IntConstraint{1, constants.MAP_VERSION, 0},
+	"mapversion":        IntConstraint{1, constants.MAP_VERSION, constants.MAP_VERSION},
 	"minimapclip":       IntConstraint{0, 0, 1},
 	"minimapcolour":     IntConstraint{0, 0, COLOR_MAX},
 	"minimapheight":     IntConstraint{0, 0, 2 << 16},
@@ -196,90 +197,86 @@ var DEFAULT_VARIABLES = map[string]VariableConstraint{
 
 type Variables map[string]Variable
 
-func (v Variables) SetInt(name string, value int32) error {
+// Constrain checks that name is a map variable of the same type as value
+// and clamps value to the variable's range.
+func Constrain(name string, value Variable) (Variable, error) {
 	constraint, ok := DEFAULT_VARIABLES[name]
 	if !ok {
-		return fmt.Errorf("variable '%s' is not a valid map variable", name)
+		return nil, fmt.Errorf("variable '%s' is not a valid map variable", name)
 	}
 
-	if constraint.Type() != VariableTypeInt {
-		return fmt.Errorf("variable '%s' is not an int", name)
-	}
+	switch constraint := constraint.(type) {
+	case IntConstraint:
+		intValue, ok := value.(IntVariable)
+		if !ok {
+			return nil, fmt.Errorf("variable '%s' is not an int", name)
+		}
+
+		clean := int32(intValue)
+		if clean < constraint.Min {
+			clean = constraint.Min
+		} else if clean > constraint.Max {
+			clean = constraint.Max
+		}
+		return IntVariable(clean), nil
+	case FloatConstraint:
+		floatValue, ok := value.(FloatVariable)
+		if !ok {
+			return nil, fmt.Errorf("variable '%s' is not a float", name)
+		}
 
-	intConstraint := constraint.(IntConstraint)
+		clean := float32(floatValue)
+		// NaN fails every comparison, so it would slip through below
+		if math.IsNaN(float64(clean)) {
+			clean = constraint.Default
+		} else if clean < constraint.Min {
+			clean = constraint.Min
+		} else if clean > constraint.Max {
+			clean = constraint.Max
+		}
+		return FloatVariable(clean), nil
+	case StringConstraint:
+		stringValue, ok := value.(StringVariable)
+		if !ok {
+			return nil, fmt.Errorf("variable '%s' is not a string", name)
+		}
 
-	clean := value
-	if value < intConstraint.Min {
-		clean = intConstraint.Min
-	} else if value > intConstraint.Max {
-		clean = intConstraint.Max
+		clean := string(stringValue)
+		if len(clean) > constants.MAXSTRLEN {
+			clean = clean[:constants.MAXSTRLEN]
+		}
+		return StringVariable(clean), nil
 	}
 
-	v[name] = IntVariable(clean)
+	return nil, fmt.Errorf("variable '%s' has an unknown type", name)
+}
 
-	return nil
+func (v Variables) SetInt(name string, value int32) error {
+	return v.Set(name, IntVariable(value))
 }
 
 func (v Variables) SetFloat(name string, value float32) error {
-	constraint, ok := DEFAULT_VARIABLES[name]
-	if !ok {
-		return fmt.Errorf("variable '%s' is not a valid map variable", name)
-	}
-
-	if constraint.Type() != VariableTypeFloat {
-		return fmt.Errorf("variable '%s' is not a float", name)
-	}
-
-	floatConstraint := constraint.(FloatConstraint)
-
-	clean := value
-	if value < floatConstraint.Min {
-		clean = floatConstraint.Min
-	} else if value > floatConstraint.Max {
-		clean = floatConstraint.Max
-	}
-
-	v[name] = FloatVariable(clean)
-
-	return nil
+	return v.Set(name, FloatVariable(value))
 }
 
 func (v Variables) SetString(name string, value string) error {
-	constraint, ok := DEFAULT_VARIABLES[name]
-	if !ok {
-		return fmt.Errorf("variable '%s' is not a valid map variable", name)
-	}
+	return v.Set(name, StringVariable(value))
+}
 
-	if constraint.Type() != VariableTypeString {
-		return fmt.Errorf("variable '%s' is not a string", name)
+func (v Variables) Set(name string, value Variable) error {
+	if value == nil {
+		return fmt.Errorf("attempt to set invalid variable")
 	}
 
-	clean := value
-	if len(value) > constants.MAXSTRLEN {
-		clean = value[:constants.MAXSTRLEN]
+	clean, err := Constrain(name, value)
+	if err != nil {
+		return err
 	}
 
-	v[name] = StringVariable(clean)
-
+	v[name] = clean
 	return nil
 }
 
-func (v Variables) Set(name string, value Variable) error {
-	switch value.Type() {
-	case VariableTypeInt:
-		var_ := value.(IntVariable)
-		return v.SetInt(name, int32(var_))
-	case VariableTypeFloat:
-		var_ := value.(FloatVariable)
-		return v.SetFloat(name, float32(var_))
-	case VariableTypeString:
-		var_ := value.(StringVariable)
-		return v.SetString(name, string(var_))
-	}
-
-	return fmt.Errorf("attempt to set invalid variable")
-}
-
 func (v Variables) MarshalJSON() ([]byte, error) {
 	variables := make(map[string]interface{})
 	for key, value := range v {
@@ -1,9 +1,12 @@
 package gameserver
 
 import (
+	"crypto/rand"
 	"fmt"
 	"log"
 
+	"github.com/cfoust/sour/pkg/game/crypto"
+	P "github.com/cfoust/sour/pkg/game/protocol"
 	"github.com/cfoust/sour/pkg/gameserver/protocol/cubecode"
 	"github.com/cfoust/sour/pkg/gameserver/protocol/role"
 )
@@ -61,3 +64,216 @@ func (s *Server) _setRole(client *Client, rol role.ID) {
 	message, _ := s.PrivilegedUsersPacket()
 	s.Clients.Broadcast(message)
 }
+
+type authKey struct {
+	name   string
+	domain string
+}
+
+type authUser struct {
+	publicKey *crypto.PublicKey
+	role      role.ID
+}
+
+// AuthDomains holds the users of all of the local auth domains.
+type AuthDomains struct {
+	users map[authKey]authUser
+}
+
+func NewAuthDomains(domains []AuthDomain) (*AuthDomains, error) {
+	auth := &AuthDomains{
+		users: make(map[authKey]authUser),
+	}
+
+	for _, domain := range domains {
+		if domain.Name == "" {
+			return nil, fmt.Errorf("auth domains must have a name")
+		}
+
+		for _, user := range domain.Users {
+			key, err := crypto.ParsePublicKey(user.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"invalid public key for %s@%s: %w",
+					user.Name,
+					domain.Name,
+					err,
+				)
+			}
+
+			rol := role.Auth
+			if user.Role != "" {
+				rol = role.Parse(user.Role)
+			}
+			if rol < role.None {
+				return nil, fmt.Errorf(
+					"invalid role '%s' for %s@%s",
+					user.Role,
+					user.Name,
+					domain.Name,
+				)
+			}
+
+			auth.users[authKey{name: user.Name, domain: domain.Name}] = authUser{
+				publicKey: key,
+				role:      rol,
+			}
+		}
+	}
+
+	return auth, nil
+}
+
+func (a *AuthDomains) find(name, domain string) (authUser, bool) {
+	if a == nil {
+		return authUser{}, false
+	}
+
+	user, ok := a.users[authKey{name: name, domain: domain}]
+	return user, ok
+}
+
+// Users returns the public keys of everyone in the given domain, by name.
+func (a *AuthDomains) Users(domain string) map[string]*crypto.PublicKey {
+	users := make(map[string]*crypto.PublicKey)
+	if a == nil {
+		return users
+	}
+
+	for key, user := range a.users {
+		if key.domain != domain {
+			continue
+		}
+		users[key.name] = user.publicKey
+	}
+	return users
+}
+
+// An auth request that is waiting for the client's answer.
+type pendingAuth struct {
+	reqID     uint32
+	name      string
+	domain    string
+	role      role.ID
+	challenge *crypto.Challenge
+
+	// Set when the client is authenticating in order to kick someone
+	kickVictim *Client
+	kickReason string
+}
+
+// tryAuth sends the client a challenge for the given user. Only local
+// domains are supported.
+func (s *Server) tryAuth(client *Client, name, domain string) bool {
+	client.pendingAuth = nil
+
+	if domain == "" {
+		client.Message(cubecode.Fail("not connected to authentication server"))
+		return false
+	}
+
+	user, ok := s.Auth.find(name, domain)
+	if !ok {
+		return false
+	}
+
+	seed := make([]byte, 24)
+	_, err := rand.Read(seed)
+	if err != nil {
+		log.Printf("failed to generate auth challenge: %v", err)
+		return false
+	}
+
+	s.nextAuthRequest++
+	if s.nextAuthRequest == 0 {
+		s.nextAuthRequest = 1
+	}
+
+	challenge := crypto.GenerateChallenge(user.publicKey, seed)
+	client.pendingAuth = &pendingAuth{
+		reqID:     s.nextAuthRequest,
+		name:      name,
+		domain:    domain,
+		role:      user.role,
+		challenge: challenge,
+	}
+
+	client.Send(P.AuthChallenge{
+		Desc:      domain,
+		Id:        int32(s.nextAuthRequest),
+		Challenge: challenge.Text,
+	})
+	return true
+}
+
+func (s *Server) answerChallenge(client *Client, reqID uint32, answer, domain string) {
+	pending := client.pendingAuth
+	client.pendingAuth = nil
+
+	if pending == nil || pending.reqID != reqID || pending.domain != domain {
+		return
+	}
+
+	if !pending.challenge.Check(answer) {
+		client.Message(cubecode.Fail("authentication failed"))
+		return
+	}
+
+	client.setAuthentication(domain, &Authentication{
+		reqID: reqID,
+		name:  pending.name,
+	})
+
+	// Let whoever owns the connection know who the client is now
+	select {
+	case s.auths <- ClientAuth{
+		Session:  client.SessionID,
+		Identity: fmt.Sprintf("%s@%s", pending.name, domain),
+	}:
+	default:
+	}
+
+	if pending.kickVictim != nil {
+		// The victim may have left while we were waiting
+		if s.Clients.GetClientByCN(pending.kickVictim.CN) != pending.kickVictim {
+			return
+		}
+
+		s.AuthKick(
+			client,
+			pending.role,
+			domain,
+			pending.name,
+			pending.kickVictim,
+			pending.kickReason,
+		)
+		return
+	}
+
+	s.setAuthRole(client, pending.role, domain, pending.name)
+}
+
+// authKick kicks the victim, first making the client authenticate if
+// their current role isn't enough.
+func (s *Server) authKick(client *Client, name, domain string, victim *Client, reason string) {
+	authRole := role.Auth
+	if domain != "" {
+		user, ok := s.Auth.find(name, domain)
+		if !ok {
+			return
+		}
+		authRole = user.role
+	}
+
+	if client.Role >= authRole {
+		s.Kick(client, victim, reason)
+		return
+	}
+
+	if !s.tryAuth(client, name, domain) {
+		return
+	}
+
+	client.pendingAuth.kickVictim = victim
+	client.pendingAuth.kickReason = reason
+}
@@ -3,6 +3,9 @@ package gameserver
 import (
 	"fmt"
 	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cfoust/sour/pkg/game/protocol"
@@ -19,6 +22,11 @@ type Authentication struct {
 	name  string
 }
 
+// The name the client authenticated with.
+func (a *Authentication) Name() string {
+	return a.name
+}
+
 // Describes a client.
 type Client struct {
 	game.Player
@@ -30,10 +38,20 @@ type Client struct {
 	Ping                int32
 	Positions           *relay.Publisher
 	Packets             *relay.Publisher
-	Authentications     map[string]*Authentication
+	// Guarded by authMutex, since the cluster reads it from other
+	// goroutines
+	Authentications map[string]*Authentication
+	authMutex       sync.Mutex
+	// The client can only watch, e.g. someone spectating a duel
+	ForcedSpectator bool
 
-	connected chan bool
-	outgoing  Outgoing
+	connected   chan bool
+	outgoing    Outgoing
+	pendingAuth *pendingAuth
+	// The last time the client moved, shot, or chatted in Unix nanoseconds
+	lastActive   atomic.Int64
+	lastMovement movement
+	idleWarned   atomic.Bool
 
 	server *Server
 }
@@ -47,6 +65,34 @@ func NewClient(cn uint32, sessionId uint32, outgoing Outgoing) *Client {
 	}
 }
 
+func (c *Client) setAuthentication(domain string, auth *Authentication) {
+	c.authMutex.Lock()
+	c.Authentications[domain] = auth
+	c.authMutex.Unlock()
+}
+
+func (c *Client) clearAuthentications() {
+	c.authMutex.Lock()
+	for domain := range c.Authentications {
+		delete(c.Authentications, domain)
+	}
+	c.authMutex.Unlock()
+}
+
+// Identities returns the identities the client has authenticated with,
+// each of the form name@domain, in a stable order.
+func (c *Client) Identities() []string {
+	c.authMutex.Lock()
+	identities := make([]string, 0, len(c.Authentications))
+	for domain, auth := range c.Authentications {
+		identities = append(identities, fmt.Sprintf("%s@%s", auth.name, domain))
+	}
+	c.authMutex.Unlock()
+
+	sort.Strings(identities)
+	return identities
+}
+
 func (c *Client) GrantMaster() {
 	c.server._setRole(c, role.Master)
 }
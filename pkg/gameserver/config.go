@@ -1,10 +1,36 @@
 package gameserver
 
+import (
+	"github.com/cfoust/sour/pkg/gameserver/game"
+)
+
 type Config struct {
 	MaxClients       int
+	MaxSpectators    int
 	MatchLength      int
 	DefaultGameSpeed int
 	DefaultMode      string
 	DefaultMap       string
 	Maps             []string
+	// Team modes without pickups are played in rounds
+	ClanArena game.ClanArenaConfig
+	// Efficiency is played as gun game
+	GunGame game.GunGameConfig
+	// Map variables clients cannot change in coop edit
+	LockedVariables []string
+	// When to move idle players to spectators and disconnect them
+	Idle IdleConfig
+}
+
+type AuthUser struct {
+	Name      string
+	PublicKey string
+	// One of "none", "master", "auth", or "admin"
+	Role string
+}
+
+// A local auth domain, used with /sauth and /dauth.
+type AuthDomain struct {
+	Name  string
+	Users []AuthUser
 }
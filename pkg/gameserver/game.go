@@ -8,6 +8,14 @@ import (
 )
 
 func (s *Server) StartMode(id gamemode.ID) game.Mode {
+	if s.ClanArena.Enabled && game.CanPlayClanArena(id) {
+		return game.NewClanArena(s, id, s.KeepTeams, s.ClanArena)
+	}
+
+	if s.GunGame.Enabled && id == gamemode.Effic {
+		return game.NewGunGame(s, s.GunGame)
+	}
+
 	switch id {
 	case gamemode.FFA:
 		return game.NewFFA(s)
@@ -0,0 +1,285 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cfoust/sour/pkg/gameserver/protocol/gamemode"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/playerstate"
+	"github.com/cfoust/sour/pkg/gameserver/timer"
+)
+
+type ClanArenaConfig struct {
+	Enabled bool
+	// How many rounds a team has to win to win the game
+	Rounds int
+	// How long a round lasts at most, in seconds
+	RoundSeconds int
+}
+
+// The time between the end of one round and the start of the next.
+const roundBreak = 5 * time.Second
+
+// ClanArena is played in rounds over a team mode without pickups. Everyone
+// spawns with a full loadout, players who die spectate until the next round,
+// and a round ends when only one team is left standing or the round timer
+// runs out. Rounds are only played while both teams have players.
+type ClanArena struct {
+	*teamMode
+	noMapInfo
+
+	s      Server
+	id     gamemode.ID
+	spawn  interface{ Spawn(*PlayerState) }
+	config ClanArenaConfig
+
+	round   int
+	playing bool
+	over    bool
+	// Set when a round could not start, until a player joins or switches
+	// teams
+	waiting bool
+	// The players spectating until the next round
+	eliminated map[*Player]bool
+	// Counts down the current round or the break before the next one
+	timer *timer.Timer
+}
+
+// assert interface implementations at compile time
+var (
+	_ Mode      = &ClanArena{}
+	_ TeamMode  = &ClanArena{}
+	_ HasTimers = &ClanArena{}
+)
+
+// CanPlayClanArena reports whether a mode can be played as clan arena.
+func CanPlayClanArena(id gamemode.ID) bool {
+	switch id {
+	case gamemode.EfficTeam, gamemode.InstaTeam, gamemode.TacticsTeam:
+		return true
+	}
+	return false
+}
+
+func NewClanArena(s Server, id gamemode.ID, keepTeams bool, config ClanArenaConfig) *ClanArena {
+	var spawn interface{ Spawn(*PlayerState) }
+	switch id {
+	case gamemode.InstaTeam:
+		spawn = &instaSpawnState{}
+	case gamemode.TacticsTeam:
+		spawn = &tacticsSpawnState{}
+	default:
+		id = gamemode.EfficTeam
+		spawn = &efficSpawnState{}
+	}
+
+	m := &ClanArena{
+		teamMode: withTeams(s, false, keepTeams, NewTeam("good"), NewTeam("evil")),
+		s:        s,
+		id:       id,
+		spawn:    spawn,
+		config:   config,
+
+		eliminated: map[*Player]bool{},
+	}
+	m.scheduleRound()
+	return m
+}
+
+func (m *ClanArena) ID() gamemode.ID { return m.id }
+
+func (m *ClanArena) Spawn(ps *PlayerState) {
+	m.spawn.Spawn(ps)
+}
+
+// Players who die have to wait until the next round.
+func (m *ClanArena) CanSpawn(*Player) bool {
+	return !m.playing
+}
+
+func (m *ClanArena) HandleFrag(fragger, victim *Player) {
+	m.teamMode.HandleFrag(fragger, victim)
+
+	if m.playing && victim.State == playerstate.Dead {
+		m.eliminated[victim] = true
+		m.s.SetEliminated(victim, true)
+		m.checkRound()
+	}
+}
+
+func (m *ClanArena) Join(p *Player) {
+	// Eliminated players who stop spectating are still on their team
+	if m.eliminated[p] {
+		delete(m.eliminated, p)
+		return
+	}
+
+	m.teamMode.Join(p)
+	m.wake()
+}
+
+func (m *ClanArena) ChangeTeam(p *Player, newTeamName string, forced bool) {
+	m.teamMode.ChangeTeam(p, newTeamName, forced)
+	m.wake()
+}
+
+func (m *ClanArena) Leave(p *Player) {
+	m.teamMode.Leave(p)
+	delete(m.eliminated, p)
+
+	if m.playing {
+		m.checkRound()
+	}
+}
+
+// wake schedules the next round if the game was waiting for players.
+func (m *ClanArena) wake() {
+	if !m.waiting || m.over {
+		return
+	}
+
+	m.waiting = false
+	m.scheduleRound()
+}
+
+func (m *ClanArena) scheduleRound() {
+	m.timer = timer.AfterFunc(roundBreak, m.startRound)
+	go m.timer.Start()
+}
+
+func (m *ClanArena) startRound() {
+	if m.over {
+		return
+	}
+
+	for p := range m.eliminated {
+		m.s.SetEliminated(p, false)
+	}
+	m.eliminated = map[*Player]bool{}
+
+	// A round needs players on both sides, otherwise we wait for someone
+	// to join rather than check again forever
+	teams := map[*Team]struct{}{}
+	m.s.ForEachPlayer(func(p *Player) {
+		if p.State != playerstate.Spectator && p.Team != NoTeam {
+			teams[p.Team] = struct{}{}
+		}
+	})
+	if len(teams) < 2 {
+		m.waiting = true
+		return
+	}
+
+	m.round++
+	m.playing = true
+
+	m.s.ForceRespawnAll()
+	m.s.Message(fmt.Sprintf("round %d: fight!", m.round))
+
+	m.timer = timer.AfterFunc(
+		time.Duration(m.config.RoundSeconds)*time.Second,
+		m.timeUp,
+	)
+	go m.timer.Start()
+}
+
+// alive counts the living players on each team.
+func (m *ClanArena) alive() map[*Team]int {
+	alive := map[*Team]int{}
+	m.s.ForEachPlayer(func(p *Player) {
+		// Players that are leaving have already been removed from their
+		// team
+		if p.State == playerstate.Alive && p.Team != NoTeam {
+			alive[p.Team]++
+		}
+	})
+	return alive
+}
+
+// checkRound ends the round once at most one team has players left.
+func (m *ClanArena) checkRound() {
+	alive := m.alive()
+
+	switch len(alive) {
+	case 0:
+		m.endRound(nil)
+	case 1:
+		for team := range alive {
+			m.endRound(team)
+		}
+	}
+}
+
+// When the round timer runs out, the team with more players left wins.
+func (m *ClanArena) timeUp() {
+	if !m.playing {
+		return
+	}
+
+	var winner *Team
+	most := 0
+	for team, count := range m.alive() {
+		if count > most {
+			winner, most = team, count
+		} else if count == most {
+			winner = nil
+		}
+	}
+
+	m.s.Message("time is up")
+	m.endRound(winner)
+}
+
+func (m *ClanArena) endRound(winner *Team) {
+	m.playing = false
+	m.timer.Stop()
+
+	if winner == nil {
+		m.s.Message(fmt.Sprintf("round %d is a draw (%s)", m.round, m.standings()))
+	} else {
+		winner.Score++
+		m.s.Message(fmt.Sprintf("%s wins round %d (%s)", winner.Name, m.round, m.standings()))
+	}
+
+	if winner != nil && int(winner.Score) >= m.config.Rounds {
+		m.over = true
+		m.s.Message(fmt.Sprintf("%s wins the game!", winner.Name))
+		m.s.Intermission()
+		return
+	}
+
+	m.scheduleRound()
+}
+
+// standings describes how many rounds each team has won, e.g. "good 2, evil 1".
+func (m *ClanArena) standings() string {
+	teams := []*Team{}
+	m.ForEachTeam(func(t *Team) {
+		teams = append(teams, t)
+	})
+	sort.Slice(teams, func(i, j int) bool {
+		return teams[i].Name < teams[j].Name
+	})
+
+	parts := []string{}
+	for _, team := range teams {
+		parts = append(parts, fmt.Sprintf("%s %d", team.Name, team.Score))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (m *ClanArena) Pause() {
+	m.timer.Pause()
+}
+
+func (m *ClanArena) Resume() {
+	go m.timer.Start()
+}
+
+func (m *ClanArena) CleanUp() {
+	m.over = true
+	m.playing = false
+	m.timer.Stop()
+}
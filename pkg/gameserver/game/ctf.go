@@ -14,6 +14,7 @@ type ctfMode = handlesFlags
 func newCTFMode(s Server, keepTeams bool) *ctfMode {
 	good, evil := NewTeam("good"), NewTeam("evil")
 	return handlingFlags(
+		s,
 		newCTF(
 			s,
 			withTeams(s, false, keepTeams, good, evil),
@@ -31,11 +32,12 @@ type CTF struct {
 
 // assert interface implementations at compile time
 var (
-	_ Mode       = &CTF{}
-	_ HasTimers  = &CTF{}
-	_ TeamMode   = &CTF{}
-	_ FlagMode   = &CTF{}
-	_ PickupMode = &CTF{}
+	_ Mode            = &CTF{}
+	_ HasTimers       = &CTF{}
+	_ TeamMode        = &CTF{}
+	_ FlagMode        = &CTF{}
+	_ PickupMode      = &CTF{}
+	_ UsesMapEntities = &CTF{}
 )
 
 func NewCTF(s Server, keepTeams bool) *CTF {
@@ -63,6 +65,11 @@ func (m *CTF) HandlePacket(p *Player, message P.Message) bool {
 	}
 }
 
+func (m *CTF) InitFromEntities(entities []MapEntity) {
+	m.ctfMode.InitFromEntities(entities)
+	m.handlesPickups.InitFromEntities(entities)
+}
+
 func (m *CTF) Pause() {
 	m.ctfMode.Pause()
 	m.handlesPickups.Pause()
@@ -0,0 +1,22 @@
+package game
+
+import (
+	"github.com/cfoust/sour/pkg/gameserver/geom"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/entity"
+)
+
+// MapEntity is an entity read from the map file by the server. Its index in
+// the map's list of entities is what clients use to refer to it.
+type MapEntity struct {
+	Type     entity.ID
+	Position *geom.Vector
+	Attr1    int32
+	Attr2    int32
+}
+
+// UsesMapEntities is implemented by modes that can set up their pickups or
+// flags from the map itself instead of trusting what the first client
+// reports.
+type UsesMapEntities interface {
+	InitFromEntities(entities []MapEntity)
+}
@@ -1,12 +1,14 @@
 package game
 
 import (
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/cfoust/sour/pkg/game/protocol"
 
 	"github.com/cfoust/sour/pkg/gameserver/geom"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/entity"
 	"github.com/cfoust/sour/pkg/gameserver/protocol/playerstate"
 	"github.com/cfoust/sour/pkg/gameserver/timer"
 )
@@ -41,6 +43,8 @@ type handlesFlags struct {
 	s Server
 	flagMode
 	flags []*flag
+	// Whether the flags came from the map rather than a client
+	fromMap bool
 }
 
 var (
@@ -48,15 +52,16 @@ var (
 	_ HasTimers = &handlesFlags{}
 )
 
-func handlingFlags(fm flagMode) *handlesFlags {
+func handlingFlags(s Server, fm flagMode) *handlesFlags {
 	return &handlesFlags{
+		s:        s,
 		flagMode: fm,
 	}
 }
 
 func (m *handlesFlags) NeedsMapInfo() bool {
 	log.Println("flag init asked:", len(m.flags))
-	return len(m.flags) == 0
+	return !m.fromMap && len(m.flags) == 0
 }
 
 func (m *handlesFlags) HandlePacket(p *Player, message protocol.Message) bool {
@@ -97,6 +102,13 @@ func (m *handlesFlags) initFlags(message protocol.ClientInitFlags) {
 		})
 	}
 
+	if m.fromMap {
+		if mismatch := compareFlags(m.flags, flags); mismatch != "" {
+			log.Printf("initflags packet does not match the map: %s", mismatch)
+		}
+		return
+	}
+
 	if len(m.flags) != 0 {
 		log.Println("got initflags packet, but flags are already initialized")
 		return
@@ -108,6 +120,77 @@ func (m *handlesFlags) initFlags(message protocol.ClientInitFlags) {
 	}
 }
 
+// compareFlags describes the first difference between two sets of flags,
+// or returns an empty string if they're the same.
+func compareFlags(expected, actual []*flag) string {
+	if len(expected) != len(actual) {
+		return fmt.Sprintf("expected %d flags, got %d", len(expected), len(actual))
+	}
+
+	for i, f := range expected {
+		other := actual[i]
+		if f.teamID != other.teamID {
+			return fmt.Sprintf("flag %d should belong to team %d, not %d", i, f.teamID, other.teamID)
+		}
+
+		if geom.Distance(f.spawnLocation, other.spawnLocation) > 1 {
+			return fmt.Sprintf("flag %d should be at %v, not %v", i, f.spawnLocation, other.spawnLocation)
+		}
+	}
+
+	return ""
+}
+
+// InitFromEntities sets up the flags from the map's entities. Flags a
+// client already reported are replaced if they don't match.
+func (m *handlesFlags) InitFromEntities(entities []MapEntity) {
+	flags := []*flag{}
+	for _, ent := range entities {
+		if ent.Type != entity.FLAG {
+			continue
+		}
+
+		team := m.TeamByFlagTeamID(ent.Attr2)
+		if team == nil {
+			continue
+		}
+
+		flags = append(flags, &flag{
+			index:         int32(len(flags)),
+			team:          team,
+			teamID:        ent.Attr2,
+			spawnLocation: ent.Position,
+		})
+	}
+
+	replaced := false
+	if len(m.flags) != 0 {
+		mismatch := compareFlags(m.flags, flags)
+		if mismatch == "" {
+			m.fromMap = true
+			return
+		}
+
+		log.Printf("flags from client did not match the map, replacing them: %s", mismatch)
+		m.CleanUp()
+		m.flags = nil
+		replaced = true
+	}
+
+	if !m.InitFlags(flags) {
+		// Let clients tell us instead
+		return
+	}
+
+	m.flags = flags
+	m.fromMap = true
+
+	// Clients that already joined were told about the old flags
+	if replaced {
+		m.s.Broadcast(m.FlagsInitPacket())
+	}
+}
+
 func (m *handlesFlags) touchFlag(p *Player, message protocol.ClientTakeFlag) {
 	if p.State != playerstate.Alive {
 		return
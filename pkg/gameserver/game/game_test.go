@@ -6,7 +6,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/cfoust/sour/pkg/gameserver/protocol/nmc"
+	"github.com/cfoust/sour/pkg/game/protocol"
 )
 
 var (
@@ -14,13 +14,21 @@ var (
 	//_ Player = &mockPlayer{}
 )
 
-type mockServer struct{}
+type mockServer struct {
+	intermissions int
+}
 
 func (s *mockServer) GameDuration() time.Duration { return 10 * time.Minute }
 
-func (s *mockServer) Broadcast(nmc.ID, ...interface{}) {}
+func (s *mockServer) Broadcast(...protocol.Message) {}
+
+func (s *mockServer) Message(string) {}
+
+func (s *mockServer) Intermission() { s.intermissions++ }
 
-func (s *mockServer) Intermission() {}
+func (s *mockServer) ForceRespawnAll() {}
+
+func (s *mockServer) SetEliminated(*Player, bool) {}
 
 func (s *mockServer) ForEachPlayer(func(*Player)) {}
 
@@ -31,9 +39,7 @@ func (s *mockServer) NumberOfPlayers() int { return 5 }
 func TestCompetitiveMode(t *testing.T) {
 	s := &mockServer{}
 
-	timing := NewCompetitiveClock(s)
-
-	var mode Mode = NewEfficCTF(s, true, timing)
+	var mode Mode = NewEfficCTF(s, true)
 
 	log.Printf("%T", mode)
 
@@ -43,12 +49,14 @@ func TestCompetitiveMode(t *testing.T) {
 		return
 	}
 
-	_, ok = mode.(Clock)
+	timed, ok := mode.(HasTimers)
 	if !ok {
 		t.Error("effic ctf is not a timed mode")
 		return
 	}
 
+	var _ Clock = NewCompetitiveClock(s, timed)
+
 	p1, p2 := NewPlayer(1), NewPlayer(2)
 
 	teamed.Join(&p1)
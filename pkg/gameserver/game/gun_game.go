@@ -0,0 +1,143 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/cfoust/sour/pkg/gameserver/protocol/armour"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/gamemode"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/weapon"
+)
+
+type GunGameConfig struct {
+	Enabled bool
+	// The weapons players go through, by name (e.g. "rocket", "rifle")
+	Ladder []string
+}
+
+var weaponsByName = map[string]weapon.ID{
+	"saw":     weapon.Saw,
+	"shotgun": weapon.Shotgun,
+	"minigun": weapon.Minigun,
+	"rocket":  weapon.RocketLauncher,
+	"rifle":   weapon.Rifle,
+	"grenade": weapon.GrenadeLauncher,
+	"pistol":  weapon.Pistol,
+}
+
+var defaultLadder = []weapon.ID{
+	weapon.RocketLauncher,
+	weapon.Minigun,
+	weapon.Shotgun,
+	weapon.Rifle,
+	weapon.GrenadeLauncher,
+	weapon.Pistol,
+	weapon.Saw,
+}
+
+// GunGame is played over efficiency, so there are no pickups. Every frag
+// with the weapon of the killer's tier moves them up a ladder of weapons and
+// a suicide moves them down again; players get the weapon of their tier
+// whenever they spawn. The first player to get a frag with the last weapon
+// wins.
+type GunGame struct {
+	*deathmatch
+
+	s      Server
+	ladder []weapon.ID
+	tiers  map[*PlayerState]int
+	over   bool
+
+	noMapInfo
+	noTimers
+}
+
+// assert interface implementations at compile time
+var _ Mode = &GunGame{}
+
+func NewGunGame(s Server, config GunGameConfig) *GunGame {
+	ladder := make([]weapon.ID, 0, len(config.Ladder))
+	for _, name := range config.Ladder {
+		id, ok := weaponsByName[strings.ToLower(name)]
+		if !ok {
+			log.Printf("unknown gun game weapon '%s'", name)
+			continue
+		}
+		ladder = append(ladder, id)
+	}
+
+	if len(ladder) == 0 {
+		ladder = defaultLadder
+	}
+
+	return &GunGame{
+		deathmatch: newDeathmatch(withoutTeams(s)),
+		s:          s,
+		ladder:     ladder,
+		tiers:      map[*PlayerState]int{},
+	}
+}
+
+func (*GunGame) ID() gamemode.ID { return gamemode.Effic }
+
+// Spawn gives players only the weapon of their current tier.
+func (m *GunGame) Spawn(ps *PlayerState) {
+	current := weapon.ByID(m.ladder[m.tiers[ps]])
+
+	ammo := map[weapon.ID]int32{}
+	for _, id := range weapon.WeaponsWithAmmo {
+		ammo[id] = 0
+	}
+	ammo[weapon.Saw] = 0
+
+	if current.ID == weapon.Saw {
+		ammo[weapon.Saw] = 1
+	} else {
+		ammo[current.ID] = current.AmmoPickUpSize * 10
+	}
+
+	ps.ArmourType = armour.Green
+	ps.Armour = 100
+	ps.Ammo, ps.SelectedWeapon = ammo, current
+	ps.Health = ps.MaxHealth
+}
+
+func (m *GunGame) HandleFrag(fragger, victim *Player) {
+	m.deathmatch.HandleFrag(fragger, victim)
+
+	if m.over {
+		return
+	}
+
+	if fragger == victim {
+		if m.tiers[&fragger.PlayerState] > 0 {
+			m.tiers[&fragger.PlayerState]--
+		}
+		return
+	}
+
+	// Killers keep the weapon they had until they respawn, so only frags
+	// with the weapon of their tier count
+	tier := m.tiers[&fragger.PlayerState]
+	if fragger.SelectedWeapon.ID != m.ladder[tier] {
+		return
+	}
+
+	if tier == len(m.ladder)-1 {
+		m.over = true
+		m.s.Message(fmt.Sprintf("%s wins the gun game!", m.s.UniqueName(fragger)))
+		m.s.Intermission()
+		return
+	}
+
+	tier++
+	m.tiers[&fragger.PlayerState] = tier
+	if tier == len(m.ladder)-1 {
+		m.s.Message(fmt.Sprintf("%s is on the last weapon", m.s.UniqueName(fragger)))
+	}
+}
+
+func (m *GunGame) Leave(p *Player) {
+	delete(m.tiers, &p.PlayerState)
+}
@@ -0,0 +1,39 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/cfoust/sour/pkg/gameserver/protocol/weapon"
+)
+
+func TestGunGameNeedsTierWeapon(t *testing.T) {
+	s := &mockServer{}
+	mode := NewGunGame(s, GunGameConfig{Ladder: []string{"rocket", "rifle"}})
+
+	killer, first, second := NewPlayer(1), NewPlayer(2), NewPlayer(3)
+	mode.Spawn(&killer.PlayerState)
+
+	mode.HandleFrag(&killer, &first)
+	if mode.tiers[&killer.PlayerState] != 1 {
+		t.Fatal("a frag with the tier's weapon did not move the killer up")
+	}
+
+	// Without dying, the killer still has the rocket launcher
+	mode.HandleFrag(&killer, &second)
+	if s.intermissions != 0 {
+		t.Fatal("a frag with an earlier weapon won the game")
+	}
+	if mode.tiers[&killer.PlayerState] != 1 {
+		t.Fatal("a frag with an earlier weapon moved the killer up")
+	}
+
+	mode.Spawn(&killer.PlayerState)
+	if killer.SelectedWeapon.ID != weapon.Rifle {
+		t.Fatalf("spawned with %v instead of the rifle", killer.SelectedWeapon.ID)
+	}
+
+	mode.HandleFrag(&killer, &first)
+	if s.intermissions != 1 {
+		t.Fatal("a frag with the last weapon did not win the game")
+	}
+}
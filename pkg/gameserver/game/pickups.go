@@ -30,6 +30,8 @@ type timedPickup struct {
 type handlesPickups struct {
 	s       Server
 	pickups map[int32]*timedPickup
+	// Whether the pickups came from the map rather than a client
+	fromMap bool
 }
 
 var _ PickupMode = &handlesPickups{}
@@ -84,7 +86,7 @@ func (m *handlesPickups) spawnDelayed(p *timedPickup) {
 }
 
 func (m *handlesPickups) NeedsMapInfo() bool {
-	return len(m.pickups) == 0
+	return !m.fromMap && len(m.pickups) == 0
 }
 
 func (m *handlesPickups) HandlePacket(p *Player, message P.Message) bool {
@@ -92,6 +94,14 @@ func (m *handlesPickups) HandlePacket(p *Player, message P.Message) bool {
 	case P.N_ITEMLIST:
 		itemList := message.(P.ItemList)
 
+		if m.fromMap {
+			// We already know what's on the map
+			if mismatch := m.compareItems(itemList.Items); mismatch != "" {
+				log.Printf("item list from %s does not match the map: %s", m.s.UniqueName(p), mismatch)
+			}
+			break
+		}
+
 		if len(m.pickups) > 0 || p.State == playerstate.Spectator {
 			break
 		}
@@ -161,6 +171,62 @@ func (m *handlesPickups) initPickups(pkt P.ItemList) {
 	}
 }
 
+// compareItems describes the first difference between an item list and
+// our pickups, or returns an empty string if they're the same.
+func (m *handlesPickups) compareItems(items []P.Item) string {
+	if len(items) != len(m.pickups) {
+		return fmt.Sprintf("expected %d items, got %d", len(m.pickups), len(items))
+	}
+
+	for _, item := range items {
+		pickup, ok := m.pickups[item.Index]
+		if !ok {
+			return fmt.Sprintf("unknown item %d", item.Index)
+		}
+
+		if int32(pickup.Typ) != item.Type {
+			return fmt.Sprintf(
+				"item %d should have type %d, not %d",
+				item.Index,
+				pickup.Typ,
+				item.Type,
+			)
+		}
+	}
+
+	return ""
+}
+
+// InitFromEntities sets up the pickups from the map's entities. Any
+// pickups a client already reported are replaced if they don't match.
+func (m *handlesPickups) InitFromEntities(entities []MapEntity) {
+	items := make([]P.Item, 0)
+	for i, ent := range entities {
+		if ent.Type < entity.PickupShotgun || ent.Type > entity.PickupQuadDamage {
+			continue
+		}
+
+		items = append(items, P.Item{
+			Index: int32(i),
+			Type:  int32(ent.Type),
+		})
+	}
+
+	m.fromMap = true
+
+	if len(m.pickups) > 0 {
+		mismatch := m.compareItems(items)
+		if mismatch == "" {
+			return
+		}
+
+		log.Printf("item list from client did not match the map, replacing it: %s", mismatch)
+		m.CleanUp()
+	}
+
+	m.initPickups(P.ItemList{Items: items})
+}
+
 func (m *handlesPickups) PickupsInitPacket() P.Message {
 	message := P.ItemList{}
 	for id, p := range m.pickups {
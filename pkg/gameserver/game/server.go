@@ -11,6 +11,11 @@ type Server interface {
 	Broadcast(messages ...protocol.Message)
 	Message(message string)
 	Intermission()
+	// Respawns every player that is not spectating
+	ForceRespawnAll()
+	// Moves a player to or from the spectators without taking them off
+	// their team
+	SetEliminated(p *Player, eliminated bool)
 	ForEachPlayer(func(*Player))
 	UniqueName(*Player) string
 	NumberOfPlayers() int
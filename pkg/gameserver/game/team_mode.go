@@ -2,6 +2,7 @@ package game
 
 import (
 	"sort"
+	"sync"
 
 	P "github.com/cfoust/sour/pkg/game/protocol"
 	"github.com/cfoust/sour/pkg/gameserver/protocol/playerstate"
@@ -17,7 +18,10 @@ type TeamMode interface {
 }
 
 type teamMode struct {
-	s                 Server
+	s Server
+	// Guards teamsByName and the players on each team, which server info
+	// requests read from other goroutines
+	mutex             sync.RWMutex
 	teamsByName       map[string]*Team
 	otherTeamsAllowed bool
 	keepTeams         bool
@@ -60,33 +64,47 @@ func (m *teamMode) selectWeakestTeam() *Team {
 }
 
 func (m *teamMode) Join(p *Player) {
+	m.mutex.Lock()
 	team := m.selectTeam(p)
 	team.Add(p)
+	m.mutex.Unlock()
 	m.s.Broadcast(P.SetTeam{int32(p.CN), p.Team.Name, -1})
 }
 
-func (*teamMode) Leave(p *Player) {
+func (m *teamMode) Leave(p *Player) {
+	m.mutex.Lock()
 	p.Team.Remove(p)
+	m.mutex.Unlock()
 }
 
 func (m *teamMode) HandleFrag(fragger, victim *Player) {
 	victim.Die()
 	if fragger.Team == victim.Team {
 		fragger.Frags--
+		fragger.Team.Frags--
 	} else {
 		fragger.Frags++
+		fragger.Team.Frags++
 	}
 	m.s.Broadcast(P.Died{int32(victim.CN), int32(fragger.CN), fragger.Frags, fragger.Team.Frags})
 }
 
 func (m *teamMode) ForEachTeam(do func(t *Team)) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 	for _, team := range m.teamsByName {
 		do(team)
 	}
 }
 
 func (m *teamMode) Teams() map[string]*Team {
-	return m.teamsByName
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	teams := make(map[string]*Team, len(m.teamsByName))
+	for name, team := range m.teamsByName {
+		teams[name] = team
+	}
+	return teams
 }
 
 func (m *teamMode) ChangeTeam(p *Player, newTeamName string, forced bool) {
@@ -103,23 +121,24 @@ func (m *teamMode) ChangeTeam(p *Player, newTeamName string, forced bool) {
 		if p.State == playerstate.Alive {
 			m.HandleFrag(p, p)
 		}
+		m.mutex.Lock()
 		old.Remove(p)
 		new.Add(p)
+		m.mutex.Unlock()
 		m.s.Broadcast(P.SetTeam{int32(p.CN), p.Team.Name, reason})
 	}
 
 	// try existing teams first
-	for name, team := range m.teamsByName {
-		if name == newTeamName {
-			// todo: check privileges and team balance
-			setTeam(p.Team, team)
-			return
-		}
+	// todo: check privileges and team balance
+	m.mutex.Lock()
+	team, ok := m.teamsByName[newTeamName]
+	if !ok && m.otherTeamsAllowed {
+		team, ok = NewTeam(newTeamName), true
+		m.teamsByName[newTeamName] = team
 	}
+	m.mutex.Unlock()
 
-	if m.otherTeamsAllowed {
-		newTeam := NewTeam(newTeamName)
-		m.teamsByName[newTeamName] = newTeam
-		setTeam(p.Team, newTeam)
+	if ok {
+		setTeam(p.Team, team)
 	}
 }
@@ -0,0 +1,127 @@
+package gameserver
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	P "github.com/cfoust/sour/pkg/game/protocol"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/cubecode"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/disconnectreason"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/playerstate"
+)
+
+// How often the server looks for idle clients
+const idleCheckInterval = 5 * time.Second
+
+// All in seconds, zero disables the step.
+type IdleConfig struct {
+	// When to warn players that they are about to be moved to spectators
+	WarnSeconds int
+	// When to move players to spectators
+	SpectateSeconds int
+	// When to disconnect clients, but only if the server is full
+	KickSeconds int
+}
+
+// The parts of a position update that only change when the player is at the
+// controls.
+type movement struct {
+	Move   int8
+	Strafe int8
+	Yaw    float64
+	Pitch  float64
+}
+
+// MarkActive records that the client did something, like chatting. It is
+// safe to call from any goroutine.
+func (c *Client) MarkActive() {
+	c.lastActive.Store(time.Now().UnixNano())
+	c.idleWarned.Store(false)
+}
+
+func (c *Client) idleTime() time.Duration {
+	lastActive := c.lastActive.Load()
+	if lastActive == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, lastActive))
+}
+
+// trackMovement marks the client as active if their input changed since
+// their last position update.
+func (c *Client) trackMovement(state P.PhysicsState) {
+	current := movement{
+		Move:   state.Move,
+		Strafe: state.Strafe,
+		Yaw:    state.Yaw,
+		Pitch:  state.Pitch,
+	}
+
+	if current != c.lastMovement {
+		c.lastMovement = current
+		c.MarkActive()
+	}
+}
+
+func (s *Server) isIdleExempt() bool {
+	return s.IdleExempt || s.CompetitiveMode
+}
+
+// checkIdle warns idle players, moves them to spectators, and disconnects
+// them if they are taking up a slot on a full server.
+func (s *Server) checkIdle() {
+	config := s.Idle
+	if s.isIdleExempt() {
+		return
+	}
+
+	full := !s.HasFreeSlot()
+
+	toWarn := make([]*Client, 0)
+	toSpectate := make([]*Client, 0)
+	toKick := make([]*Client, 0)
+
+	s.Clients.ForEach(func(c *Client) {
+		if !c.Joined {
+			return
+		}
+
+		idle := c.idleTime()
+
+		switch {
+		case full && config.KickSeconds > 0 && idle >= time.Duration(config.KickSeconds)*time.Second:
+			toKick = append(toKick, c)
+		case c.State == playerstate.Spectator:
+		case config.SpectateSeconds > 0 && idle >= time.Duration(config.SpectateSeconds)*time.Second:
+			toSpectate = append(toSpectate, c)
+		case config.WarnSeconds > 0 && idle >= time.Duration(config.WarnSeconds)*time.Second && !c.idleWarned.Load():
+			toWarn = append(toWarn, c)
+		}
+	})
+
+	for _, c := range toWarn {
+		c.idleWarned.Store(true)
+		if config.SpectateSeconds > 0 {
+			c.Message(cubecode.Fail(fmt.Sprintf(
+				"you will be moved to spectators in %d seconds if you stay idle",
+				config.SpectateSeconds-config.WarnSeconds,
+			)))
+		}
+	}
+
+	for _, c := range toSpectate {
+		msg := fmt.Sprintf("%s was moved to spectators for being idle", s.Clients.UniqueName(c))
+		s.SetSpectator(c, true)
+		s.Message(msg)
+		log.Println(cubecode.SanitizeString(msg))
+	}
+
+	for _, c := range toKick {
+		msg := fmt.Sprintf("%s was disconnected for being idle", s.Clients.UniqueName(c))
+		c.Message(cubecode.Fail("you were disconnected for being idle while the server is full"))
+		s.Disconnect(c, disconnectreason.Full)
+		s.Message(msg)
+		log.Println(cubecode.SanitizeString(msg))
+	}
+}
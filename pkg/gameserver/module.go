@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/cfoust/sour/pkg/chanlock"
@@ -37,6 +39,29 @@ type MapEdit struct {
 	Message P.Message
 }
 
+// Sent when the server forcibly removes a client, e.g. because they were
+// kicked.
+type ClientDisconnect struct {
+	Session uint32
+	Reason  disconnectreason.ID
+	// Whether the client was removed for misbehaving (e.g. flooding)
+	// rather than for a harmless reason like a master kick
+	Violent bool
+}
+
+// A ClientAuth is sent when a client authenticates with a domain.
+type ClientAuth struct {
+	Session uint32
+	// Of the form name@domain
+	Identity string
+}
+
+// The entities of a map, sent once the server has loaded it.
+type mapEntities struct {
+	Map      string
+	Entities []game.MapEntity
+}
+
 type Incoming <-chan ServerPacket
 type Outgoing chan<- ServerPacket
 
@@ -56,9 +81,20 @@ type Server struct {
 	pendingMapChange *time.Timer
 	rng              *rand.Rand
 
-	incoming chan ServerPacket
-	outgoing chan ServerPacket
-	maps     chan string
+	password      string
+	allowed       map[uint32]struct{}
+	passwordMutex sync.Mutex
+
+	// Users of local auth domains, may be nil
+	Auth            *AuthDomains
+	nextAuthRequest uint32
+
+	incoming    chan ServerPacket
+	outgoing    chan ServerPacket
+	maps        chan string
+	entities    chan mapEntities
+	disconnects chan ClientDisconnect
+	auths       chan ClientAuth
 
 	Broadcasts *utils.Topic[[]P.Message]
 	Edits      *utils.Topic[MapEdit]
@@ -67,6 +103,10 @@ type Server struct {
 	KeepTeams       bool
 	CompetitiveMode bool
 	ReportStats     bool
+	// Idle players are left alone, e.g. in duels
+	IdleExempt bool
+	// Players cannot change teams, e.g. in matchmade games
+	LockTeams bool
 }
 
 func New(ctx context.Context, conf *Config) *Server {
@@ -90,12 +130,16 @@ func New(ctx context.Context, conf *Config) *Server {
 			UpSince:    time.Now(),
 			NumClients: clients.GetNumClients,
 		},
-		relay:    relay.New(),
-		Clients:  clients,
-		incoming: incoming,
-		outgoing: outgoing,
-		maps:     make(chan string, 1),
-		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		relay:       relay.New(),
+		Clients:     clients,
+		incoming:    incoming,
+		outgoing:    outgoing,
+		maps:        make(chan string, 1),
+		entities:    make(chan mapEntities, 1),
+		disconnects: make(chan ClientDisconnect, 10),
+		auths:       make(chan ClientAuth, 10),
+		rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		allowed:     make(map[uint32]struct{}),
 	}
 
 	return s
@@ -105,12 +149,17 @@ func (s *Server) Poll(ctx context.Context) {
 	chanLock := chanlock.New()
 	health := chanLock.Poll(s.Ctx())
 
+	idleTicker := time.NewTicker(idleCheckInterval)
+	defer idleTicker.Stop()
+
 	for {
 		select {
 		case <-s.Ctx().Done():
 			return
 		case <-health:
 			continue
+		case <-idleTicker.C:
+			s.checkIdle()
 		case msg := <-s.incoming:
 			client := s.Clients.GetClientByID(msg.Session)
 			if client == nil {
@@ -120,10 +169,29 @@ func (s *Server) Poll(ctx context.Context) {
 			for _, message := range msg.Messages {
 				s.HandlePacket(client, msg.Channel, message)
 			}
+		case loaded := <-s.entities:
+			// The map may have changed while it was loading
+			if loaded.Map != s.Map {
+				continue
+			}
+
+			if mode, ok := s.GameMode.(game.UsesMapEntities); ok {
+				mode.InitFromEntities(loaded.Entities)
+			}
 		}
 	}
 }
 
+// SetEntities gives the server the entities of the given map, which game
+// modes use to set up pickups and flags. Until this is called, the server
+// relies on what clients report.
+func (s *Server) SetEntities(mapName string, entities []game.MapEntity) {
+	select {
+	case s.entities <- mapEntities{Map: mapName, Entities: entities}:
+	case <-s.Ctx().Done():
+	}
+}
+
 func (s *Server) Incoming() chan<- ServerPacket {
 	return s.incoming
 }
@@ -136,6 +204,14 @@ func (s *Server) ReceiveMaps() <-chan string {
 	return s.maps
 }
 
+func (s *Server) ReceiveDisconnects() <-chan ClientDisconnect {
+	return s.disconnects
+}
+
+func (s *Server) ReceiveAuths() <-chan ClientAuth {
+	return s.auths
+}
+
 func (s *Server) GameDuration() time.Duration {
 	return time.Duration(s.Config.MatchLength) * time.Second
 }
@@ -170,7 +246,7 @@ func (s *Server) Connect(sessionId uint32) (*Client, <-chan bool) {
 			Client:      int32(client.CN),
 			Protocol:    P.PROTOCOL_VERSION,
 			SessionId:   int32(client.SessionID),
-			HasPassword: false, // password protection is not used by this implementation
+			HasPassword: s.HasPassword(),
 			Description: s.Description,
 			Domain:      "",
 		},
@@ -188,7 +264,7 @@ func (s *Server) RefreshServerInfo() {
 				Client:      int32(c.CN),
 				Protocol:    P.PROTOCOL_VERSION,
 				SessionId:   int32(c.SessionID),
-				HasPassword: false, // password protection is not used by this implementation
+				HasPassword: s.HasPassword(),
 				Description: s.Description,
 				Domain:      "",
 			},
@@ -233,6 +309,72 @@ func (s *Server) ForceRespawn(target *Client) {
 	})
 }
 
+// SetSpectator moves a client to or from the spectators.
+func (s *Server) SetSpectator(spectator *Client, toggle bool) {
+	if toggle {
+		log.Printf("Client %d (CN: %d) transitioning to spectator mode from state %d", spectator.SessionID, spectator.CN, spectator.State)
+		if spectator.State == playerstate.Alive {
+			s.GameMode.HandleFrag(&spectator.Player, &spectator.Player)
+		}
+		s.GameMode.Leave(&spectator.Player)
+		s.Clock.Leave(&spectator.Player)
+		spectator.State = playerstate.Spectator
+	} else {
+		log.Printf("Client %d (CN: %d) leaving spectator mode, transitioning to Dead state", spectator.SessionID, spectator.CN)
+		spectator.State = playerstate.Dead
+		spectator.MarkActive()
+		if teamedMode, ok := s.GameMode.(game.TeamMode); ok {
+			teamedMode.Join(&spectator.Player)
+		}
+		// todo: checkmap
+	}
+	s.Clients.Broadcast(P.Spectator{int32(spectator.CN), toggle})
+}
+
+// SetTeam puts a client on a team, if the game is played in teams.
+func (s *Server) SetTeam(client *Client, team string) {
+	teamMode, ok := s.GameMode.(game.TeamMode)
+	if !ok || client.Team.Name == team {
+		return
+	}
+
+	teamMode.ChangeTeam(&client.Player, team, true)
+}
+
+// TeamNames returns the names of the teams in the current game, sorted, or
+// nothing if it is not played in teams.
+func (s *Server) TeamNames() []string {
+	teamMode, ok := s.GameMode.(game.TeamMode)
+	if !ok {
+		return nil
+	}
+
+	names := make([]string, 0)
+	for name := range teamMode.Teams() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) ForceRespawnAll() {
+	s.ForceRespawn(nil)
+}
+
+func (s *Server) SetEliminated(p *game.Player, eliminated bool) {
+	client := s.Clients.GetClientByCN(p.CN)
+	if client == nil {
+		return
+	}
+
+	if eliminated {
+		client.State = playerstate.Spectator
+	} else {
+		client.State = playerstate.Dead
+	}
+	s.Clients.Broadcast(P.Spectator{int32(client.CN), eliminated})
+}
+
 // Kill all players, reset their scores (if resetFrags is true), and respawn them.
 func (s *Server) ResetPlayers(resetFrags bool) {
 	s.Clients.ForEach(func(c *Client) {
@@ -254,23 +396,35 @@ func (s *Server) ResetPlayers(resetFrags bool) {
 	})
 }
 
-func (s *Server) TryJoin(c *Client, name string, playerModel int32, authDomain, authName string) {
+func (s *Server) TryJoin(c *Client, name string, playerModel int32, password, authDomain, authName string) {
 	// ignore this if the user has already joined
 	if c.Joined {
 		return
 	}
 
+	if !s.checkJoinPassword(c, password) {
+		log.Info().Msgf("client %s provided the wrong password", c)
+		s.Disconnect(c, disconnectreason.WrongPassword)
+		return
+	}
+
 	c.Name = name
 	c.Model = playerModel
 	s.Join(c)
+
+	// Clients can authenticate automatically when they connect
+	if authDomain != "" && authName != "" {
+		s.tryAuth(c, authName, authDomain)
+	}
 }
 
 // Puts a client into the current game, using the data the client provided with his nmc.TryJoin packet.
 func (s *Server) Join(c *Client) {
 	c.Joined = true
+	c.MarkActive()
 	c.connected <- true
 
-	if s.MasterMode == mastermode.Locked {
+	if s.MasterMode == mastermode.Locked || c.ForcedSpectator {
 		c.State = playerstate.Spectator
 	} else {
 		c.State = playerstate.Dead
@@ -385,6 +539,28 @@ func (s *Server) Leave(sessionId uint32) {
 }
 
 func (s *Server) Disconnect(client *Client, reason disconnectreason.ID) {
+	s.disconnect(client, reason, false)
+}
+
+// DisconnectViolently removes a client that misbehaved, so that whoever
+// owns the connection drops it instead of moving it elsewhere.
+func (s *Server) DisconnectViolently(client *Client, reason disconnectreason.ID) {
+	s.disconnect(client, reason, true)
+}
+
+func (s *Server) disconnect(client *Client, reason disconnectreason.ID, violent bool) {
+	// Let whoever owns the connection know the client was removed
+	if reason != disconnectreason.None {
+		select {
+		case s.disconnects <- ClientDisconnect{
+			Session: client.SessionID,
+			Reason:  reason,
+			Violent: violent,
+		}:
+		default:
+		}
+	}
+
 	s.GameMode.Leave(&client.Player)
 	s.Clock.Leave(&client.Player)
 	s.Clients.Disconnect(client, reason)
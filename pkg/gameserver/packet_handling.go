@@ -78,7 +78,7 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, message P.Message
 
 	if !isValidMessage(client, packetType) {
 		log.Println("invalid network message code", packetType, "from CN", client.CN)
-		s.Disconnect(client, disconnectreason.MessageError)
+		s.DisconnectViolently(client, disconnectreason.MessageError)
 		return
 	}
 
@@ -87,6 +87,16 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, message P.Message
 			return
 		}
 
+		client.MarkActive()
+
+		if edit, ok := message.(P.EditVar); ok {
+			edit, ok = s.checkEditVar(client, edit)
+			if !ok {
+				return
+			}
+			message = edit
+		}
+
 		s.Clients.Broadcast(message)
 
 		s.Edits.Publish(MapEdit{
@@ -108,6 +118,7 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, message P.Message
 			msg.State.LifeSequence = client.LifeSequence
 			client.Positions.Publish(msg)
 			client.Position = mapVec(msg.State.O)
+			client.trackMovement(msg.State)
 		} else {
 			log.Printf("Position update rejected for client %d (CN: %d): client state is %d (expected Alive=%d or Editing=%d), life sequence=%d, lastSpawnAttempt.IsZero=%t", 
 				client.SessionID, client.CN, client.State, playerstate.Alive, playerstate.Editing, client.LifeSequence, client.LastSpawnAttempt.IsZero())
@@ -139,7 +150,7 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, message P.Message
 	// channel 1 traffic
 	case P.N_CONNECT:
 		msg := message.(P.Connect)
-		s.TryJoin(client, msg.Name, int32(msg.Model), msg.AuthDescription, msg.AuthName)
+		s.TryJoin(client, msg.Name, int32(msg.Model), msg.Password, msg.AuthDescription, msg.AuthName)
 
 	case P.N_SETMASTER:
 		msg := message.(P.SetMaster)
@@ -148,13 +159,29 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, message P.Message
 		switch msg.Master {
 		case 0:
 			s.setRole(client, cn, role.None)
-			for domain := range client.Authentications {
-				delete(client.Authentications, domain)
-			}
+			client.clearAuthentications()
 		default:
 			s.setRole(client, cn, role.Master)
 		}
 
+	case P.N_AUTHTRY:
+		msg := message.(P.AuthTry)
+		s.tryAuth(client, msg.Name, msg.Description)
+
+	case P.N_AUTHANS:
+		msg := message.(P.AuthAns)
+		s.answerChallenge(client, uint32(msg.Id), msg.Answer, msg.Description)
+
+	case P.N_AUTHKICK:
+		msg := message.(P.AuthKick)
+
+		victim := s.Clients.GetClientByCN(uint32(msg.Victim))
+		if victim == nil || victim == client {
+			return
+		}
+
+		s.authKick(client, msg.Name, msg.Description, victim, msg.Reason)
+
 	case P.N_KICK:
 		msg := message.(P.Kick)
 
@@ -198,23 +225,22 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, message P.Message
 			return
 		}
 
-		if toggle {
-			log.Printf("Client %d (CN: %d) transitioning to spectator mode from state %d", spectator.SessionID, spectator.CN, spectator.State)
-			if client.State == playerstate.Alive {
-				s.GameMode.HandleFrag(&spectator.Player, &spectator.Player)
-			}
-			s.GameMode.Leave(&spectator.Player)
-			s.Clock.Leave(&spectator.Player)
-			spectator.State = playerstate.Spectator
-		} else {
-			log.Printf("Client %d (CN: %d) leaving spectator mode, transitioning to Dead state", spectator.SessionID, spectator.CN)
-			spectator.State = playerstate.Dead
-			if teamedMode, ok := s.GameMode.(game.TeamMode); ok {
-				teamedMode.Join(&spectator.Player)
-			}
-			// todo: checkmap
+		if !toggle && spectator.ForcedSpectator {
+			client.Message(cubecode.Fail("you can only spectate this game"))
+			return
+		}
+
+		if toggle && !s.HasSpectatorSlot() {
+			client.Message(cubecode.Fail("there are too many spectators"))
+			return
 		}
-		s.Clients.Broadcast(P.Spectator{int32(spectator.CN), toggle})
+
+		if !toggle && !s.HasFreeSlot() {
+			client.Message(cubecode.Fail("the game is full"))
+			return
+		}
+
+		s.SetSpectator(spectator, toggle)
 
 	case P.N_MAPVOTE:
 		msg := message.(P.MapVote)
@@ -260,9 +286,12 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, message P.Message
 		client.Packets.Publish(P.ClientPing{int32(client.Ping)})
 
 	case P.N_TEXT:
+		client.MarkActive()
 		client.Packets.Publish(message.(P.Text))
 
 	case P.N_SAYTEAM:
+		client.MarkActive()
+
 		// client sending team chat message → pass on to team immediately
 		msg := message.(P.SayTeam).Text
 		s.Clients.SendToTeam(client, P.SayTeam{msg})
@@ -287,6 +316,11 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, message P.Message
 	case P.N_SWITCHTEAM:
 		msg := message.(P.SwitchTeam)
 
+		if s.LockTeams {
+			client.Message(cubecode.Fail("teams are locked in this game"))
+			return
+		}
+
 		teamName := msg.Team
 
 		if client.Team.Name == teamName {
@@ -310,6 +344,11 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, message P.Message
 			return
 		}
 
+		if s.LockTeams {
+			client.Message(cubecode.Fail("teams are locked in this game"))
+			return
+		}
+
 		teamMode, ok := s.GameMode.(game.TeamMode)
 		if !ok {
 			return
@@ -348,6 +387,7 @@ func (s *Server) HandlePacket(client *Client, channelID uint8, message P.Message
 
 	case P.N_SHOOT:
 		msg := message.(P.Shoot)
+		client.MarkActive()
 
 		log.Printf("Shoot request from client %d (CN: %d): state=%d, weapon=%d, ammo=%d", 
 			client.SessionID, client.CN, client.State, msg.Gun, client.Ammo[weapon.ID(msg.Gun)])
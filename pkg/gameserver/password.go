@@ -0,0 +1,81 @@
+package gameserver
+
+import (
+	"context"
+
+	"github.com/cfoust/sour/pkg/game/crypto"
+)
+
+// SetPassword sets the password clients must provide to join. An empty
+// password makes the server open to everyone again.
+func (s *Server) SetPassword(password string) {
+	s.passwordMutex.Lock()
+	s.password = password
+	s.passwordMutex.Unlock()
+
+	s.RefreshServerInfo()
+}
+
+func (s *Server) HasPassword() bool {
+	s.passwordMutex.Lock()
+	defer s.passwordMutex.Unlock()
+	return s.password != ""
+}
+
+// CheckPassword compares a plaintext password against the server's.
+func (s *Server) CheckPassword(password string) bool {
+	s.passwordMutex.Lock()
+	defer s.passwordMutex.Unlock()
+	return s.password == "" || s.password == password
+}
+
+// AllowSession lets the client with the given session join without
+// providing the password, e.g. because it was already checked elsewhere.
+// The session is forgotten once ctx, usually the client's session, ends.
+func (s *Server) AllowSession(ctx context.Context, sessionId uint32) {
+	s.passwordMutex.Lock()
+	s.allowed[sessionId] = struct{}{}
+	s.passwordMutex.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.Ctx().Done():
+			return
+		}
+
+		s.passwordMutex.Lock()
+		delete(s.allowed, sessionId)
+		s.passwordMutex.Unlock()
+	}()
+}
+
+// IsSessionAllowed reports whether the client with the given session may
+// join without providing the password.
+func (s *Server) IsSessionAllowed(sessionId uint32) bool {
+	s.passwordMutex.Lock()
+	defer s.passwordMutex.Unlock()
+	_, ok := s.allowed[sessionId]
+	return ok
+}
+
+// checkJoinPassword checks the password hash a client sent in N_CONNECT.
+func (s *Server) checkJoinPassword(c *Client, hash string) bool {
+	s.passwordMutex.Lock()
+	defer s.passwordMutex.Unlock()
+
+	if s.password == "" {
+		return true
+	}
+
+	// Allowed sessions may leave and come back
+	if _, ok := s.allowed[c.SessionID]; ok {
+		return true
+	}
+
+	return hash == crypto.HashPassword(
+		int32(c.CN),
+		int32(c.SessionID),
+		s.password,
+	)
+}
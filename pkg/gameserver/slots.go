@@ -0,0 +1,38 @@
+package gameserver
+
+import (
+	"github.com/cfoust/sour/pkg/gameserver/protocol/playerstate"
+)
+
+// NumPlayers returns the number of clients that are playing or about to,
+// which unlike NumberOfPlayers includes clients that are still connecting.
+func (s *Server) NumPlayers() (n int) {
+	s.Clients.ForEach(func(c *Client) {
+		if c.State != playerstate.Spectator && !c.ForcedSpectator {
+			n++
+		}
+	})
+	return
+}
+
+// NumSpectators includes clients that are connecting to spectate.
+func (s *Server) NumSpectators() (n int) {
+	s.Clients.ForEach(func(c *Client) {
+		if c.State == playerstate.Spectator || c.ForcedSpectator {
+			n++
+		}
+	})
+	return
+}
+
+// HasFreeSlot reports whether another client can join the game as a
+// player. A MaxClients of zero means there is no limit.
+func (s *Server) HasFreeSlot() bool {
+	return s.MaxClients <= 0 || s.NumPlayers() < s.MaxClients
+}
+
+// HasSpectatorSlot reports whether another client can spectate. Spectators
+// do not count against MaxClients, only against MaxSpectators.
+func (s *Server) HasSpectatorSlot() bool {
+	return s.MaxSpectators <= 0 || s.NumSpectators() < s.MaxSpectators
+}
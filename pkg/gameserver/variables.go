@@ -0,0 +1,47 @@
+package gameserver
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	P "github.com/cfoust/sour/pkg/game/protocol"
+	"github.com/cfoust/sour/pkg/game/variables"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/cubecode"
+)
+
+func (s *Server) isVariableLocked(name string) bool {
+	for _, locked := range s.LockedVariables {
+		if strings.EqualFold(locked, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEditVar constrains a map variable a client changed to its range of
+// valid values. It returns the message to broadcast in place of the
+// original and false if the change should be dropped.
+func (s *Server) checkEditVar(client *Client, edit P.EditVar) (P.EditVar, bool) {
+	if s.isVariableLocked(edit.Key) {
+		client.Message(cubecode.Fail(fmt.Sprintf(
+			"%s is locked on this server, your change only affects you",
+			edit.Key,
+		)))
+		return edit, false
+	}
+
+	if edit.Value == nil {
+		return edit, false
+	}
+
+	value, err := variables.Constrain(edit.Key, edit.Value)
+	if err != nil {
+		log.Printf("dropped edit var from %s: %s", s.Clients.UniqueName(client), err)
+		client.Message(cubecode.Fail(err.Error()))
+		return edit, false
+	}
+
+	edit.Value = value
+	return edit, true
+}
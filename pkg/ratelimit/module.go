@@ -0,0 +1,245 @@
+// Package ratelimit protects servers from clients that flood them with
+// chat, sounds, name changes, and commands. Each client gets a token bucket
+// per class of message, and clients that keep hitting the limit are
+// escalated from warnings to mutes to kicks.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type Class string
+
+const (
+	ClassChat    Class = "chat"
+	ClassSound   Class = "sound"
+	ClassTaunt   Class = "taunt"
+	ClassName    Class = "name"
+	ClassCommand Class = "command"
+)
+
+var Classes = []Class{
+	ClassChat,
+	ClassSound,
+	ClassTaunt,
+	ClassName,
+	ClassCommand,
+}
+
+type Limit struct {
+	// How many messages per second are allowed on average
+	Rate float64
+	// How many messages can be sent at once
+	Burst int
+}
+
+// A limit of zero means the class is not limited.
+func (l Limit) unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+type Config struct {
+	Enabled bool
+	Chat    Limit
+	Sound   Limit
+	Taunt   Limit
+	Name    Limit
+	Command Limit
+	// How many dropped messages within StrikeWindow get a client muted
+	// or kicked. Zero disables the escalation.
+	MuteAfter int
+	KickAfter int
+	// In seconds
+	StrikeWindow int
+	MuteSeconds  int
+}
+
+func (c Config) limit(class Class) Limit {
+	switch class {
+	case ClassChat:
+		return c.Chat
+	case ClassSound:
+		return c.Sound
+	case ClassTaunt:
+		return c.Taunt
+	case ClassName:
+		return c.Name
+	case ClassCommand:
+		return c.Command
+	}
+	return Limit{}
+}
+
+func (c Config) MuteDuration() time.Duration {
+	return time.Duration(c.MuteSeconds) * time.Second
+}
+
+// What to do with a message.
+type Action uint8
+
+const (
+	Allow Action = iota
+	// Drop the message and tell the client to slow down
+	Warn
+	// Drop the message, the client has already been warned
+	Drop
+	// Drop the message and mute the client
+	Mute
+	// Drop the message and kick the client
+	Kick
+)
+
+func (a Action) String() string {
+	switch a {
+	case Allow:
+		return "allow"
+	case Warn:
+		return "warn"
+	case Drop:
+		return "drop"
+	case Mute:
+		return "mute"
+	case Kick:
+		return "kick"
+	}
+	return "unknown"
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func (b *bucket) take(limit Limit, now time.Time) bool {
+	b.tokens += now.Sub(b.updated).Seconds() * limit.Rate
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// Counts tracks what happened to a client's messages of a single class.
+type Counts struct {
+	Allowed int
+	Dropped int
+}
+
+// Limiter limits the messages of a single client.
+type Limiter struct {
+	config Config
+
+	mutex   sync.Mutex
+	buckets map[Class]*bucket
+	counts  map[Class]*Counts
+	strikes []time.Time
+	warned  bool
+}
+
+func New(config Config) *Limiter {
+	return &Limiter{
+		config:  config,
+		buckets: make(map[Class]*bucket),
+		counts:  make(map[Class]*Counts),
+	}
+}
+
+// Check records a message of the given class and decides what to do with
+// it.
+func (l *Limiter) Check(class Class) Action {
+	return l.check(class, time.Now())
+}
+
+func (l *Limiter) check(class Class, now time.Time) Action {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	counts, ok := l.counts[class]
+	if !ok {
+		counts = &Counts{}
+		l.counts[class] = counts
+	}
+
+	limit := l.config.limit(class)
+	if !l.config.Enabled || limit.unlimited() {
+		counts.Allowed++
+		return Allow
+	}
+
+	state, ok := l.buckets[class]
+	if !ok {
+		state = &bucket{
+			tokens:  float64(limit.Burst),
+			updated: now,
+		}
+		l.buckets[class] = state
+	}
+
+	if state.take(limit, now) {
+		counts.Allowed++
+		l.warned = false
+		return Allow
+	}
+
+	counts.Dropped++
+
+	window := time.Duration(l.config.StrikeWindow) * time.Second
+	strikes := l.strikes[:0]
+	for _, strike := range l.strikes {
+		if now.Sub(strike) < window {
+			strikes = append(strikes, strike)
+		}
+	}
+	l.strikes = append(strikes, now)
+
+	numStrikes := len(l.strikes)
+	if l.config.KickAfter > 0 && numStrikes >= l.config.KickAfter {
+		return Kick
+	}
+
+	if l.config.MuteAfter > 0 && numStrikes == l.config.MuteAfter {
+		return Mute
+	}
+
+	if !l.warned {
+		l.warned = true
+		return Warn
+	}
+
+	return Drop
+}
+
+// Counts returns the counters for every class of message the client has
+// sent.
+func (l *Limiter) Counts() map[Class]Counts {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	counts := make(map[Class]Counts)
+	for class, count := range l.counts {
+		counts[class] = *count
+	}
+	return counts
+}
+
+// Strikes returns the number of recently dropped messages.
+func (l *Limiter) Strikes() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	window := time.Duration(l.config.StrikeWindow) * time.Second
+	numStrikes := 0
+	for _, strike := range l.strikes {
+		if time.Since(strike) < window {
+			numStrikes++
+		}
+	}
+	return numStrikes
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	limiter := New(Config{
+		Enabled:      true,
+		Chat:         Limit{Rate: 1, Burst: 2},
+		MuteAfter:    2,
+		KickAfter:    4,
+		StrikeWindow: 60,
+	})
+
+	now := time.Now()
+
+	require.Equal(t, Allow, limiter.check(ClassChat, now))
+	require.Equal(t, Allow, limiter.check(ClassChat, now))
+	require.Equal(t, Warn, limiter.check(ClassChat, now))
+	require.Equal(t, Mute, limiter.check(ClassChat, now))
+
+	// Other classes are not limited
+	require.Equal(t, Allow, limiter.check(ClassSound, now))
+
+	// The bucket refills over time
+	now = now.Add(time.Second)
+	require.Equal(t, Allow, limiter.check(ClassChat, now))
+	require.Equal(t, Warn, limiter.check(ClassChat, now))
+	require.Equal(t, Kick, limiter.check(ClassChat, now))
+
+	counts := limiter.Counts()
+	require.Equal(t, Counts{Allowed: 3, Dropped: 4}, counts[ClassChat])
+	require.Equal(t, Counts{Allowed: 1}, counts[ClassSound])
+}
+
+func TestStrikeWindow(t *testing.T) {
+	limiter := New(Config{
+		Enabled:      true,
+		Name:         Limit{Rate: 0.1, Burst: 1},
+		KickAfter:    2,
+		StrikeWindow: 10,
+	})
+
+	now := time.Now()
+	require.Equal(t, Allow, limiter.check(ClassName, now))
+	require.Equal(t, Warn, limiter.check(ClassName, now))
+
+	// The first strike has expired by now
+	now = now.Add(11 * time.Second)
+	require.Equal(t, Allow, limiter.check(ClassName, now))
+	require.Equal(t, Warn, limiter.check(ClassName, now))
+	require.Equal(t, Kick, limiter.check(ClassName, now))
+}
+
+func TestDisabled(t *testing.T) {
+	limiter := New(Config{
+		Chat: Limit{Rate: 1, Burst: 1},
+	})
+
+	for i := 0; i < 10; i++ {
+		require.Equal(t, Allow, limiter.Check(ClassChat))
+	}
+}
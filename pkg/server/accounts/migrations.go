@@ -0,0 +1,107 @@
+package accounts
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// schemaVersion records each migration that has been applied.
+type schemaVersion struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	AppliedAt time.Time
+}
+
+func (schemaVersion) TableName() string {
+	return "schema_versions"
+}
+
+type migration struct {
+	Description string
+	Up          func(tx *gorm.DB) error
+}
+
+// Migrations are applied in order and never edited once released. Each one
+// works on its own copy of the tables it touches so that later changes to
+// the models do not change what it does.
+var migrations = []migration{
+	{
+		Description: "create accounts and ratings",
+		Up: func(tx *gorm.DB) error {
+			type Account struct {
+				ID        uint   `gorm:"primaryKey"`
+				Identity  string `gorm:"uniqueIndex;not null"`
+				Name      string
+				CreatedAt time.Time
+				LastSeen  time.Time
+			}
+
+			type Rating struct {
+				ID        uint   `gorm:"primaryKey"`
+				AccountID uint   `gorm:"uniqueIndex:idx_ratings_account_duel;not null"`
+				DuelType  string `gorm:"uniqueIndex:idx_ratings_account_duel;not null"`
+				Rating    uint
+				Wins      uint
+				Draws     uint
+				Losses    uint
+				UpdatedAt time.Time
+			}
+
+			return tx.AutoMigrate(&Account{}, &Rating{})
+		},
+	},
+	{
+		Description: "create offences",
+		Up: func(tx *gorm.DB) error {
+			type Offence struct {
+				ID        uint   `gorm:"primaryKey"`
+				AccountID uint   `gorm:"index;not null"`
+				Kind      string `gorm:"not null"`
+				CreatedAt time.Time
+			}
+
+			return tx.AutoMigrate(&Offence{})
+		},
+	},
+}
+
+// Migrate applies any migrations the database has not seen yet.
+func Migrate(db *gorm.DB) error {
+	err := db.AutoMigrate(&schemaVersion{})
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = db.Model(&schemaVersion{}).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&current).Error
+	if err != nil {
+		return err
+	}
+
+	for i, m := range migrations {
+		version := i + 1
+		if version <= current {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			err := m.Up(tx)
+			if err != nil {
+				return err
+			}
+
+			return tx.Create(&schemaVersion{
+				Version:   version,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", version, m.Description, err)
+		}
+	}
+
+	return nil
+}
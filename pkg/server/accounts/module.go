@@ -0,0 +1,250 @@
+package accounts
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// An Account is a player's persistent identity on the cluster. Accounts are
+// linked to an auth identity so that ratings survive reconnects.
+type Account struct {
+	ID uint `gorm:"primaryKey"`
+	// The auth identity the account belongs to, of the form name@domain
+	// and always lowercase
+	Identity string `gorm:"uniqueIndex;not null"`
+	// The name the player last used
+	Name      string
+	CreatedAt time.Time
+	LastSeen  time.Time
+
+	Ratings []Rating
+}
+
+// A Rating is an account's standing in one type of duel.
+type Rating struct {
+	ID        uint   `gorm:"primaryKey"`
+	AccountID uint   `gorm:"uniqueIndex:idx_ratings_account_duel;not null"`
+	DuelType  string `gorm:"uniqueIndex:idx_ratings_account_duel;not null"`
+	Rating    uint
+	Wins      uint
+	Draws     uint
+	Losses    uint
+	UpdatedAt time.Time
+}
+
+// Open opens (or creates) the SQLite database at path and brings its schema
+// up to date. An empty path opens a database that only lives in memory.
+func Open(path string) (*gorm.DB, error) {
+	if path == "" {
+		path = ":memory:"
+	}
+
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only supports one writer at a time, and every connection to
+	// an in-memory database gets a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	err = Migrate(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+type Store struct {
+	db *gorm.DB
+}
+
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// Login finds the account linked to an identity, creating it if it does not
+// exist yet, and records the name the player is using.
+func (s *Store) Login(identity string, name string) (*Account, error) {
+	identity = strings.ToLower(identity)
+	now := time.Now()
+
+	account := Account{}
+	err := s.db.Preload("Ratings").Where("identity = ?", identity).First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		account = Account{
+			Identity: identity,
+			Name:     name,
+			LastSeen: now,
+		}
+		err = s.db.Create(&account).Error
+		if err != nil {
+			return nil, err
+		}
+		return &account, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	account.Name = name
+	account.LastSeen = now
+	err = s.db.Model(&account).Updates(map[string]interface{}{
+		"name":      name,
+		"last_seen": now,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+// SaveRating stores an account's standing in a type of duel.
+func (s *Store) SaveRating(rating Rating) error {
+	rating.ID = 0
+	rating.UpdatedAt = time.Now()
+
+	return s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "account_id"},
+			{Name: "duel_type"},
+		},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"rating",
+			"wins",
+			"draws",
+			"losses",
+			"updated_at",
+		}),
+	}).Create(&rating).Error
+}
+
+// The kinds of Offence
+const (
+	// Leaving a match before it ended
+	OffenceLeave = "leave"
+	// Leaving a match before it began
+	OffenceDodge = "dodge"
+)
+
+// An Offence is an account leaving or dodging a matchmade game.
+type Offence struct {
+	ID        uint   `gorm:"primaryKey"`
+	AccountID uint   `gorm:"index;not null"`
+	Kind      string `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// RecordOffence stores an offence an account committed at a given time.
+func (s *Store) RecordOffence(accountID uint, kind string, at time.Time) error {
+	return s.db.Create(&Offence{
+		AccountID: accountID,
+		Kind:      kind,
+		CreatedAt: at,
+	}).Error
+}
+
+// Offences returns the offences an account committed after since, oldest
+// first.
+func (s *Store) Offences(accountID uint, since time.Time) ([]Offence, error) {
+	offences := make([]Offence, 0)
+	err := s.db.
+		Where("account_id = ? AND created_at > ?", accountID, since).
+		Order("created_at ASC").
+		Find(&offences).Error
+	if err != nil {
+		return nil, err
+	}
+	return offences, nil
+}
+
+// A Standing is an account's place on the leaderboard of a type of duel.
+type Standing struct {
+	Rank     int    `json:"rank"`
+	Name     string `json:"name"`
+	Identity string `json:"-"`
+	Rating   uint   `json:"rating"`
+	Wins     uint   `json:"wins"`
+	Draws    uint   `json:"draws"`
+	Losses   uint   `json:"losses"`
+}
+
+// qualified selects the ratings of a duel type with at least minGames
+// games played.
+func (s *Store) qualified(duelType string, minGames int) *gorm.DB {
+	return s.db.Table("ratings").
+		Joins("JOIN accounts ON accounts.id = ratings.account_id").
+		Where("ratings.duel_type = ?", duelType).
+		Where("ratings.wins + ratings.draws + ratings.losses >= ?", minGames)
+}
+
+// Leaderboard returns the best limit accounts in a type of duel. Accounts
+// need at least minGames games to be ranked.
+func (s *Store) Leaderboard(duelType string, minGames int, limit int) ([]Standing, error) {
+	standings := make([]Standing, 0)
+	err := s.qualified(duelType, minGames).
+		Select("accounts.name, accounts.identity, ratings.rating, ratings.wins, ratings.draws, ratings.losses").
+		Order("ratings.rating DESC, ratings.wins DESC, accounts.id ASC").
+		Limit(limit).
+		Scan(&standings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Players with the same rating share a rank
+	for i := range standings {
+		if i > 0 && standings[i].Rating == standings[i-1].Rating {
+			standings[i].Rank = standings[i-1].Rank
+		} else {
+			standings[i].Rank = i + 1
+		}
+	}
+
+	return standings, nil
+}
+
+// FindStanding returns the standing of the account with the given name or
+// identity, or nil if it does not exist or has not played enough games.
+func (s *Store) FindStanding(duelType string, minGames int, name string) (*Standing, error) {
+	standings := make([]Standing, 0)
+	err := s.qualified(duelType, minGames).
+		Select("accounts.name, accounts.identity, ratings.rating, ratings.wins, ratings.draws, ratings.losses").
+		Where("LOWER(accounts.name) = ? OR accounts.identity = ?", strings.ToLower(name), strings.ToLower(name)).
+		Order("accounts.last_seen DESC").
+		Limit(1).
+		Scan(&standings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(standings) == 0 {
+		return nil, nil
+	}
+
+	standing := standings[0]
+
+	var better int64
+	err = s.qualified(duelType, minGames).
+		Where("ratings.rating > ?", standing.Rating).
+		Count(&better).Error
+	if err != nil {
+		return nil, err
+	}
+
+	standing.Rank = int(better) + 1
+	return &standing, nil
+}
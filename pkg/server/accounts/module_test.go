@@ -0,0 +1,118 @@
+package accounts
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sour.db")
+
+	db, err := Open(path)
+	require.NoError(t, err)
+	store := NewStore(db)
+
+	account, err := store.Login("Alice@sour", "alice")
+	require.NoError(t, err)
+	require.Equal(t, "alice@sour", account.Identity)
+	require.Empty(t, account.Ratings)
+
+	err = store.SaveRating(Rating{
+		AccountID: account.ID,
+		DuelType:  "ffa",
+		Rating:    1216,
+		Wins:      1,
+	})
+	require.NoError(t, err)
+
+	err = store.SaveRating(Rating{
+		AccountID: account.ID,
+		DuelType:  "ffa",
+		Rating:    1200,
+		Wins:      1,
+		Losses:    1,
+	})
+	require.NoError(t, err)
+
+	// Migrating again does nothing
+	db, err = Open(path)
+	require.NoError(t, err)
+	store = NewStore(db)
+
+	again, err := store.Login("alice@sour", "Alice2")
+	require.NoError(t, err)
+	require.Equal(t, account.ID, again.ID)
+	require.Equal(t, "Alice2", again.Name)
+	require.Len(t, again.Ratings, 1)
+	require.Equal(t, uint(1200), again.Ratings[0].Rating)
+	require.Equal(t, uint(1), again.Ratings[0].Losses)
+}
+
+func TestLeaderboard(t *testing.T) {
+	db, err := Open("")
+	require.NoError(t, err)
+	store := NewStore(db)
+
+	for _, player := range []struct {
+		name   string
+		rating uint
+		games  uint
+	}{
+		{"alice", 1300, 10},
+		{"bob", 1250, 10},
+		{"carol", 1250, 5},
+		{"dave", 1400, 2},
+	} {
+		account, err := store.Login(player.name+"@sour", player.name)
+		require.NoError(t, err)
+
+		err = store.SaveRating(Rating{
+			AccountID: account.ID,
+			DuelType:  "ffa",
+			Rating:    player.rating,
+			Wins:      player.games,
+		})
+		require.NoError(t, err)
+	}
+
+	top, err := store.Leaderboard("ffa", 5, 10)
+	require.NoError(t, err)
+	require.Len(t, top, 3)
+	require.Equal(t, "alice", top[0].Name)
+	require.Equal(t, 1, top[0].Rank)
+	require.Equal(t, 2, top[1].Rank)
+	require.Equal(t, 2, top[2].Rank)
+
+	standing, err := store.FindStanding("ffa", 5, "Carol")
+	require.NoError(t, err)
+	require.Equal(t, 2, standing.Rank)
+	require.Equal(t, uint(1250), standing.Rating)
+
+	// dave has not played enough games
+	standing, err = store.FindStanding("ffa", 5, "dave")
+	require.NoError(t, err)
+	require.Nil(t, standing)
+}
+
+func TestOffences(t *testing.T) {
+	db, err := Open("")
+	require.NoError(t, err)
+	store := NewStore(db)
+
+	account, err := store.Login("alice@sour", "alice")
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, store.RecordOffence(account.ID, OffenceDodge, now.Add(-48*time.Hour)))
+	require.NoError(t, store.RecordOffence(account.ID, OffenceLeave, now.Add(-time.Hour)))
+	require.NoError(t, store.RecordOffence(account.ID, OffenceDodge, now))
+
+	offences, err := store.Offences(account.ID, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, offences, 2)
+	require.Equal(t, OffenceLeave, offences[0].Kind)
+	require.Equal(t, OffenceDodge, offences[1].Kind)
+}
@@ -0,0 +1,341 @@
+package bans
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// What an entry matches against.
+type Kind string
+
+const (
+	// An IP address or a CIDR range, e.g. 10.0.0.1 or 10.0.0.0/8
+	KindIP Kind = "ip"
+	// An authenticated identity of the form name@domain
+	KindAuth Kind = "auth"
+	// A case-insensitive glob pattern for player names, e.g. *cheater*
+	KindName Kind = "name"
+)
+
+// What happens to a user matching an entry.
+type Action string
+
+const (
+	// The user cannot connect to the cluster at all.
+	ActionBan Action = "ban"
+	// The user cannot chat.
+	ActionMute Action = "mute"
+)
+
+type Entry struct {
+	ID     int
+	Kind   Kind
+	Action Action
+	Target string
+	Reason string
+	// The name of the user who created this entry.
+	Author  string
+	Created time.Time
+	// The zero value means the entry never expires.
+	Expires time.Time
+}
+
+func (e *Entry) IsExpired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+// Describes the expiry of an entry in a human-readable way.
+func (e *Entry) Remaining(now time.Time) string {
+	if e.Expires.IsZero() {
+		return "permanent"
+	}
+
+	remaining := e.Expires.Sub(now).Round(time.Second)
+	if remaining < 0 {
+		return "expired"
+	}
+
+	return remaining.String()
+}
+
+func (e *Entry) String() string {
+	result := fmt.Sprintf(
+		"#%d %s %s:%s (%s)",
+		e.ID,
+		e.Action,
+		e.Kind,
+		e.Target,
+		e.Remaining(time.Now()),
+	)
+
+	if e.Reason != "" {
+		result += ": " + e.Reason
+	}
+
+	return result
+}
+
+// Everything we know about a user that an entry could match.
+type Identity struct {
+	Host string
+	Name string
+	// Authenticated identities, each of the form name@domain
+	Auth []string
+}
+
+// Strip the port, if any, from a host string.
+func normalizeHost(host string) string {
+	if withoutPort, _, err := net.SplitHostPort(host); err == nil {
+		return withoutPort
+	}
+	return host
+}
+
+func (e *Entry) Matches(identity Identity) bool {
+	switch e.Kind {
+	case KindIP:
+		ip := net.ParseIP(normalizeHost(identity.Host))
+		if ip == nil {
+			return false
+		}
+
+		if _, network, err := net.ParseCIDR(e.Target); err == nil {
+			return network.Contains(ip)
+		}
+
+		target := net.ParseIP(e.Target)
+		return target != nil && target.Equal(ip)
+	case KindAuth:
+		for _, auth := range identity.Auth {
+			if strings.EqualFold(auth, e.Target) {
+				return true
+			}
+		}
+		return false
+	case KindName:
+		if identity.Name == "" {
+			return false
+		}
+
+		matched, err := path.Match(
+			strings.ToLower(e.Target),
+			strings.ToLower(identity.Name),
+		)
+		return err == nil && matched
+	}
+
+	return false
+}
+
+// Validate checks that the entry's target makes sense for its kind.
+func (e *Entry) Validate() error {
+	if e.Action != ActionBan && e.Action != ActionMute {
+		return fmt.Errorf("unknown action '%s'", e.Action)
+	}
+
+	switch e.Kind {
+	case KindIP:
+		if _, _, err := net.ParseCIDR(e.Target); err == nil {
+			return nil
+		}
+		if net.ParseIP(e.Target) != nil {
+			return nil
+		}
+		return fmt.Errorf("'%s' is neither an IP address nor a CIDR range", e.Target)
+	case KindAuth:
+		if !strings.Contains(e.Target, "@") {
+			return fmt.Errorf("auth targets must be of the form name@domain")
+		}
+		return nil
+	case KindName:
+		if _, err := path.Match(e.Target, ""); err != nil {
+			return fmt.Errorf("invalid name pattern '%s'", e.Target)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown entry kind '%s'", e.Kind)
+}
+
+// BanList holds bans and mutes and persists them to disk.
+type BanList struct {
+	// If empty, entries are only kept in memory.
+	path    string
+	entries []*Entry
+	nextID  int
+	mutex   deadlock.RWMutex
+}
+
+type banFile struct {
+	NextID  int
+	Entries []*Entry
+}
+
+// New loads the ban list stored at path, creating an empty one if it does
+// not exist yet.
+func New(path string) (*BanList, error) {
+	list := &BanList{
+		path:    path,
+		entries: make([]*Entry, 0),
+		nextID:  1,
+	}
+
+	if path == "" {
+		return list, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return list, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := banFile{}
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse ban list %s: %w", path, err)
+	}
+
+	if file.Entries != nil {
+		list.entries = file.Entries
+	}
+	if file.NextID > list.nextID {
+		list.nextID = file.NextID
+	}
+
+	return list, nil
+}
+
+// save writes the list to disk. Must be called with the mutex held.
+func (b *BanList) save() error {
+	if b.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(banFile{
+		NextID:  b.nextID,
+		Entries: b.entries,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves us with a
+	// truncated ban list
+	temp := b.path + ".tmp"
+	err = os.WriteFile(temp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp, b.path)
+}
+
+// prune removes expired entries. Must be called with the mutex held.
+func (b *BanList) prune(now time.Time) bool {
+	changed := false
+	entries := make([]*Entry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		if entry.IsExpired(now) {
+			changed = true
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	b.entries = entries
+	return changed
+}
+
+func (b *BanList) Add(entry Entry) (*Entry, error) {
+	err := entry.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.prune(time.Now())
+
+	if entry.Created.IsZero() {
+		entry.Created = time.Now()
+	}
+	entry.ID = b.nextID
+	b.nextID++
+
+	b.entries = append(b.entries, &entry)
+
+	return &entry, b.save()
+}
+
+func (b *BanList) Remove(id int) (*Entry, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var removed *Entry
+	entries := make([]*Entry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		if entry.ID == id {
+			removed = entry
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if removed == nil {
+		return nil, fmt.Errorf("no entry with id %d", id)
+	}
+
+	b.entries = entries
+	return removed, b.save()
+}
+
+// Find returns the first unexpired entry with the given action that matches
+// the identity, or nil if there is none.
+func (b *BanList) Find(action Action, identity Identity) *Entry {
+	now := time.Now()
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for _, entry := range b.entries {
+		if entry.Action != action || entry.IsExpired(now) {
+			continue
+		}
+
+		if entry.Matches(identity) {
+			copied := *entry
+			return &copied
+		}
+	}
+
+	return nil
+}
+
+// Entries returns a copy of all of the unexpired entries.
+func (b *BanList) Entries() []Entry {
+	now := time.Now()
+
+	b.mutex.Lock()
+	if b.prune(now) {
+		b.save()
+	}
+
+	entries := make([]Entry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		entries = append(entries, *entry)
+	}
+	b.mutex.Unlock()
+
+	return entries
+}
@@ -0,0 +1,95 @@
+package bans
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatches(t *testing.T) {
+	identity := Identity{
+		Host: "10.1.2.3:28785",
+		Name: "BadGuy",
+		Auth: []string{"badguy@sour"},
+	}
+
+	for _, test := range []struct {
+		entry   Entry
+		matches bool
+	}{
+		{Entry{Kind: KindIP, Target: "10.1.2.3"}, true},
+		{Entry{Kind: KindIP, Target: "10.1.2.4"}, false},
+		{Entry{Kind: KindIP, Target: "10.0.0.0/8"}, true},
+		{Entry{Kind: KindIP, Target: "192.168.0.0/16"}, false},
+		{Entry{Kind: KindAuth, Target: "BADGUY@sour"}, true},
+		{Entry{Kind: KindAuth, Target: "badguy@other"}, false},
+		{Entry{Kind: KindName, Target: "*guy"}, true},
+		{Entry{Kind: KindName, Target: "good*"}, false},
+	} {
+		require.Equal(
+			t,
+			test.matches,
+			test.entry.Matches(identity),
+			"%s:%s",
+			test.entry.Kind,
+			test.entry.Target,
+		)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+
+	list, err := New(path)
+	require.NoError(t, err)
+
+	_, err = list.Add(Entry{
+		Kind:   KindIP,
+		Action: ActionBan,
+		Target: "not an ip",
+	})
+	require.Error(t, err)
+
+	ban, err := list.Add(Entry{
+		Kind:   KindIP,
+		Action: ActionBan,
+		Target: "10.0.0.0/8",
+		Reason: "griefing",
+	})
+	require.NoError(t, err)
+
+	_, err = list.Add(Entry{
+		Kind:    KindName,
+		Action:  ActionMute,
+		Target:  "spammer",
+		Expires: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	loaded, err := New(path)
+	require.NoError(t, err)
+
+	// The expired mute should not be returned
+	entries := loaded.Entries()
+	require.Len(t, entries, 1)
+	require.Equal(t, ban.ID, entries[0].ID)
+
+	require.NotNil(t, loaded.Find(ActionBan, Identity{Host: "10.9.9.9"}))
+	require.Nil(t, loaded.Find(ActionMute, Identity{Host: "10.9.9.9"}))
+	require.Nil(t, loaded.Find(ActionMute, Identity{Name: "spammer"}))
+
+	_, err = loaded.Remove(ban.ID)
+	require.NoError(t, err)
+	require.Nil(t, loaded.Find(ActionBan, Identity{Host: "10.9.9.9"}))
+
+	// IDs are never reused
+	next, err := loaded.Add(Entry{
+		Kind:   KindAuth,
+		Action: ActionBan,
+		Target: "a@b",
+	})
+	require.NoError(t, err)
+	require.Greater(t, next.ID, ban.ID+1)
+}
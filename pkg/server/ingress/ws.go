@@ -34,6 +34,8 @@ const (
 	DiscordCodeOp
 	// server -> client OR client -> server
 	PacketOp
+	// Server -> client
+	PartyOp
 )
 
 type ServerInfo struct {
@@ -55,13 +57,14 @@ type InfoMessage struct {
 		Map         string
 		Mode        int
 		NumClients  int
+		MaxClients  int
 		Description string
 	}
 }
 
 // ClusterLister provides a minimal interface to enumerate built-in servers.
 type ClusterLister interface {
-	ForEachClusterServer(func(alias, mapName string, mode, numClients int, desc string))
+	ForEachClusterServer(func(alias, mapName string, mode, numClients, maxClients int, desc string))
 }
 
 // Contains a packet from the server a client is connected to.
@@ -77,6 +80,8 @@ type ConnectMessage struct {
 	Op int // ConnectOp
 	// One of the servers hosted by the cluster
 	Target string
+	// The password for the server, if it has one
+	Password string
 }
 
 // Issuing a cluster command on behalf of the user.
@@ -103,6 +108,14 @@ type ChatMessage struct {
 	Message string
 }
 
+// The party the client is in. Leader and Members are empty if they are not
+// in one.
+type PartyMessage struct {
+	Op      int // PartyOp
+	Leader  string
+	Members []string
+}
+
 type ResponseMessage struct {
 	Op       int // ServerResponseOp
 	Success  bool
@@ -220,6 +233,16 @@ func (c *WSClient) SendGlobalChat(message string) {
 	c.send <- bytes
 }
 
+func (c *WSClient) SendParty(leader string, members []string) {
+	party := PartyMessage{
+		Op:      PartyOp,
+		Leader:  leader,
+		Members: members,
+	}
+	bytes, _ := cbor.Marshal(party)
+	c.send <- bytes
+}
+
 func (c *WSClient) Disconnect(reason int, message string) {
 	wsPacket := ServerDisconnectedMessage{
 		Op:      ServerDisconnectedOp,
@@ -240,11 +263,11 @@ type WSIngress struct {
 	serverManager ClusterLister
 }
 
-func NewWSIngress(newClients chan Connection, manager ClusterLister) *WSIngress {
+func NewWSIngress(newClients chan Connection, manager ClusterLister, master string) *WSIngress {
 	return &WSIngress{
 		newClients:    newClients,
 		clients:       make(map[*WSClient]struct{}),
-		serverWatcher: watcher.NewWatcher(),
+		serverWatcher: watcher.NewWatcher(master),
 		serverManager: manager,
 	}
 }
@@ -346,10 +369,13 @@ func (server *WSIngress) HandleClient(ctx context.Context, c *websocket.Conn, ho
 			var connectMessage ConnectMessage
 			if err := cbor.Unmarshal(msg, &connectMessage); err == nil &&
 				connectMessage.Op == ConnectOp {
-				target := connectMessage.Target
+				command := fmt.Sprintf("join %s", connectMessage.Target)
+				if connectMessage.Password != "" {
+					command += " " + connectMessage.Password
+				}
 
 				client.commands <- ClusterCommand{
-					Command: fmt.Sprintf("join %s", target),
+					Command: command,
 					// We don't care here
 					Response: make(chan CommandResult, 1),
 				}
@@ -511,18 +537,20 @@ func (server *WSIngress) BuildBroadcast() ([]byte, error) {
 
 	// Add built-in servers from this cluster in a lightweight summary
 	if server.serverManager != nil {
-		server.serverManager.ForEachClusterServer(func(alias, mapName string, mode, numClients int, desc string) {
+		server.serverManager.ForEachClusterServer(func(alias, mapName string, mode, numClients, maxClients int, desc string) {
 			infoMessage.Cluster = append(infoMessage.Cluster, struct{
 				Alias       string
 				Map         string
 				Mode        int
 				NumClients  int
+				MaxClients  int
 				Description string
 			}{
 				Alias:       alias,
 				Map:         mapName,
 				Mode:        mode,
 				NumClients:  numClients,
+				MaxClients:  maxClients,
 				Description: desc,
 			})
 		})
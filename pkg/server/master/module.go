@@ -0,0 +1,348 @@
+package master
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cfoust/sour/pkg/game/crypto"
+
+	"github.com/rs/zerolog/log"
+)
+
+// A master server that speaks the same text protocol as
+// master.sauerbraten.org (see engine/master.cpp). Game servers register
+// with `regserv`, clients fetch the server list with `list`, and game
+// servers can check global auth with `reqauth` and `confauth`.
+
+const (
+	// How long a connection can go without sending anything
+	clientTimeout = 3 * time.Minute
+	// Servers re-register every hour, so drop ones we haven't heard from
+	// in a while
+	serverTimeout = 65 * time.Minute
+	// How long a game server has to answer an auth challenge
+	authTimeout = 30 * time.Second
+	// The maximum number of pending auth requests per connection
+	authLimit = 100
+	// Lines longer than this close the connection
+	inputLimit = 4096
+	// How many times we ping a server on regserv before giving up
+	pingRetries = 5
+)
+
+// How long to wait for each ping response. A variable so tests don't have
+// to wait as long.
+var pingTimeout = 3 * time.Second
+
+type Address struct {
+	Host string
+	Port int
+}
+
+func (a Address) String() string {
+	return net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+}
+
+type registration struct {
+	address Address
+	updated time.Time
+}
+
+type Master struct {
+	listener net.Listener
+	// Users that can authenticate through this master, by name
+	users map[string]*crypto.PublicKey
+
+	mutex   sync.Mutex
+	servers map[Address]*registration
+}
+
+func New(users map[string]*crypto.PublicKey) *Master {
+	if users == nil {
+		users = make(map[string]*crypto.PublicKey)
+	}
+
+	return &Master{
+		users:   users,
+		servers: make(map[Address]*registration),
+	}
+}
+
+// Listen starts listening for connections on the given TCP address, e.g.
+// "0.0.0.0:28787".
+func (m *Master) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	m.listener = listener
+	return nil
+}
+
+func (m *Master) Addr() net.Addr {
+	return m.listener.Addr()
+}
+
+// Serve accepts connections until the context is cancelled.
+func (m *Master) Serve(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		m.listener.Close()
+	}()
+
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Msg("master failed to accept connection")
+			}
+			return
+		}
+
+		go m.handle(ctx, conn)
+	}
+}
+
+// Servers returns all of the game servers that are currently registered.
+func (m *Master) Servers() []Address {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	addresses := make([]Address, 0, len(m.servers))
+	for key, server := range m.servers {
+		if now.Sub(server.updated) > serverTimeout {
+			delete(m.servers, key)
+			continue
+		}
+		addresses = append(addresses, server.address)
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].String() < addresses[j].String()
+	})
+
+	return addresses
+}
+
+type pendingAuth struct {
+	challenge *crypto.Challenge
+	created   time.Time
+}
+
+// The state of a single connection to the master.
+type client struct {
+	conn  net.Conn
+	host  string
+	mutex sync.Mutex
+	auths map[uint32]pendingAuth
+	// The port this client registered, only one is allowed per connection
+	port int
+}
+
+func (c *client) send(format string, args ...interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(clientTimeout))
+	fmt.Fprintf(c.conn, format, args...)
+}
+
+func (m *Master) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return
+	}
+
+	c := &client{
+		conn:  conn,
+		host:  host,
+		auths: make(map[uint32]pendingAuth),
+		port:  -1,
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, inputLimit), inputLimit)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(clientTimeout))
+		if !scanner.Scan() {
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		m.purgeAuths(c)
+
+		switch fields[0] {
+		case "list":
+			m.sendList(c)
+			// Clients expect the connection to close once the list
+			// has been sent
+			return
+		case "regserv":
+			if len(fields) < 2 {
+				continue
+			}
+			port, err := strconv.Atoi(fields[1])
+			if err != nil || port < 0 || port > 0xFFFF-1 || (c.port >= 0 && port != c.port) {
+				c.send("failreg invalid port\n")
+				continue
+			}
+			c.port = port
+			go m.register(ctx, c, port)
+		case "reqauth":
+			if len(fields) < 3 {
+				continue
+			}
+			id, err := strconv.ParseUint(fields[1], 10, 32)
+			if err != nil {
+				continue
+			}
+			m.requestAuth(c, uint32(id), fields[2])
+		case "confauth":
+			if len(fields) < 3 {
+				continue
+			}
+			id, err := strconv.ParseUint(fields[1], 10, 32)
+			if err != nil {
+				continue
+			}
+			m.confirmAuth(c, uint32(id), fields[2])
+		}
+	}
+}
+
+func (m *Master) sendList(c *client) {
+	var list strings.Builder
+	for _, server := range m.Servers() {
+		fmt.Fprintf(&list, "addserver %s %d\n", server.Host, server.Port)
+	}
+	c.send("%s", list.String())
+}
+
+// ping checks that a game server's info port is actually reachable
+// before we list it.
+func ping(ctx context.Context, address Address) bool {
+	infoPort := Address{Host: address.Host, Port: address.Port + 1}
+	conn, err := net.Dial("udp", infoPort.String())
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	buffer := make([]byte, 512)
+	for i := 0; i < pingRetries; i++ {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		_, err = conn.Write([]byte{1})
+		if err != nil {
+			return false
+		}
+
+		conn.SetReadDeadline(time.Now().Add(pingTimeout))
+		_, err = conn.Read(buffer)
+		if err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Master) register(ctx context.Context, c *client, port int) {
+	address := Address{Host: c.host, Port: port}
+
+	if !ping(ctx, address) {
+		c.send("failreg failed pinging server\n")
+		return
+	}
+
+	m.mutex.Lock()
+	_, existing := m.servers[address]
+	m.servers[address] = &registration{
+		address: address,
+		updated: time.Now(),
+	}
+	m.mutex.Unlock()
+
+	if !existing {
+		log.Info().Str("server", address.String()).Msg("master: registered server")
+	}
+
+	c.send("succreg\n")
+}
+
+// purgeAuths fails all of the auth requests that have not been answered
+// in time.
+func (m *Master) purgeAuths(c *client) {
+	now := time.Now()
+	for id, auth := range c.auths {
+		if now.Sub(auth.created) < authTimeout {
+			continue
+		}
+		c.send("failauth %d\n", id)
+		delete(c.auths, id)
+	}
+}
+
+func (m *Master) requestAuth(c *client, id uint32, name string) {
+	key, ok := m.users[name]
+	if !ok || len(c.auths) >= authLimit {
+		c.send("failauth %d\n", id)
+		return
+	}
+
+	seed := make([]byte, 24)
+	_, err := rand.Read(seed)
+	if err != nil {
+		log.Error().Err(err).Msg("master failed to generate auth challenge")
+		c.send("failauth %d\n", id)
+		return
+	}
+
+	log.Info().
+		Str("host", c.host).
+		Str("name", name).
+		Uint32("id", id).
+		Msg("master: attempting auth")
+
+	challenge := crypto.GenerateChallenge(key, seed)
+	c.auths[id] = pendingAuth{
+		challenge: challenge,
+		created:   time.Now(),
+	}
+
+	c.send("chalauth %d %s\n", id, challenge.Text)
+}
+
+func (m *Master) confirmAuth(c *client, id uint32, answer string) {
+	auth, ok := c.auths[id]
+	if !ok {
+		c.send("failauth %d\n", id)
+		return
+	}
+	delete(c.auths, id)
+
+	if !auth.challenge.Check(answer) {
+		c.send("failauth %d\n", id)
+		return
+	}
+
+	c.send("succauth %d\n", id)
+}
@@ -0,0 +1,102 @@
+package master
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cfoust/sour/pkg/game/crypto"
+
+	"github.com/stretchr/testify/require"
+)
+
+func startMaster(t *testing.T, users map[string]*crypto.PublicKey) *Master {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	master := New(users)
+	require.NoError(t, master.Listen("127.0.0.1:0"))
+	go master.Serve(ctx)
+	return master
+}
+
+func dial(t *testing.T, master *Master) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", master.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func readLine(t *testing.T, reader *bufio.Reader) string {
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	return strings.TrimSpace(line)
+}
+
+func TestRegister(t *testing.T) {
+	pingTimeout = 100 * time.Millisecond
+	master := startMaster(t, nil)
+
+	// Stand in for a game server's info port
+	info, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer info.Close()
+	go func() {
+		buffer := make([]byte, 16)
+		for {
+			n, addr, err := info.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			info.WriteTo(buffer[:n], addr)
+		}
+	}()
+	port := info.LocalAddr().(*net.UDPAddr).Port - 1
+
+	conn, reader := dial(t, master)
+	fmt.Fprintf(conn, "regserv %d\n", port)
+	require.Equal(t, "succreg", readLine(t, reader))
+
+	// Nothing is listening on the port after this one
+	fmt.Fprintf(conn, "regserv %d\n", port+1)
+	require.Equal(t, "failreg invalid port", readLine(t, reader))
+
+	conn, reader = dial(t, master)
+	fmt.Fprintf(conn, "list\n")
+	require.Equal(t, fmt.Sprintf("addserver 127.0.0.1 %d", port), readLine(t, reader))
+
+	conn, reader = dial(t, master)
+	fmt.Fprintf(conn, "regserv %d\n", port+1)
+	require.Equal(t, "failreg failed pinging server", readLine(t, reader))
+}
+
+func TestAuth(t *testing.T) {
+	private, public := crypto.GenerateKeyPair("password")
+	key, err := crypto.ParsePublicKey(public)
+	require.NoError(t, err)
+
+	master := startMaster(t, map[string]*crypto.PublicKey{"player": key})
+	conn, reader := dial(t, master)
+
+	fmt.Fprintf(conn, "reqauth 1 nobody\n")
+	require.Equal(t, "failauth 1", readLine(t, reader))
+
+	fmt.Fprintf(conn, "reqauth 2 player\n")
+	line := readLine(t, reader)
+	require.True(t, strings.HasPrefix(line, "chalauth 2 "), line)
+
+	answer, err := crypto.AnswerChallenge(private, strings.TrimPrefix(line, "chalauth 2 "))
+	require.NoError(t, err)
+	fmt.Fprintf(conn, "confauth 2 %s\n", answer)
+	require.Equal(t, "succauth 2", readLine(t, reader))
+
+	fmt.Fprintf(conn, "reqauth 3 player\n")
+	readLine(t, reader)
+	fmt.Fprintf(conn, "confauth 3 1234\n")
+	require.Equal(t, "failauth 3", readLine(t, reader))
+}
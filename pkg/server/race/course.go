@@ -0,0 +1,230 @@
+package race
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	C "github.com/cfoust/sour/pkg/game/constants"
+	"github.com/cfoust/sour/pkg/maps"
+)
+
+// Race courses are marked with playerstarts whose team (attr2) is outside
+// of the range the game uses for spawning, so they never affect where
+// players spawn:
+//
+//	attr2 = 100      the start
+//	attr2 = 101..199 checkpoints, which must be passed in order
+//	attr2 = 200      the finish
+//
+// attr3, if set, is the radius of the marker.
+const (
+	TagStart           = 100
+	TagFirstCheckpoint = 101
+	TagLastCheckpoint  = 199
+	TagFinish          = 200
+
+	DefaultRadius = 32
+	// Positions are at eye level, markers are usually on the ground
+	eyeHeight = 14
+)
+
+type Vector struct {
+	X, Y, Z float64
+}
+
+type Marker struct {
+	Position Vector
+	Radius   float64
+}
+
+// Contains reports whether a player at the given position is touching the
+// marker.
+func (m Marker) Contains(position Vector) bool {
+	dx := position.X - m.Position.X
+	dy := position.Y - m.Position.Y
+	if math.Sqrt(dx*dx+dy*dy) > m.Radius {
+		return false
+	}
+
+	return math.Abs(position.Z-m.Position.Z) <= m.Radius+eyeHeight
+}
+
+type Course struct {
+	Start       Marker
+	Checkpoints []Marker
+	Finish      Marker
+}
+
+// NewCourse finds the race course in a map's entities.
+func NewCourse(entities []maps.Entity) (*Course, error) {
+	var start, finish *Marker
+	checkpoints := make(map[int16]Marker)
+
+	for _, entity := range entities {
+		if entity.Type != C.EntityTypePlayerStart {
+			continue
+		}
+
+		radius := float64(entity.Attr3)
+		if radius <= 0 {
+			radius = DefaultRadius
+		}
+
+		marker := Marker{
+			Position: Vector{
+				X: float64(entity.Position.X),
+				Y: float64(entity.Position.Y),
+				Z: float64(entity.Position.Z),
+			},
+			Radius: radius,
+		}
+
+		tag := entity.Attr2
+		switch {
+		case tag == TagStart:
+			start = &marker
+		case tag == TagFinish:
+			finish = &marker
+		case tag >= TagFirstCheckpoint && tag <= TagLastCheckpoint:
+			checkpoints[tag] = marker
+		}
+	}
+
+	if start == nil {
+		return nil, fmt.Errorf("map has no race start (a playerstart with team %d)", TagStart)
+	}
+
+	if finish == nil {
+		return nil, fmt.Errorf("map has no race finish (a playerstart with team %d)", TagFinish)
+	}
+
+	tags := make([]int, 0, len(checkpoints))
+	for tag := range checkpoints {
+		tags = append(tags, int(tag))
+	}
+	sort.Ints(tags)
+
+	course := Course{
+		Start:       *start,
+		Finish:      *finish,
+		Checkpoints: make([]Marker, 0, len(tags)),
+	}
+	for _, tag := range tags {
+		course.Checkpoints = append(course.Checkpoints, checkpoints[int16(tag)])
+	}
+
+	return &course, nil
+}
+
+type EventType uint8
+
+const (
+	EventNone EventType = iota
+	// The player left the start
+	EventStarted
+	// The player passed a checkpoint, Checkpoint is its index
+	EventCheckpoint
+	EventFinished
+)
+
+type Event struct {
+	Type       EventType
+	Checkpoint int
+	// The time since the start
+	Time time.Duration
+}
+
+// Run is one player's progress through a course.
+type Run struct {
+	// Whether the player is standing in the start
+	atStart bool
+	running bool
+	started time.Time
+	// The index of the next checkpoint, or len(Checkpoints) if the player
+	// only has to finish
+	next   int
+	Splits []time.Duration
+}
+
+// Reset cancels the run, e.g. because the player died.
+func (r *Run) Reset() {
+	*r = Run{}
+}
+
+func (r *Run) Running() bool {
+	return r.running
+}
+
+// Update moves the player along the course.
+func (c *Course) Update(run *Run, position Vector, now time.Time) Event {
+	if c.Start.Contains(position) {
+		// Runs start when the player leaves the start, so standing in it
+		// resets the run
+		run.Reset()
+		run.atStart = true
+		return Event{}
+	}
+
+	if run.atStart {
+		run.atStart = false
+		run.running = true
+		run.started = now
+		return Event{Type: EventStarted}
+	}
+
+	if !run.running {
+		return Event{}
+	}
+
+	elapsed := now.Sub(run.started)
+
+	if run.next < len(c.Checkpoints) {
+		if !c.Checkpoints[run.next].Contains(position) {
+			return Event{}
+		}
+
+		run.Splits = append(run.Splits, elapsed)
+		run.next++
+		return Event{
+			Type:       EventCheckpoint,
+			Checkpoint: run.next - 1,
+			Time:       elapsed,
+		}
+	}
+
+	if !c.Finish.Contains(position) {
+		return Event{}
+	}
+
+	run.running = false
+	return Event{
+		Type: EventFinished,
+		Time: elapsed,
+	}
+}
+
+// FormatTime formats a race time like 1:02.345.
+func FormatTime(duration time.Duration) string {
+	millis := duration.Milliseconds()
+	minutes := millis / 60000
+	seconds := float64(millis%60000) / 1000
+
+	if minutes > 0 {
+		return fmt.Sprintf("%d:%06.3f", minutes, seconds)
+	}
+	return fmt.Sprintf("%.3f", seconds)
+}
+
+// FormatDelta formats the difference between a time and a reference time,
+// like +0.512 or -1.003.
+func FormatDelta(elapsed, reference time.Duration) string {
+	delta := elapsed - reference
+	sign := "+"
+	if delta < 0 {
+		sign = "-"
+		delta = -delta
+	}
+	return sign + FormatTime(delta)
+}
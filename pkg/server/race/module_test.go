@@ -0,0 +1,109 @@
+package race
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	C "github.com/cfoust/sour/pkg/game/constants"
+	"github.com/cfoust/sour/pkg/maps"
+
+	"github.com/stretchr/testify/require"
+)
+
+func marker(x float32, tag int16) maps.Entity {
+	return maps.Entity{
+		Type:     C.EntityTypePlayerStart,
+		Position: maps.Vector{X: x},
+		Attr2:    tag,
+	}
+}
+
+func TestNewCourse(t *testing.T) {
+	_, err := NewCourse([]maps.Entity{marker(0, TagStart)})
+	require.Error(t, err)
+
+	course, err := NewCourse([]maps.Entity{
+		marker(1000, TagFinish),
+		marker(600, TagFirstCheckpoint+5),
+		marker(0, TagStart),
+		// An ordinary spawn
+		marker(50, 0),
+		marker(300, TagFirstCheckpoint),
+	})
+	require.NoError(t, err)
+	require.Len(t, course.Checkpoints, 2)
+	require.Equal(t, 300.0, course.Checkpoints[0].Position.X)
+	require.Equal(t, 600.0, course.Checkpoints[1].Position.X)
+}
+
+func TestRun(t *testing.T) {
+	course, err := NewCourse([]maps.Entity{
+		marker(0, TagStart),
+		marker(300, TagFirstCheckpoint),
+		marker(1000, TagFinish),
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	run := Run{}
+	at := func(x float64, elapsed time.Duration) Event {
+		return course.Update(&run, Vector{X: x}, now.Add(elapsed))
+	}
+
+	// Nothing happens until the player has been in the start
+	require.Equal(t, EventNone, at(1000, 0).Type)
+
+	require.Equal(t, EventNone, at(0, 0).Type)
+	require.Equal(t, EventStarted, at(100, time.Second).Type)
+
+	// Skipping the checkpoint does not count
+	require.Equal(t, EventNone, at(1000, 2*time.Second).Type)
+
+	event := at(300, 3*time.Second)
+	require.Equal(t, EventCheckpoint, event.Type)
+	require.Equal(t, 0, event.Checkpoint)
+	require.Equal(t, 2*time.Second, event.Time)
+
+	event = at(1000, 5*time.Second)
+	require.Equal(t, EventFinished, event.Type)
+	require.Equal(t, 4*time.Second, event.Time)
+	require.Equal(t, []time.Duration{2 * time.Second}, run.Splits)
+	require.False(t, run.Running())
+}
+
+func TestRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "races.json")
+
+	records, err := NewRecords(path)
+	require.NoError(t, err)
+
+	result, err := records.Submit("parkour", Record{Identity: "alice@sour", Name: "alice", Time: 10 * time.Second})
+	require.NoError(t, err)
+	require.True(t, result.PersonalBest)
+	require.True(t, result.NewMapRecord)
+
+	result, err = records.Submit("parkour", Record{Identity: "bob@sour", Name: "bob", Time: 12 * time.Second})
+	require.NoError(t, err)
+	require.True(t, result.PersonalBest)
+	require.False(t, result.NewMapRecord)
+
+	// Slower than alice's best, under another name
+	result, err = records.Submit("parkour", Record{Identity: "Alice@sour", Name: "ally", Time: 11 * time.Second})
+	require.NoError(t, err)
+	require.False(t, result.PersonalBest)
+	require.Equal(t, 10*time.Second, result.Previous.Time)
+
+	loaded, err := NewRecords(path)
+	require.NoError(t, err)
+
+	top := loaded.Top("parkour", 5)
+	require.Len(t, top, 2)
+	require.Equal(t, "alice", top[0].Name)
+	require.Equal(t, "bob", top[1].Name)
+	require.Nil(t, loaded.Best("parkour", "carol@sour"))
+
+	// Taking someone's name is not enough to take their record
+	require.Nil(t, loaded.Best("parkour", "alice"))
+	require.Equal(t, 10*time.Second, loaded.Best("parkour", "alice@sour").Time)
+}
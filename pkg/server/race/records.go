@@ -0,0 +1,195 @@
+package race
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// Record is a player's best time on a map.
+type Record struct {
+	// The auth identity of the player, of the form name@domain. Names can
+	// be taken by anyone, so records belong to identities.
+	Identity string
+	// The name the player had when they set the record
+	Name   string
+	Time   time.Duration
+	Splits []time.Duration
+	Set    time.Time
+}
+
+// Result describes how a finished run compares to the existing records.
+type Result struct {
+	// The player's previous best, if any.
+	Previous *Record
+	// The map record before this run, if any.
+	MapRecord    *Record
+	PersonalBest bool
+	NewMapRecord bool
+}
+
+// Records holds the best times on every map and persists them to disk.
+type Records struct {
+	// If empty, records are only kept in memory.
+	path string
+	// map name -> lowercased identity -> record
+	maps  map[string]map[string]*Record
+	mutex deadlock.RWMutex
+}
+
+// NewRecords loads the records stored at path, creating an empty set if it
+// does not exist yet.
+func NewRecords(path string) (*Records, error) {
+	records := &Records{
+		path: path,
+		maps: make(map[string]map[string]*Record),
+	}
+
+	if path == "" {
+		return records, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := make(map[string][]*Record)
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse race records %s: %w", path, err)
+	}
+
+	for mapName, times := range file {
+		players := make(map[string]*Record)
+		for _, record := range times {
+			players[strings.ToLower(record.Identity)] = record
+		}
+		records.maps[mapName] = players
+	}
+
+	return records, nil
+}
+
+// save writes the records to disk. Must be called with the mutex held.
+func (r *Records) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	file := make(map[string][]*Record)
+	for mapName := range r.maps {
+		file[mapName] = r.top(mapName, 0)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp := r.path + ".tmp"
+	err = os.WriteFile(temp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp, r.path)
+}
+
+// top returns the n best times on a map, or all of them if n is zero. Must
+// be called with the mutex held.
+func (r *Records) top(mapName string, n int) []*Record {
+	players := r.maps[mapName]
+	times := make([]*Record, 0, len(players))
+	for _, record := range players {
+		times = append(times, record)
+	}
+
+	sort.SliceStable(times, func(i, j int) bool {
+		if times[i].Time == times[j].Time {
+			return times[i].Set.Before(times[j].Set)
+		}
+		return times[i].Time < times[j].Time
+	})
+
+	if n > 0 && len(times) > n {
+		times = times[:n]
+	}
+	return times
+}
+
+// Submit records a finished run, keeping it only if it is the player's
+// best time on the map.
+func (r *Records) Submit(mapName string, record Record) (Result, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if record.Set.IsZero() {
+		record.Set = time.Now()
+	}
+
+	result := Result{}
+
+	players, ok := r.maps[mapName]
+	if !ok {
+		players = make(map[string]*Record)
+		r.maps[mapName] = players
+	}
+
+	if best := r.top(mapName, 1); len(best) > 0 {
+		copied := *best[0]
+		result.MapRecord = &copied
+	}
+
+	key := strings.ToLower(record.Identity)
+	if previous, ok := players[key]; ok {
+		copied := *previous
+		result.Previous = &copied
+	}
+
+	if result.Previous != nil && result.Previous.Time <= record.Time {
+		return result, nil
+	}
+
+	result.PersonalBest = true
+	result.NewMapRecord = result.MapRecord == nil || record.Time < result.MapRecord.Time
+	players[key] = &record
+
+	return result, r.save()
+}
+
+// Best returns the best time of the player with the given identity on a
+// map, or nil if they have not finished it.
+func (r *Records) Best(mapName string, identity string) *Record {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	record, ok := r.maps[mapName][strings.ToLower(identity)]
+	if !ok {
+		return nil
+	}
+
+	copied := *record
+	return &copied
+}
+
+// Top returns the n best times on a map.
+func (r *Records) Top(mapName string, n int) []Record {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	times := make([]Record, 0)
+	for _, record := range r.top(mapName, n) {
+		times = append(times, *record)
+	}
+	return times
+}
@@ -2,10 +2,14 @@ package servers
 
 import (
 	_ "embed"
+	"sort"
 	"time"
 
 	P "github.com/cfoust/sour/pkg/game/protocol"
 	"github.com/cfoust/sour/pkg/gameserver"
+	"github.com/cfoust/sour/pkg/gameserver/game"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/mastermode"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/playerstate"
 	"github.com/cfoust/sour/pkg/maps"
 
 	"github.com/rs/zerolog"
@@ -21,6 +25,8 @@ type GameServer struct {
 	Alias string
 
 	Entities []maps.Entity
+	// The map Entities were read from
+	EntitiesMap string
 
 	// Whether this map was in our assets (ie can we send it to the client)
 	IsBuiltMap bool
@@ -76,13 +82,20 @@ func (server *GameServer) Shutdown() {
 }
 
 func (s *GameServer) GetServerInfo() *ServerInfo {
+	// Like Sauerbraten, we report the master mode here unless there's a
+	// password
+	passwordMode := s.MasterMode
+	if s.HasPassword() {
+		passwordMode = mastermode.Password
+	}
+
 	return &ServerInfo{
 		NumClients:   int32(s.NumClients()),
 		GamePaused:   s.Clock.Paused(),
 		GameMode:     int32(s.GameMode.ID()),
 		TimeLeft:     int32(s.Clock.TimeLeft() / time.Second),
-		MaxClients:   64,
-		PasswordMode: 0,
+		MaxClients:   int32(s.MaxClients),
+		PasswordMode: int32(passwordMode),
 		GameSpeed:    100,
 		Map:          s.Map,
 		Description:  s.Description,
@@ -118,13 +131,64 @@ func (s *GameServer) GetClientInfo() []*ClientExtInfo {
 }
 
 func (s *GameServer) GetTeamInfo() *TeamInfo {
-	// TODO get team scores
-
-	return &TeamInfo{
-		IsDeathmatch: false,
+	info := &TeamInfo{
+		IsDeathmatch: true,
 		GameMode:     int(s.GameMode.ID()),
 		TimeLeft:     int(s.Clock.TimeLeft() / time.Second),
 	}
+
+	teamMode, ok := s.GameMode.(game.TeamMode)
+	if !ok {
+		return info
+	}
+	info.IsDeathmatch = false
+
+	// In flag and capture modes the team's score is what matters, not
+	// its frags
+	_, isFlagMode := s.GameMode.(game.FlagMode)
+	captureMode, isCaptureMode := s.GameMode.(game.CaptureMode)
+
+	// ForEachTeam holds the team mode's lock, since teams can change while
+	// we read them
+	info.Scores = make([]TeamScore, 0)
+	teamMode.ForEachTeam(func(team *game.Team) {
+		playing := false
+		for player := range team.Players {
+			if player.State != playerstate.Spectator {
+				playing = true
+				break
+			}
+		}
+
+		// Like Sauerbraten, only show teams that are actually in the game
+		if !playing && team.Score == 0 {
+			return
+		}
+
+		score := TeamScore{
+			Team:  team.Name,
+			Score: int(team.Frags),
+		}
+
+		if isFlagMode || isCaptureMode {
+			score.Score = int(team.Score)
+		}
+
+		if isCaptureMode {
+			score.Bases = make([]int, 0)
+			for _, base := range captureMode.Bases(team) {
+				score.Bases = append(score.Bases, int(base))
+			}
+		}
+
+		info.Scores = append(info.Scores, score)
+	})
+
+	sort.Slice(info.Scores, func(i, j int) bool {
+		return info.Scores[i].Team < info.Scores[j].Team
+	})
+
+	return info
 }
 
 func (s *GameServer) GetUptime() int {
@@ -16,6 +16,9 @@ import (
 	C "github.com/cfoust/sour/pkg/game/constants"
 	P "github.com/cfoust/sour/pkg/game/protocol"
 	"github.com/cfoust/sour/pkg/gameserver"
+	"github.com/cfoust/sour/pkg/gameserver/game"
+	"github.com/cfoust/sour/pkg/gameserver/geom"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/entity"
 	"github.com/cfoust/sour/pkg/maps"
 	"github.com/cfoust/sour/pkg/server/ingress"
 
@@ -49,6 +52,17 @@ type ClientKick struct {
 	Client ingress.ClientID
 	Reason int32
 	Text   string
+	// The server the client was removed from
+	Server  *GameServer
+	Violent bool
+}
+
+// A ClientAuth is sent when a client authenticates on one of the servers.
+type ClientAuth struct {
+	Client ingress.ClientID
+	// Of the form name@domain
+	Identity string
+	Server   *GameServer
 }
 
 type ClientLeave struct {
@@ -70,8 +84,10 @@ type ServerManager struct {
 	Maps    *assets.AssetFetcher
 
 	serverDescription string
+	auth              *gameserver.AuthDomains
 
 	kicks   chan ClientKick
+	auths   chan ClientAuth
 	packets chan ClientPacket
 }
 
@@ -83,6 +99,10 @@ func (manager *ServerManager) ReceiveKicks() <-chan ClientKick {
 	return manager.kicks
 }
 
+func (manager *ServerManager) ReceiveAuths() <-chan ClientAuth {
+	return manager.auths
+}
+
 func (manager *ServerManager) GetServerInfo() *ServerInfo {
 	info := ServerInfo{}
 
@@ -90,6 +110,7 @@ func (manager *ServerManager) GetServerInfo() *ServerInfo {
 	for _, server := range manager.Servers {
 		serverInfo := server.GetServerInfo()
 		info.NumClients += serverInfo.NumClients
+		info.MaxClients += serverInfo.MaxClients
 	}
 	manager.Mutex.Unlock()
 
@@ -100,13 +121,16 @@ func NewServerManager(
 	maps *assets.AssetFetcher,
 	serverDescription string,
 	presets []config.Preset,
+	auth *gameserver.AuthDomains,
 ) *ServerManager {
 	return &ServerManager{
 		Servers:           make([]*GameServer, 0),
 		Maps:              maps,
 		serverDescription: serverDescription,
 		presets:           presets,
+		auth:              auth,
 		kicks:             make(chan ClientKick, 100),
+		auths:             make(chan ClientAuth, 100),
 		packets:           make(chan ClientPacket, 100),
 	}
 }
@@ -178,7 +202,7 @@ func (manager *ServerManager) PruneServers(ctx context.Context) {
 	}
 }
 
-func (manager *ServerManager) ReadEntities(ctx context.Context, server *GameServer, data []byte) error {
+func (manager *ServerManager) ReadEntities(ctx context.Context, server *GameServer, mapName string, data []byte) error {
 	map_, err := maps.BasicsFromGZ(data)
 	if err != nil {
 		log.Error().Err(err).Msgf("could not read map entities")
@@ -187,7 +211,25 @@ func (manager *ServerManager) ReadEntities(ctx context.Context, server *GameServ
 
 	server.Mutex.Lock()
 	server.Entities = map_.Entities
+	server.EntitiesMap = mapName
 	server.Mutex.Unlock()
+
+	entities := make([]game.MapEntity, 0, len(map_.Entities))
+	for _, ent := range map_.Entities {
+		entities = append(entities, game.MapEntity{
+			Type: entity.ID(ent.Type),
+			Position: geom.NewVector(
+				float64(ent.Position.X),
+				float64(ent.Position.Y),
+				float64(ent.Position.Z),
+			),
+			Attr1: int32(ent.Attr1),
+			Attr2: int32(ent.Attr2),
+		})
+	}
+
+	// Game modes use these instead of trusting clients
+	server.SetEntities(mapName, entities)
 	return nil
 }
 
@@ -209,7 +251,7 @@ func (manager *ServerManager) PollMapRequests(ctx context.Context, server *GameS
 				continue
 			}
 
-			go manager.ReadEntities(ctx, server, data)
+			go manager.ReadEntities(ctx, server, request, data)
 		case <-ctx.Done():
 			return
 		}
@@ -250,6 +292,8 @@ func (manager *ServerManager) NewServer(ctx context.Context, presetName string,
 		To:   P.NewMessageProxy(true),
 	}
 
+	server.Auth = manager.auth
+
 	server.SetDescription(
 		strings.ReplaceAll(manager.serverDescription, "#id", server.Id),
 	)
@@ -274,6 +318,20 @@ func (manager *ServerManager) NewServer(ctx context.Context, presetName string,
 					Messages: packet.Messages,
 					Server:   &server,
 				}
+			case disconnect := <-server.ReceiveDisconnects():
+				manager.kicks <- ClientKick{
+					Client:  ingress.ClientID(disconnect.Session),
+					Reason:  int32(disconnect.Reason),
+					Text:    disconnect.Reason.String(),
+					Server:  &server,
+					Violent: disconnect.Violent,
+				}
+			case auth := <-server.ReceiveAuths():
+				manager.auths <- ClientAuth{
+					Client:   ingress.ClientID(auth.Session),
+					Identity: auth.Identity,
+					Server:   &server,
+				}
 			case <-server.Ctx().Done():
 				return
 			}
@@ -3,6 +3,8 @@ package servers
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -135,10 +137,13 @@ func DecodeServerUptime(p io.Packet) (*ServerUptime, error) {
 type TeamScore struct {
 	Team  string
 	Score int
+	// The indices of the bases this team owns in capture modes. Nil
+	// (rather than empty) if the mode has no bases.
 	Bases []int
 }
 
 type TeamInfo struct {
+	// False for team modes, which are the only ones with Scores
 	IsDeathmatch bool
 	GameMode     int
 	TimeLeft     int // seconds
@@ -177,7 +182,7 @@ func DecodeTeamInfo(p io.Packet) (*TeamInfo, error) {
 		}
 		if numBases == -1 {
 			scores = append(scores, score)
-			break
+			continue
 		}
 		bases := make([]int, 0)
 		for i := 0; i < int(numBases); i++ {
@@ -187,6 +192,7 @@ func DecodeTeamInfo(p io.Packet) (*TeamInfo, error) {
 			}
 			bases = append(bases, int(base))
 		}
+		score.Bases = bases
 		scores = append(scores, score)
 	}
 	info.Scores = scores
@@ -355,11 +361,13 @@ func (s *ServerInfoService) Handle(request *io.Packet, out chan []byte) error {
 					score.Score,
 				)
 
-				if len(score.Bases) == 0 {
+				if score.Bases == nil {
+					// No bases follow
 					response.Put(-1)
 					continue
 				}
 
+				response.Put(len(score.Bases))
 				for _, base := range score.Bases {
 					response.Put(base)
 				}
@@ -415,8 +423,20 @@ func (s *ServerInfoService) Handle(request *io.Packet, out chan []byte) error {
 	return nil
 }
 
-func (s *ServerInfoService) UpdateMaster(port int) error {
-	socket, err := enet.NewConnectSocket("master.sauerbraten.org", 28787)
+// UpdateMaster registers the game server on the given port with the master
+// server at the given address, e.g. "master.sauerbraten.org:28787".
+func (s *ServerInfoService) UpdateMaster(master string, port int) error {
+	host, masterPort, err := net.SplitHostPort(master)
+	if err != nil {
+		return fmt.Errorf("invalid master address: %w", err)
+	}
+
+	parsedPort, err := strconv.Atoi(masterPort)
+	if err != nil {
+		return fmt.Errorf("invalid master port: %w", err)
+	}
+
+	socket, err := enet.NewConnectSocket(host, parsedPort)
 
 	if err != nil {
 		return fmt.Errorf("error creating socket")
@@ -445,11 +465,11 @@ func (s *ServerInfoService) UpdateMaster(port int) error {
 	return fmt.Errorf("failed to register")
 }
 
-func (s *ServerInfoService) PollMaster(ctx context.Context, port int) {
+func (s *ServerInfoService) PollMaster(ctx context.Context, master string, port int) {
 	tick := time.NewTicker(1 * time.Hour)
 
 	for {
-		err := s.UpdateMaster(port)
+		err := s.UpdateMaster(master, port)
 		if err != nil {
 			log.Error().Err(err).Msg("failed to register with master")
 		}
@@ -463,16 +483,18 @@ func (s *ServerInfoService) PollMaster(ctx context.Context, port int) {
 	}
 }
 
-func (s *ServerInfoService) Serve(ctx context.Context, port int, registerMaster bool) error {
+// Serve responds to server info requests on the given port. If master is
+// not empty, the game server is also registered with that master server.
+func (s *ServerInfoService) Serve(ctx context.Context, port int, master string) error {
 	err := s.datagram.Serve(port)
 
 	if err != nil {
 		return err
 	}
 
-	if registerMaster {
+	if master != "" {
 		// You register a game server with master
-		go s.PollMaster(ctx, port-1)
+		go s.PollMaster(ctx, master, port-1)
 	}
 
 	events := s.datagram.Poll(ctx)
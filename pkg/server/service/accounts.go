@@ -0,0 +1,118 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cfoust/sour/pkg/server/accounts"
+)
+
+// GetAccount returns the account the user is logged into, if any.
+func (u *User) GetAccount() *accounts.Account {
+	u.Mutex.RLock()
+	defer u.Mutex.RUnlock()
+	return u.account
+}
+
+// accountIdentity picks the auth identity that the user's account is linked
+// to. Users who have not authenticated do not get an account.
+func (c *Cluster) accountIdentity(user *User) string {
+	auths := user.GetAuthentications()
+	if len(auths) == 0 {
+		return ""
+	}
+
+	// Users can authenticate with several domains at once, so be
+	// consistent about which one we use
+	sort.Strings(auths)
+	return auths[0]
+}
+
+// playerKey identifies a player across reconnects: by the identity their
+// account is linked to or, if they have not authenticated, by their name.
+func (c *Cluster) playerKey(user *User) string {
+	identity := c.accountIdentity(user)
+	if identity != "" {
+		return identity
+	}
+	return strings.ToLower(user.GetName())
+}
+
+// LoadAccount logs the user into the account linked to an identity they
+// just authenticated with. The first time, their stored ratings replace the
+// ones they started the session with. Users stay logged into their first
+// account for the rest of their session, so calling it again does nothing.
+func (c *Cluster) LoadAccount(user *User, identity string) {
+	if c.accounts == nil || identity == "" {
+		return
+	}
+
+	// Authenticating twice in a row must not log in twice
+	user.accountMutex.Lock()
+	defer user.accountMutex.Unlock()
+
+	if user.GetAccount() != nil {
+		return
+	}
+
+	logger := user.Logger()
+
+	name := c.identify(user).Name
+	account, err := c.accounts.Login(identity, name)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to load account")
+		return
+	}
+
+	user.Mutex.Lock()
+	user.account = account
+	user.Mutex.Unlock()
+
+	user.ELO.Mutex.Lock()
+	for _, rating := range account.Ratings {
+		user.ELO.Ratings[rating.DuelType] = &ELO{
+			Rating: rating.Rating,
+			Wins:   rating.Wins,
+			Draws:  rating.Draws,
+			Losses: rating.Losses,
+		}
+	}
+	user.ELO.Mutex.Unlock()
+
+	c.loadOffences(user, account)
+
+	logger.Info().
+		Str("account", account.Identity).
+		Msg("logged into account")
+}
+
+// SaveRating stores the user's rating in a type of duel, if they have an
+// account.
+func (c *Cluster) SaveRating(user *User, duelType string) {
+	account := user.GetAccount()
+	if c.accounts == nil || account == nil {
+		return
+	}
+
+	user.ELO.Mutex.Lock()
+	elo, ok := user.ELO.Ratings[duelType]
+	if !ok {
+		user.ELO.Mutex.Unlock()
+		return
+	}
+	rating := accounts.Rating{
+		AccountID: account.ID,
+		DuelType:  duelType,
+		Rating:    elo.Rating,
+		Wins:      elo.Wins,
+		Draws:     elo.Draws,
+		Losses:    elo.Losses,
+	}
+	user.ELO.Mutex.Unlock()
+
+	err := c.accounts.SaveRating(rating)
+	if err != nil {
+		logger := user.Logger()
+		logger.Warn().Err(err).Str("duel", duelType).Msg("failed to save rating")
+	}
+}
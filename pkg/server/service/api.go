@@ -9,7 +9,9 @@ import (
 )
 
 var (
-	DEMO_PATH_REGEX = regexp.MustCompile(`^/api/demo/([\w-]+)$`)
+	DEMO_PATH_REGEX        = regexp.MustCompile(`^/api/demo/([\w-]+)$`)
+	LEADERBOARD_PATH_REGEX = regexp.MustCompile(`^/api/leaderboard(?:/([\w-]+))?$`)
+	TOURNAMENT_PATH_REGEX  = regexp.MustCompile(`^/api/tournaments(?:/([\w-]+))?$`)
 )
 
 func (c *Cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -29,5 +31,17 @@ func (c *Cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	matches = LEADERBOARD_PATH_REGEX.FindStringSubmatch(r.URL.Path)
+	if len(matches) == 2 {
+		c.serveLeaderboard(w, matches[1])
+		return
+	}
+
+	matches = TOURNAMENT_PATH_REGEX.FindStringSubmatch(r.URL.Path)
+	if len(matches) == 2 {
+		c.serveTournaments(w, matches[1])
+		return
+	}
+
 	w.WriteHeader(400)
 }
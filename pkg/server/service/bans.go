@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/game/commands"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/disconnectreason"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/role"
+	"github.com/cfoust/sour/pkg/server/bans"
+)
+
+// GetAuthentications returns the identities the user has authenticated
+// with on their current server, each of the form name@domain.
+func (u *User) GetAuthentications() []string {
+	u.Mutex.RLock()
+	client := u.ServerClient
+	u.Mutex.RUnlock()
+
+	if client == nil {
+		return make([]string, 0)
+	}
+
+	return client.Identities()
+}
+
+// IsAdmin reports whether the user has admin privileges on their current
+// server.
+func (u *User) IsAdmin() bool {
+	u.Mutex.RLock()
+	client := u.ServerClient
+	u.Mutex.RUnlock()
+
+	return client != nil && client.Role >= role.Admin
+}
+
+func (c *Cluster) identify(user *User) bans.Identity {
+	name := user.GetName()
+
+	user.Mutex.RLock()
+	client := user.ServerClient
+	user.Mutex.RUnlock()
+
+	// The cluster only learns the user's name when they change it, but
+	// the game server knows it as soon as they connect
+	if client != nil && client.Name != "" {
+		name = client.Name
+	}
+
+	return bans.Identity{
+		Host: user.Connection.Host(),
+		Name: name,
+		Auth: user.GetAuthentications(),
+	}
+}
+
+func banMessage(entry *bans.Entry) string {
+	message := "you are banned from this server"
+	if entry.Reason != "" {
+		message += ": " + entry.Reason
+	}
+	return message
+}
+
+// EnforceBans disconnects the user if any ban matches them. Returns true if
+// the user was disconnected.
+func (c *Cluster) EnforceBans(user *User) bool {
+	entry := c.bans.Find(bans.ActionBan, c.identify(user))
+	if entry == nil {
+		return false
+	}
+
+	logger := user.Logger()
+	logger.Info().Int("ban", entry.ID).Msg("disconnecting banned user")
+
+	user.DisconnectFromServer()
+	user.Connection.Disconnect(
+		int(disconnectreason.IPBanned),
+		banMessage(entry),
+	)
+	user.Connection.Session().Cancel()
+	return true
+}
+
+// muteMessage explains why the user cannot chat, or returns an empty string
+// if they are not muted.
+func (c *Cluster) muteMessage(user *User) string {
+	entry := c.bans.Find(bans.ActionMute, c.identify(user))
+	if entry == nil {
+		return ""
+	}
+
+	message := fmt.Sprintf(
+		"you are muted (%s)",
+		entry.Remaining(time.Now()),
+	)
+	if entry.Reason != "" {
+		message += ": " + entry.Reason
+	}
+	return message
+}
+
+// IsMuted checks whether the user is muted, letting them know if they are.
+func (c *Cluster) IsMuted(user *User) bool {
+	message := c.muteMessage(user)
+	if message == "" {
+		return false
+	}
+
+	user.Message(game.Red(message))
+	return true
+}
+
+// parseBanTarget figures out what a ban should match. Targets may be
+// prefixed with their kind (ip:, auth:, or name:); otherwise IP addresses
+// and ranges are used as-is and anything else is looked up as the name of
+// an online player, whose host is banned.
+func (c *Cluster) parseBanTarget(target string) (bans.Kind, string, error) {
+	for _, kind := range []bans.Kind{
+		bans.KindIP,
+		bans.KindAuth,
+		bans.KindName,
+	} {
+		prefix := string(kind) + ":"
+		if strings.HasPrefix(target, prefix) {
+			return kind, strings.TrimPrefix(target, prefix), nil
+		}
+	}
+
+	if _, _, err := net.ParseCIDR(target); err == nil {
+		return bans.KindIP, target, nil
+	}
+	if net.ParseIP(target) != nil {
+		return bans.KindIP, target, nil
+	}
+
+	c.Users.Mutex.RLock()
+	defer c.Users.Mutex.RUnlock()
+	for _, user := range c.Users.Users {
+		if !strings.EqualFold(user.GetName(), target) {
+			continue
+		}
+
+		host := c.identify(user).Host
+		if withoutPort, _, err := net.SplitHostPort(host); err == nil {
+			host = withoutPort
+		}
+		return bans.KindIP, host, nil
+	}
+
+	return "", "", fmt.Errorf(
+		"no player named '%s' (use name:%s to match a name pattern)",
+		target,
+		target,
+	)
+}
+
+func (c *Cluster) addBan(user *User, action bans.Action, args []string) error {
+	if !user.IsAdmin() {
+		return fmt.Errorf("you must be an admin to do that")
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("you must provide a target")
+	}
+
+	kind, target, err := c.parseBanTarget(args[0])
+	if err != nil {
+		return err
+	}
+
+	// The duration is optional; anything else is the reason
+	var expires time.Time
+	rest := args[1:]
+	if len(rest) > 0 {
+		if duration, err := time.ParseDuration(rest[0]); err == nil {
+			if duration <= 0 {
+				return fmt.Errorf("duration must be positive")
+			}
+			expires = time.Now().Add(duration)
+			rest = rest[1:]
+		}
+	}
+
+	entry, err := c.bans.Add(bans.Entry{
+		Kind:    kind,
+		Action:  action,
+		Target:  target,
+		Reason:  strings.Join(rest, " "),
+		Author:  user.GetName(),
+		Expires: expires,
+	})
+	if err != nil {
+		return err
+	}
+
+	logger := user.Logger()
+	logger.Info().
+		Int("id", entry.ID).
+		Str("action", string(action)).
+		Str("target", target).
+		Msg("added ban entry")
+
+	user.Message(fmt.Sprintf("added %s", entry.String()))
+
+	// Apply the entry to everyone who is already online
+	c.Users.Mutex.RLock()
+	online := make([]*User, len(c.Users.Users))
+	copy(online, c.Users.Users)
+	c.Users.Mutex.RUnlock()
+
+	for _, other := range online {
+		if !entry.Matches(c.identify(other)) {
+			continue
+		}
+
+		switch action {
+		case bans.ActionBan:
+			c.EnforceBans(other)
+		case bans.ActionMute:
+			other.Message(game.Red("you have been muted"))
+		}
+	}
+
+	return nil
+}
+
+func (c *Cluster) banCommands() []commands.Command {
+	banCommand := commands.Command{
+		Name:        "ban",
+		ArgFormat:   "[player|ip|cidr|auth:name@domain|name:pattern] [duration] [reason]",
+		Description: "ban a player, address range, identity, or name from the server",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			return c.addBan(user, bans.ActionBan, args)
+		},
+	}
+
+	muteCommand := commands.Command{
+		Name:        "mute",
+		ArgFormat:   "[player|ip|cidr|auth:name@domain|name:pattern] [duration] [reason]",
+		Description: "prevent a player, address range, identity, or name from chatting",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			return c.addBan(user, bans.ActionMute, args)
+		},
+	}
+
+	unbanCommand := commands.Command{
+		Name:        "unban",
+		Aliases:     []string{"unmute"},
+		ArgFormat:   "[id]",
+		Description: "remove a ban or mute by its id (see #banlist)",
+		Callback: func(ctx context.Context, user *User, id string) error {
+			if !user.IsAdmin() {
+				return fmt.Errorf("you must be an admin to do that")
+			}
+
+			value, err := strconv.Atoi(strings.TrimPrefix(id, "#"))
+			if err != nil {
+				return fmt.Errorf("invalid id '%s'", id)
+			}
+
+			entry, err := c.bans.Remove(value)
+			if err != nil {
+				return err
+			}
+
+			user.Message(fmt.Sprintf("removed %s", entry.String()))
+			return nil
+		},
+	}
+
+	banListCommand := commands.Command{
+		Name:        "banlist",
+		Description: "list active bans and mutes",
+		Callback: func(ctx context.Context, user *User) error {
+			if !user.IsAdmin() {
+				return fmt.Errorf("you must be an admin to do that")
+			}
+
+			entries := c.bans.Entries()
+			if len(entries) == 0 {
+				user.Message("there are no bans or mutes")
+				return nil
+			}
+
+			for _, entry := range entries {
+				user.RawMessage(entry.String())
+			}
+			return nil
+		},
+	}
+
+	return []commands.Command{
+		banCommand,
+		muteCommand,
+		unbanCommand,
+		banListCommand,
+	}
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cfoust/sour/pkg/config"
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/game/commands"
+
+	"github.com/repeale/fp-go/option"
+	"github.com/rs/zerolog/log"
+)
+
+// How long a challenge waits to be accepted
+const CHALLENGE_TIMEOUT = time.Minute
+
+// How long both players have to ask for a rematch after a duel
+const REMATCH_WINDOW = 30 * time.Second
+
+// The period over which rated challenges between two players are limited
+const RATED_CHALLENGE_PERIOD = 24 * time.Hour
+
+type challenge struct {
+	From *User
+	To   *User
+	Type config.DuelType
+	Sent time.Time
+}
+
+type rematchOffer struct {
+	Opponent *User
+	Type     string
+	Expires  time.Time
+	// Whether the user has asked for the rematch
+	Wants bool
+}
+
+// pairKey identifies two players by their accounts, which both must have.
+func (c *Cluster) pairKey(a, b *User) string {
+	keys := []string{a.GetAccount().Identity, b.GetAccount().Identity}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
+
+// claimRatedChallenge reports whether a challenge between two players may
+// change their ratings, and counts it if so. Must be called with the
+// challenge mutex held.
+func (c *Cluster) claimRatedChallenge(a, b *User, now time.Time) bool {
+	key := c.pairKey(a, b)
+
+	recent := make([]time.Time, 0)
+	for _, played := range c.ratedPairs[key] {
+		if now.Sub(played) < RATED_CHALLENGE_PERIOD {
+			recent = append(recent, played)
+		}
+	}
+
+	if len(recent) >= int(c.settings.Matchmaking.RatedChallenges) {
+		c.ratedPairs[key] = recent
+		return false
+	}
+
+	c.ratedPairs[key] = append(recent, now)
+	return true
+}
+
+// pruneChallenges forgets challenges that were not answered in time. Must be
+// called with the challenge mutex held.
+func (c *Cluster) pruneChallenges(now time.Time) {
+	pending := make([]*challenge, 0)
+	for _, challenge := range c.challenges {
+		if now.Sub(challenge.Sent) > CHALLENGE_TIMEOUT {
+			continue
+		}
+		pending = append(pending, challenge)
+	}
+	c.challenges = pending
+}
+
+// startChallenge starts a duel that the players agreed to play. Must be
+// called with the challenge mutex held.
+func (c *Cluster) startChallenge(a, b *User, duelType config.DuelType) error {
+	for _, user := range []*User{a, b} {
+		if isPlayingMatch(user) {
+			return fmt.Errorf("%s is playing a match", user.GetName())
+		}
+	}
+
+	// They do not need to wait for anyone else now
+	for _, user := range []*User{a, b} {
+		c.matches.Dequeue(user)
+		c.teams.Dequeue(user)
+	}
+
+	// Players without accounts could get around the limit by changing
+	// their names
+	rated := false
+	if a.GetAccount() == nil || b.GetAccount() == nil {
+		message := "challenges are only rated when both players have authenticated, so this duel is unrated"
+		a.Message(message)
+		b.Message(message)
+	} else if rated = c.claimRatedChallenge(a, b, time.Now()); !rated {
+		message := fmt.Sprintf(
+			"you have played %d rated challenges against each other today, so this duel is unrated",
+			c.settings.Matchmaking.RatedChallenges,
+		)
+		a.Message(message)
+		b.Message(message)
+	}
+
+	log.Info().
+		Str("userA", a.Reference()).
+		Str("userB", b.Reference()).
+		Str("type", duelType.Name).
+		Bool("rated", rated).
+		Msg("starting challenge")
+
+	c.matches.StartDuel(c.serverCtx, a, b, duelType, !rated)
+	return nil
+}
+
+func (c *Cluster) sendChallenge(user *User, name string, typeName string) error {
+	target := c.Users.FindUserByName(name)
+	if target == nil {
+		return fmt.Errorf("could not find player '%s'", name)
+	}
+
+	if target == user {
+		return fmt.Errorf("you cannot challenge yourself")
+	}
+
+	duelType := c.matches.FindDuelType(typeName)
+	if opt.IsNone(duelType) {
+		return fmt.Errorf("duel type '%s' does not exist", typeName)
+	}
+
+	now := time.Now()
+
+	c.challengeMutex.Lock()
+	defer c.challengeMutex.Unlock()
+
+	c.pruneChallenges(now)
+
+	// Challenging someone who challenged you accepts it
+	for i, other := range c.challenges {
+		if other.From == target && other.To == user && other.Type.Name == duelType.Value.Name {
+			c.challenges = append(c.challenges[:i], c.challenges[i+1:]...)
+			return c.startChallenge(target, user, other.Type)
+		}
+	}
+
+	for _, other := range c.challenges {
+		if other.From == user && other.To == target {
+			return fmt.Errorf("you already challenged %s", target.GetName())
+		}
+	}
+
+	c.challenges = append(c.challenges, &challenge{
+		From: user,
+		To:   target,
+		Type: duelType.Value,
+		Sent: now,
+	})
+
+	user.Message(fmt.Sprintf(
+		"you challenged %s to a %s duel",
+		target.GetName(),
+		duelType.Value.Name,
+	))
+	target.Message(fmt.Sprintf(
+		"%s challenged you to a %s duel, %s or %s",
+		user.GetName(),
+		duelType.Value.Name,
+		game.Green("#accept"),
+		game.Red("#decline"),
+	))
+	return nil
+}
+
+// answerChallenge accepts or declines the latest challenge to the user, or
+// the one from the named player.
+func (c *Cluster) answerChallenge(user *User, name string, accept bool) error {
+	c.challengeMutex.Lock()
+	defer c.challengeMutex.Unlock()
+
+	c.pruneChallenges(time.Now())
+
+	index := -1
+	for i, other := range c.challenges {
+		if other.To != user {
+			continue
+		}
+
+		if name != "" && !strings.EqualFold(other.From.GetName(), name) {
+			continue
+		}
+
+		index = i
+	}
+
+	if index == -1 {
+		if name != "" {
+			return fmt.Errorf("%s has not challenged you", name)
+		}
+		return fmt.Errorf("no one has challenged you")
+	}
+
+	answered := c.challenges[index]
+	c.challenges = append(c.challenges[:index], c.challenges[index+1:]...)
+
+	if !accept {
+		user.Message(fmt.Sprintf("you declined %s's challenge", answered.From.GetName()))
+		answered.From.Message(fmt.Sprintf("%s declined your challenge", user.GetName()))
+		return nil
+	}
+
+	if answered.From.Ctx().Err() != nil {
+		return fmt.Errorf("%s is no longer here", answered.From.GetName())
+	}
+
+	return c.startChallenge(answered.From, user, answered.Type)
+}
+
+// offerRematch gives both players of a duel the chance to play again.
+func (c *Cluster) offerRematch(result DuelResult) {
+	if result.Winner == nil || result.Loser == nil {
+		return
+	}
+
+	expires := time.Now().Add(REMATCH_WINDOW)
+
+	c.challengeMutex.Lock()
+	c.rematches[result.Winner] = &rematchOffer{
+		Opponent: result.Loser,
+		Type:     result.Type,
+		Expires:  expires,
+	}
+	c.rematches[result.Loser] = &rematchOffer{
+		Opponent: result.Winner,
+		Type:     result.Type,
+		Expires:  expires,
+	}
+	c.challengeMutex.Unlock()
+
+	message := fmt.Sprintf(
+		"type %s within %d seconds to play again",
+		game.Blue("#rematch"),
+		int(REMATCH_WINDOW/time.Second),
+	)
+	result.Winner.Message(message)
+	result.Loser.Message(message)
+}
+
+func (c *Cluster) rematch(user *User) error {
+	c.challengeMutex.Lock()
+	defer c.challengeMutex.Unlock()
+
+	now := time.Now()
+	for other, offer := range c.rematches {
+		if now.After(offer.Expires) || other.Ctx().Err() != nil {
+			delete(c.rematches, other)
+		}
+	}
+
+	offer, ok := c.rematches[user]
+	if !ok {
+		return fmt.Errorf("you do not have a duel to rematch")
+	}
+	offer.Wants = true
+
+	opponent := offer.Opponent
+	other, ok := c.rematches[opponent]
+	if !ok || other.Opponent != user {
+		delete(c.rematches, user)
+		return fmt.Errorf("%s is no longer available for a rematch", opponent.GetName())
+	}
+
+	if !other.Wants {
+		user.Message(fmt.Sprintf("you asked %s for a rematch", opponent.GetName()))
+		opponent.Message(fmt.Sprintf(
+			"%s wants a rematch, type %s to accept",
+			user.GetName(),
+			game.Blue("#rematch"),
+		))
+		return nil
+	}
+
+	delete(c.rematches, user)
+	delete(c.rematches, opponent)
+
+	duelType := c.matches.FindDuelType(offer.Type)
+	if opt.IsNone(duelType) {
+		return fmt.Errorf("duel type '%s' does not exist", offer.Type)
+	}
+
+	return c.startChallenge(opponent, user, duelType.Value)
+}
+
+// announceUnrated tells the players of an unrated duel how it went.
+func (c *Cluster) announceUnrated(result DuelResult) {
+	if result.IsDraw {
+		message := "the duel ended in a draw"
+		result.Winner.Message(message)
+		result.Loser.Message(message)
+		return
+	}
+
+	result.Winner.Message(game.Green("you won! ") + "(unrated)")
+	result.Loser.Message(game.Red("you lost! ") + "(unrated)")
+}
+
+func (c *Cluster) challengeCommands() []commands.Command {
+	challengeCommand := commands.Command{
+		Name:        "challenge",
+		ArgFormat:   "[player] [type]",
+		Description: "challenge a player to a duel",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("you have to name the player you want to challenge")
+			}
+
+			typeName := ""
+			if len(args) > 1 {
+				typeName = args[1]
+			}
+
+			return c.sendChallenge(user, args[0], typeName)
+		},
+	}
+
+	acceptCommand := commands.Command{
+		Name:        "accept",
+		ArgFormat:   "[player]",
+		Description: "accept a challenge to a duel",
+		Callback: func(ctx context.Context, user *User, name string) error {
+			return c.answerChallenge(user, name, true)
+		},
+	}
+
+	declineCommand := commands.Command{
+		Name:        "decline",
+		ArgFormat:   "[player]",
+		Description: "decline a challenge to a duel",
+		Callback: func(ctx context.Context, user *User, name string) error {
+			return c.answerChallenge(user, name, false)
+		},
+	}
+
+	rematchCommand := commands.Command{
+		Name:        "rematch",
+		Description: "play your last duel's opponent again",
+		Callback: func(ctx context.Context, user *User) error {
+			return c.rematch(user)
+		},
+	}
+
+	return []commands.Command{
+		challengeCommand,
+		acceptCommand,
+		declineCommand,
+		rematchCommand,
+	}
+}
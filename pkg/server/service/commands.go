@@ -12,6 +12,7 @@ import (
 	"github.com/cfoust/sour/pkg/game/constants"
 	"github.com/cfoust/sour/pkg/server/ingress"
 	"github.com/cfoust/sour/pkg/gameserver/protocol/gamemode"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/role"
 	"github.com/cfoust/sour/pkg/server/servers"
 
 	"github.com/repeale/fp-go/option"
@@ -27,6 +28,10 @@ func (server *Cluster) GivePrivateMatchHelp(ctx context.Context, user *User, gam
 		message = fmt.Sprintf("This is your private server. Have other players join by saying '#join %s' in any Sour server or by sending the link in your URL bar. (We also copied it for you!)", gameServer.Id)
 	}
 
+	if gameServer.HasPassword() {
+		message += " They will also need the password."
+	}
+
 	sessionContext := user.ServerSessionContext()
 
 	for {
@@ -52,15 +57,27 @@ func (server *Cluster) GivePrivateMatchHelp(ctx context.Context, user *User, gam
 }
 
 type CreateParams struct {
-	Map    opt.Option[string]
-	Preset opt.Option[string]
-	Mode   opt.Option[int]
+	Map      opt.Option[string]
+	Preset   opt.Option[string]
+	Mode     opt.Option[int]
+	Password opt.Option[string]
 }
 
+const PASSWORD_PREFIX = "password:"
+
 func (server *Cluster) inferCreateParams(args []string) (*CreateParams, error) {
 	params := CreateParams{}
 
 	for _, arg := range args {
+		if strings.HasPrefix(arg, PASSWORD_PREFIX) {
+			password := strings.TrimPrefix(arg, PASSWORD_PREFIX)
+			if password == "" {
+				return nil, fmt.Errorf("password cannot be empty")
+			}
+			params.Password = opt.Some(password)
+			continue
+		}
+
 		mode := constants.GetModeNumber(arg)
 		if opt.IsSome(mode) {
 			params.Mode = mode
@@ -98,6 +115,7 @@ func (server *Cluster) CreateGame(ctx context.Context, params *CreateParams, use
 	existingServer, hasExistingServer := server.hostServers[user.Connection.Host()]
 	if hasExistingServer {
 		server.servers.RemoveServer(existingServer)
+		delete(server.serverOwners, existingServer)
 	}
 
 	logger.Info().Msg("starting server")
@@ -128,8 +146,42 @@ func (server *Cluster) CreateGame(ctx context.Context, params *CreateParams, use
 		gameServer.SetMap(params.Map.Value)
 	}
 
+	if opt.IsSome(params.Password) {
+		gameServer.SetPassword(params.Password.Value)
+		// The owner never needs the password
+		gameServer.AllowSession(user.Ctx(), uint32(user.Id))
+		user.Message(fmt.Sprintf(
+			"this game is protected by the password '%s'",
+			params.Password.Value,
+		))
+	}
+
 	server.lastCreate[user.Connection.Host()] = time.Now()
 	server.hostServers[user.Connection.Host()] = gameServer
+	server.serverOwners[gameServer] = user
+
+	// Forget the owner once they leave and the game once it shuts down.
+	// The host keeps the game until then, so it can still only have one.
+	go func(host string) {
+		select {
+		case <-gameServer.Ctx().Done():
+		case <-user.Ctx().Done():
+		}
+
+		server.createMutex.Lock()
+		if server.serverOwners[gameServer] == user {
+			delete(server.serverOwners, gameServer)
+		}
+		server.createMutex.Unlock()
+
+		<-gameServer.Ctx().Done()
+
+		server.createMutex.Lock()
+		if server.hostServers[host] == gameServer {
+			delete(server.hostServers, host)
+		}
+		server.createMutex.Unlock()
+	}(user.Connection.Host())
 
 	connected, err := user.ConnectToServer(gameServer, "", false, true)
 	go server.GivePrivateMatchHelp(server.serverCtx, user, user.Server)
@@ -153,6 +205,29 @@ func (server *Cluster) CreateGame(ctx context.Context, params *CreateParams, use
 	return nil
 }
 
+// IsServerOwner reports whether the user created the server in their
+// current session or has master privileges on it. Other clients can share
+// the owner's host, so that is not enough.
+func (server *Cluster) IsServerOwner(user *User, gameServer *servers.GameServer) bool {
+	server.createMutex.Lock()
+	owner, ok := server.serverOwners[gameServer]
+	server.createMutex.Unlock()
+
+	if ok && owner == user {
+		return true
+	}
+
+	if user.GetServer() != gameServer {
+		return false
+	}
+
+	user.Mutex.RLock()
+	client := user.ServerClient
+	user.Mutex.RUnlock()
+
+	return client != nil && client.Role >= role.Master
+}
+
 func (s *Cluster) runCommand(ctx context.Context, user *User, command string) error {
 	contexts := make([]commands.Commandable, 0)
 
@@ -232,25 +307,90 @@ func (s *Cluster) registerCommands() {
 	goCommand := commands.Command{
 		Name:        "go",
 		Aliases:     []string{"join"},
-		ArgFormat:   "[name|id|alias]",
+		ArgFormat:   "[name|id|alias] [password]",
 		Description: "move to a space, server, or map by name, id, or alias",
-		Callback: func(ctx context.Context, user *User, target string) error {
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("you must provide a target")
+			}
+
+			target := args[0]
+
+			// Spaces may be spread across several instances
+			if gameServer := s.spaces.FindShard(s.serverCtx, target, user.GetServer()); gameServer != nil {
+				return s.joinOrQueue(user, gameServer)
+			}
+
 			for _, gameServer := range s.servers.Servers {
 				if !gameServer.IsReference(target) {
 					continue
 				}
 
-				_, err := user.Connect(gameServer)
-				return err
+				// Matches can only be watched
+				if gameServer.Hidden {
+					return fmt.Errorf("use #spectate to watch a match")
+				}
+
+				if gameServer.HasPassword() && !s.IsServerOwner(user, gameServer) {
+					if len(args) < 2 {
+						return fmt.Errorf(
+							"this game is password protected, use #go %s [password]",
+							target,
+						)
+					}
+
+					if !gameServer.CheckPassword(args[1]) {
+						return fmt.Errorf("incorrect password")
+					}
+				}
+
+				if gameServer.HasPassword() {
+					gameServer.AllowSession(user.Ctx(), uint32(user.Id))
+				}
+				return s.joinOrQueue(user, gameServer)
 			}
 
 			return fmt.Errorf("could not find server '%s'", target)
 		},
 	}
 
+	passwordCommand := commands.Command{
+		Name:        "password",
+		ArgFormat:   "[password]",
+		Description: "set the password for your private game, or remove it if none is given",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			gameServer := user.GetServer()
+			if gameServer == nil {
+				return fmt.Errorf("you are not in a game")
+			}
+
+			if !s.IsServerOwner(user, gameServer) {
+				return fmt.Errorf("only the owner of a game can change its password")
+			}
+
+			if len(args) == 0 {
+				gameServer.SetPassword("")
+				gameServer.Message(fmt.Sprintf(
+					"%s removed the password",
+					user.GetFormattedName(),
+				))
+				return nil
+			}
+
+			password := strings.Join(args, " ")
+			gameServer.SetPassword(password)
+			gameServer.Message(fmt.Sprintf(
+				"%s set a password",
+				user.GetFormattedName(),
+			))
+			user.Message(fmt.Sprintf("the password is now '%s'", password))
+			return nil
+		},
+	}
+
 	createGameCommand := commands.Command{
 		Name:        "creategame",
-		ArgFormat:   "[coop|ffa|insta|ctf|..etc] [map]",
+		ArgFormat:   "[coop|ffa|insta|ctf|..etc] [map] [password:secret]",
 		Description: "create a private game for you and your friends",
 		Callback: func(ctx context.Context, user *User, args []string) error {
 			if len(args) == 0 {
@@ -272,7 +412,12 @@ func (s *Cluster) registerCommands() {
 		Aliases:     []string{"queue"},
 		Description: "queue for 1v1 matchmaking",
 		Callback: func(ctx context.Context, user *User, duelType string) error {
-			err := s.matches.Queue(user, duelType)
+			err := s.canQueue(user)
+			if err != nil {
+				return err
+			}
+
+			err = s.matches.Queue(user, duelType)
 			if err != nil {
 				// Theoretically, there might also just not be a default, but whatever.
 				return fmt.Errorf("duel type '%s' does not exist", duelType)
@@ -293,6 +438,7 @@ func (s *Cluster) registerCommands() {
 	err := s.commands.Register(
 		goCommand,
 		createGameCommand,
+		passwordCommand,
 		duelCommand,
 		stopDuelCommand,
 	)
@@ -300,6 +446,61 @@ func (s *Cluster) registerCommands() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to register cluster command")
 	}
+
+	err = s.commands.Register(s.banCommands()...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register ban commands")
+	}
+
+	err = s.commands.Register(s.floodCommands()...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register flood commands")
+	}
+
+	err = s.commands.Register(s.raceCommands()...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register race commands")
+	}
+
+	err = s.commands.Register(s.queueCommands()...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register queue commands")
+	}
+
+	err = s.commands.Register(s.leaderboardCommands()...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register leaderboard commands")
+	}
+
+	err = s.commands.Register(s.teamCommands()...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register team commands")
+	}
+
+	err = s.commands.Register(s.vetoCommands()...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register veto commands")
+	}
+
+	err = s.commands.Register(s.tournamentCommands()...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register tournament commands")
+	}
+
+	err = s.commands.Register(s.spectateCommands()...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register spectate commands")
+	}
+
+	err = s.commands.Register(s.challengeCommands()...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register challenge commands")
+	}
+
+	err = s.commands.Register(s.partyCommands()...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register party commands")
+	}
 }
 
 func (s *Cluster) HandleCommand(ctx context.Context, user *User, command string) {
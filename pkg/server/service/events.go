@@ -12,6 +12,7 @@ import (
 	"github.com/cfoust/sour/pkg/game/io"
 	P "github.com/cfoust/sour/pkg/game/protocol"
 	S "github.com/cfoust/sour/pkg/gameserver"
+	"github.com/cfoust/sour/pkg/ratelimit"
 	"github.com/cfoust/sour/pkg/server/ingress"
 	"github.com/cfoust/sour/pkg/server/servers"
 
@@ -64,6 +65,10 @@ func (c *Cluster) NotifyNameChange(ctx context.Context, user *User, name string)
 
 	user.SetName(ctx, name)
 
+	if c.EnforceBans(user) {
+		return
+	}
+
 	clientServer := user.GetServer()
 	serverName := user.GetServerName()
 	message := fmt.Sprintf("%s now known as %s [%s]", oldName, name, serverName)
@@ -90,6 +95,7 @@ func (c *Cluster) AnnounceInServer(ctx context.Context, server *servers.GameServ
 
 	serverUsers, ok := c.Users.Servers[server]
 	if !ok {
+		c.Users.Mutex.RUnlock()
 		return
 	}
 
@@ -177,6 +183,7 @@ func (c *Cluster) PollFromMessages(ctx context.Context, user *User) {
 	userCtx := user.Ctx()
 
 	chats := user.From.Intercept(P.N_TEXT)
+	teamChats := user.From.Intercept(P.N_SAYTEAM)
 	serverCommands := user.From.Intercept(P.N_SERVCMD)
 	blockConnecting := user.From.InterceptWith(func(code P.MessageCode) bool {
 		return !P.IsConnectingMessage(code)
@@ -185,6 +192,8 @@ func (c *Cluster) PollFromMessages(ctx context.Context, user *User) {
 	crcs := user.From.Intercept(P.N_MAPCRC)
 	votes := user.From.Intercept(P.N_MAPVOTE)
 	names := user.From.Intercept(P.N_SWITCHNAME)
+	sounds := user.From.Intercept(P.N_SOUND)
+	taunts := user.From.Intercept(P.N_TAUNT)
 
 	for {
 		logger := user.Logger()
@@ -194,6 +203,11 @@ func (c *Cluster) PollFromMessages(ctx context.Context, user *User) {
 			return
 
 		case msg := <-names.Receive():
+			if !c.CheckFlood(user, ratelimit.ClassName) {
+				msg.Drop()
+				continue
+			}
+
 			change := msg.Message.(P.SwitchName)
 			c.NotifyNameChange(ctx, user, change.Name)
 			msg.Pass()
@@ -243,6 +257,18 @@ func (c *Cluster) PollFromMessages(ctx context.Context, user *User) {
 					}
 				}()
 			}
+		case msg := <-sounds.Receive():
+			if !c.CheckFlood(user, ratelimit.ClassSound) {
+				msg.Drop()
+				continue
+			}
+			msg.Pass()
+		case msg := <-taunts.Receive():
+			if !c.CheckFlood(user, ratelimit.ClassTaunt) {
+				msg.Drop()
+				continue
+			}
+			msg.Pass()
 		case msg := <-teleports.Receive():
 			message := msg.Message
 			teleport := message.(P.Teleport)
@@ -267,12 +293,35 @@ func (c *Cluster) PollFromMessages(ctx context.Context, user *User) {
 			msg.Drop()
 
 			if !strings.HasPrefix(text, "#") {
+				if !c.CheckFlood(user, ratelimit.ClassChat) || c.IsMuted(user) {
+					continue
+				}
+
+				// Chat never reaches the game server, so tell it the
+				// user is not idle
+				user.Mutex.RLock()
+				client := user.ServerClient
+				user.Mutex.RUnlock()
+				if client != nil {
+					client.MarkActive()
+				}
+
 				// We do our own chat, don't pass on to the server
 				c.ForwardGlobalChat(userCtx, user, text)
 				continue
 			}
 
+			if !c.CheckFlood(user, ratelimit.ClassCommand) {
+				continue
+			}
+
 			go c.HandleCommand(ctx, user, text[1:])
+		case msg := <-teamChats.Receive():
+			if !c.CheckFlood(user, ratelimit.ClassChat) || c.IsMuted(user) {
+				msg.Drop()
+				continue
+			}
+			msg.Pass()
 		case msg := <-serverCommands.Receive():
 			message := msg.Message
 			text := message.(P.ServCMD).Command
@@ -284,6 +333,10 @@ func (c *Cluster) PollFromMessages(ctx context.Context, user *User) {
 				continue
 			}
 
+			if !c.CheckFlood(user, ratelimit.ClassCommand) {
+				continue
+			}
+
 			go c.HandleCommand(ctx, user, text)
 		}
 	}
@@ -356,7 +409,19 @@ func (c *Cluster) PollUser(ctx context.Context, user *User) {
 		case <-health:
 			continue
 
-		case <-connect:
+		case event := <-connect:
+			go c.watchServer(user, event.Server)
+			go c.followLeader(user, event.Server)
+
+			// Wherever they went, be it a match or another server, they
+			// are no longer waiting for a slot
+			if waiting := c.DequeueJoin(user); waiting != nil && waiting != event.Server {
+				user.Message(fmt.Sprintf(
+					"you are no longer waiting for %s",
+					waiting.Reference(),
+				))
+			}
+
 			user.Mutex.Lock()
 			if user.Server != nil {
 				instance := c.spaces.FindInstance(user.Server)
@@ -366,6 +431,11 @@ func (c *Cluster) PollUser(ctx context.Context, user *User) {
 			}
 			user.Mutex.Unlock()
 
+			// The user's name is now known
+			if c.EnforceBans(user) {
+				continue
+			}
+
 			logger := user.Logger()
 			logger.Info().Msg("connected to server")
 
@@ -411,6 +481,13 @@ func (c *Cluster) PollUser(ctx context.Context, user *User) {
 					continue
 				}
 
+				switch message := message.(type) {
+				case P.Pos:
+					c.HandleRacePosition(user, server, message)
+				case P.SpawnRequest, P.EditMode:
+					c.ResetRace(user)
+				}
+
 				newMessage, err := server.To.Process(
 					ctx,
 					msg.Channel,
@@ -551,6 +628,13 @@ func (c *Cluster) PollUser(ctx context.Context, user *User) {
 			outChannel := request.Response
 
 			go func() {
+				if !c.CheckFlood(user, ratelimit.ClassCommand) {
+					outChannel <- ingress.CommandResult{
+						Err: fmt.Errorf("you are sending commands too quickly"),
+					}
+					return
+				}
+
 				err := c.runCommandWithTimeout(ctx, user, command)
 				outChannel <- ingress.CommandResult{
 					Err: err,
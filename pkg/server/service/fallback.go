@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/disconnectreason"
+	"github.com/cfoust/sour/pkg/server/servers"
+)
+
+// describeKick explains to a user why they were removed from a server.
+func describeKick(server *servers.GameServer, reason disconnectreason.ID) string {
+	reference := server.GetFormattedReference()
+
+	switch reason {
+	case disconnectreason.Kick:
+		return fmt.Sprintf("you were kicked from %s", reference)
+	case disconnectreason.WrongPassword:
+		return fmt.Sprintf("incorrect password for %s", reference)
+	case disconnectreason.Full:
+		return fmt.Sprintf("you were idle on %s while it was full", reference)
+	case disconnectreason.PrivateMode:
+		return fmt.Sprintf("%s is private", reference)
+	}
+
+	return fmt.Sprintf("you were removed from %s (%s)", reference, reason)
+}
+
+// isFallbackServer reports whether the server is an instance of the
+// fallback space.
+func (c *Cluster) isFallbackServer(server *servers.GameServer) bool {
+	instance := c.spaces.FindInstance(server)
+	return instance != nil && instance.PresetSpace.Config.Alias == c.settings.FallbackSpace
+}
+
+// SendToFallback moves a user who was removed from a game for a harmless
+// reason to the fallback space, explaining why. If there is nowhere to send
+// them (or they were removed from the fallback space itself), they are
+// disconnected as before.
+func (c *Cluster) SendToFallback(user *User, from *servers.GameServer, reason disconnectreason.ID, text string) {
+	logger := user.Logger()
+
+	disconnect := func() {
+		user.DisconnectFromServer()
+		user.Connection.Disconnect(int(reason), text)
+	}
+
+	if c.settings.FallbackSpace == "" || (from != nil && c.isFallbackServer(from)) {
+		disconnect()
+		return
+	}
+
+	fallback := c.spaces.FindShard(c.serverCtx, c.settings.FallbackSpace, user.GetServer())
+	if fallback == nil || fallback == from {
+		disconnect()
+		return
+	}
+
+	// Every instance may be full, but going over the limit beats
+	// disconnecting them
+	user.DisconnectFromServer()
+	_, err := user.connectToServer(fallback, "", false, false)
+	if err != nil {
+		logger.Warn().Err(err).Msg("could not move user to the fallback space")
+		user.Connection.Disconnect(int(reason), text)
+		return
+	}
+
+	logger.Info().
+		Str("fallback", fallback.Reference()).
+		Msg("moved user to the fallback space")
+
+	user.Message(game.Yellow(fmt.Sprintf(
+		"%s, so you were moved to %s",
+		text,
+		fallback.Reference(),
+	)))
+}
+
+// watchServer moves the user to the fallback space if the server they are
+// on shuts down while they are still in it, e.g. when a private game is
+// closed.
+func (c *Cluster) watchServer(user *User, server *servers.GameServer) {
+	sessionCtx := user.ServerSessionContext()
+
+	select {
+	case <-sessionCtx.Done():
+		return
+	case <-server.Ctx().Done():
+	}
+
+	if user.GetServer() != server || user.Session.Ctx().Err() != nil {
+		return
+	}
+
+	c.SendToFallback(
+		user,
+		server,
+		disconnectreason.None,
+		fmt.Sprintf("%s was shut down", server.GetFormattedReference()),
+	)
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/game/commands"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/disconnectreason"
+	"github.com/cfoust/sour/pkg/ratelimit"
+	"github.com/cfoust/sour/pkg/server/bans"
+)
+
+// CheckFlood records a message of the given class from the user and
+// reports whether it should be let through. Users that keep going over
+// the limit are muted and eventually kicked.
+func (c *Cluster) CheckFlood(user *User, class ratelimit.Class) bool {
+	action := user.Flood.Check(class)
+	if action == ratelimit.Allow {
+		return true
+	}
+
+	logger := user.Logger()
+
+	switch action {
+	case ratelimit.Warn:
+		user.Message(game.Red("you are sending messages too quickly, slow down"))
+	case ratelimit.Mute:
+		host := user.Connection.Host()
+		if withoutPort, _, err := net.SplitHostPort(host); err == nil {
+			host = withoutPort
+		}
+
+		entry, err := c.bans.Add(bans.Entry{
+			Kind:    bans.KindIP,
+			Action:  bans.ActionMute,
+			Target:  host,
+			Reason:  "flooding",
+			Author:  "flood protection",
+			Expires: time.Now().Add(c.settings.Flood.MuteDuration()),
+		})
+		if err != nil {
+			logger.Warn().Err(err).Msg("failed to mute flooding user")
+			return false
+		}
+
+		logger.Info().Int("ban", entry.ID).Msg("muted user for flooding")
+		user.Message(game.Red(fmt.Sprintf(
+			"you have been muted for %s for flooding",
+			c.settings.Flood.MuteDuration(),
+		)))
+	case ratelimit.Kick:
+		logger.Info().Msg("kicking user for flooding")
+		user.DisconnectFromServer()
+		user.Connection.Disconnect(
+			int(disconnectreason.Kick),
+			"you were kicked for flooding",
+		)
+		user.Connection.Session().Cancel()
+	}
+
+	return false
+}
+
+func formatFloodCounts(counts map[ratelimit.Class]ratelimit.Counts) string {
+	parts := make([]string, 0)
+	for _, class := range ratelimit.Classes {
+		count, ok := counts[class]
+		if !ok {
+			continue
+		}
+
+		parts = append(parts, fmt.Sprintf(
+			"%s %d/%s",
+			class,
+			count.Allowed,
+			game.Red(fmt.Sprint(count.Dropped)),
+		))
+	}
+
+	if len(parts) == 0 {
+		return "nothing sent"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func (c *Cluster) floodCommands() []commands.Command {
+	floodCommand := commands.Command{
+		Name:        "flood",
+		ArgFormat:   "[player]",
+		Description: "show how many messages of each kind a player has sent and had dropped",
+		Callback: func(ctx context.Context, user *User, name string) error {
+			if !user.IsAdmin() {
+				return fmt.Errorf("you must be an admin to do that")
+			}
+
+			target := c.Users.FindUserByName(name)
+			if target == nil {
+				return fmt.Errorf("no player named '%s'", name)
+			}
+
+			user.Message(fmt.Sprintf(
+				"%s (%d strikes): %s",
+				target.GetFormattedName(),
+				target.Flood.Strikes(),
+				formatFloodCounts(target.Flood.Counts()),
+			))
+
+			return nil
+		},
+	}
+
+	return []commands.Command{
+		floodCommand,
+	}
+}
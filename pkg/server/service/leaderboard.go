@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/game/commands"
+	"github.com/cfoust/sour/pkg/server/accounts"
+
+	"github.com/repeale/fp-go/option"
+)
+
+// How many players #top and the leaderboard endpoint show
+const LEADERBOARD_SIZE = 10
+
+// leaderboardType resolves the duel type a leaderboard is for, falling back
+// to the default one.
+func (c *Cluster) leaderboardType(name string) (string, error) {
+	duelType := c.matches.FindDuelType(name)
+	if opt.IsNone(duelType) {
+		if name == "" {
+			return "", fmt.Errorf("there is no default duel type")
+		}
+		return "", fmt.Errorf("duel type '%s' does not exist", name)
+	}
+
+	return duelType.Value.Name, nil
+}
+
+func (c *Cluster) minGames() int {
+	return int(c.settings.Matchmaking.LeaderboardMinGames)
+}
+
+// Leaderboard returns the best players in a type of duel.
+func (c *Cluster) Leaderboard(duelType string) ([]accounts.Standing, error) {
+	if c.accounts == nil {
+		return nil, fmt.Errorf("ratings are not being stored")
+	}
+
+	return c.accounts.Leaderboard(duelType, c.minGames(), LEADERBOARD_SIZE)
+}
+
+func formatStanding(standing accounts.Standing) string {
+	return fmt.Sprintf(
+		"%d. %s %d (%s-%s-%s)",
+		standing.Rank,
+		standing.Name,
+		standing.Rating,
+		game.Green(fmt.Sprint(standing.Wins)),
+		game.Yellow(fmt.Sprint(standing.Draws)),
+		game.Red(fmt.Sprint(standing.Losses)),
+	)
+}
+
+func (c *Cluster) leaderboardCommands() []commands.Command {
+	topCommand := commands.Command{
+		Name:        "top",
+		ArgFormat:   "[type]",
+		Description: "show the best players in a type of duel",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+
+			duelType, err := c.leaderboardType(name)
+			if err != nil {
+				return err
+			}
+
+			standings, err := c.Leaderboard(duelType)
+			if err != nil {
+				return err
+			}
+
+			if len(standings) == 0 {
+				user.Message(fmt.Sprintf(
+					"no one has played %d %s duels yet",
+					c.minGames(),
+					duelType,
+				))
+				return nil
+			}
+
+			user.Message(fmt.Sprintf("best %s duelers:", duelType))
+			for _, standing := range standings {
+				user.Message(formatStanding(standing))
+			}
+			return nil
+		},
+	}
+
+	rankCommand := commands.Command{
+		Name:        "rank",
+		ArgFormat:   "[name]",
+		Description: "show where a player (or you) stands in each type of duel",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			if c.accounts == nil {
+				return fmt.Errorf("ratings are not being stored")
+			}
+
+			var name string
+			if len(args) > 0 {
+				name = args[0]
+			} else if account := user.GetAccount(); account != nil {
+				name = account.Identity
+			} else {
+				return fmt.Errorf("you need to authenticate to be ranked")
+			}
+
+			found := false
+			for _, duelType := range c.settings.Matchmaking.Duel {
+				standing, err := c.accounts.FindStanding(
+					duelType.Name,
+					c.minGames(),
+					name,
+				)
+				if err != nil {
+					return err
+				}
+
+				if standing == nil {
+					continue
+				}
+
+				found = true
+				user.Message(fmt.Sprintf(
+					"%s: %s",
+					duelType.Name,
+					formatStanding(*standing),
+				))
+			}
+
+			if !found {
+				user.Message(fmt.Sprintf(
+					"%s is not ranked (%d games are needed)",
+					name,
+					c.minGames(),
+				))
+			}
+			return nil
+		},
+	}
+
+	return []commands.Command{
+		topCommand,
+		rankCommand,
+	}
+}
+
+type leaderboardResponse struct {
+	Type      string              `json:"type"`
+	MinGames  int                 `json:"minGames"`
+	Standings []accounts.Standing `json:"standings"`
+}
+
+// serveLeaderboard responds with the leaderboard of a type of duel, or the
+// default one if name is empty.
+func (c *Cluster) serveLeaderboard(w http.ResponseWriter, name string) {
+	duelType, err := c.leaderboardType(name)
+	if err != nil {
+		w.WriteHeader(404)
+		return
+	}
+
+	standings, err := c.Leaderboard(duelType)
+	if err != nil {
+		w.WriteHeader(503)
+		return
+	}
+
+	data, err := json.Marshal(leaderboardResponse{
+		Type:      duelType,
+		MinGames:  c.minGames(),
+		Standings: standings,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+
+	header := w.Header()
+	header.Add("Content-Type", "application/json")
+	w.Write(data)
+}
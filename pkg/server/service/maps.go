@@ -7,6 +7,7 @@ import (
 
 	C "github.com/cfoust/sour/pkg/game/constants"
 	P "github.com/cfoust/sour/pkg/game/protocol"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/disconnectreason"
 )
 
 func (c *Cluster) waitForMapConsent(ctx context.Context, user *User) error {
@@ -23,7 +24,12 @@ func (c *Cluster) waitForMapConsent(ctx context.Context, user *User) error {
 	for {
 		select {
 		case <-timeout.Done():
-			go c.runCommand(ctx, user, "go lobby")
+			go c.SendToFallback(
+				user,
+				user.GetServer(),
+				disconnectreason.None,
+				"you did not allow the server to send you the map",
+			)
 			return fmt.Errorf("user never consented")
 		case <-serverCtx.Done():
 			return fmt.Errorf("user left the server")
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	P "github.com/cfoust/sour/pkg/game/protocol"
 	"github.com/cfoust/sour/pkg/mmr"
 	"github.com/cfoust/sour/pkg/config"
+	"github.com/cfoust/sour/pkg/server/accounts"
 	"github.com/cfoust/sour/pkg/server/ingress"
 	"github.com/cfoust/sour/pkg/server/servers"
 
@@ -27,12 +29,34 @@ const (
 	DuelPhaseDone
 )
 
+func (p DuelPhase) String() string {
+	switch p {
+	case DuelPhaseWarmup:
+		return "warmup"
+	case DuelPhaseBattle:
+		return "battle"
+	case DuelPhaseOvertime:
+		return "overtime"
+	case DuelPhaseDone:
+		return "done"
+	}
+	return "unknown"
+}
+
 type DuelResult struct {
 	Winner       *User
 	Loser        *User
 	Type         string
 	IsDraw       bool
 	Disconnected bool
+	// The games each player won, for series of more than one game
+	WinnerGames int
+	LoserGames  int
+	// The duel could not be played, e.g. because its server did not
+	// start. Winner and Loser are not set.
+	Aborted bool
+	// The players' ratings do not change
+	Unrated bool
 }
 
 type DuelDone struct {
@@ -44,6 +68,8 @@ type Duel struct {
 	Mutex sync.Mutex
 	Phase DuelPhase
 	Type  config.DuelType
+	// The result does not change either player's rating
+	Unrated bool
 
 	A *User
 	B *User
@@ -57,6 +83,14 @@ type Duel struct {
 	Manager  *servers.ServerManager
 	Finished chan DuelDone
 	server   *servers.GameServer
+
+	// The games each player has won in the series
+	winsA int
+	winsB int
+
+	// Set while the players choose the maps of the series
+	veto   *mapVeto
+	vetoed chan bool
 }
 
 func (d *Duel) Logger() zerolog.Logger {
@@ -79,6 +113,12 @@ func (d *Duel) broadcast(message string) {
 
 // Do a period of uninterrupted gameplay, like the warmup or main "struggle" sections.
 func (d *Duel) runPhase(ctx context.Context, numSeconds uint, title string) {
+	runPhase(ctx, d.server, d.broadcast, numSeconds, title)
+}
+
+// runPhase counts down a phase of a matchmade game on its server, announcing
+// the time remaining with broadcast.
+func runPhase(ctx context.Context, server *servers.GameServer, broadcast func(string), numSeconds uint, title string) {
 	tick := time.NewTicker(50 * time.Millisecond)
 
 	startTime := time.Now()
@@ -114,15 +154,15 @@ func (d *Duel) runPhase(ctx context.Context, numSeconds uint, title string) {
 		announceIndex = i
 	}
 
-	d.server.BroadcastTime(int(numSeconds))
-	d.server.SetDescription(fmt.Sprintf("Sour %s", title))
+	server.BroadcastTime(int(numSeconds))
+	server.SetDescription(fmt.Sprintf("Sour %s", title))
 
 	for {
 		select {
 		case <-tick.C:
 			remaining := uint(endTime.Sub(time.Now()).Round(time.Second) / time.Second)
 			if announceIndex < len(announceThresholds) && remaining <= announceThresholds[announceIndex] {
-				d.broadcast(fmt.Sprintf("%s %d seconds remaining", title, announceThresholds[announceIndex]))
+				broadcast(fmt.Sprintf("%s %d seconds remaining", title, announceThresholds[announceIndex]))
 				announceIndex++
 			}
 		case <-ctx.Done():
@@ -135,8 +175,18 @@ func (d *Duel) runPhase(ctx context.Context, numSeconds uint, title string) {
 }
 
 func (d *Duel) doCountdown(ctx context.Context, seconds int) {
-	logger := d.Logger()
+	countdown(ctx, d.broadcast, seconds)
+
+	if ctx.Err() != nil {
+		logger := d.Logger()
+		logger.Info().Msg("countdown context canceled")
+	}
+}
+
+// countdown announces each of the seconds before a phase starts.
+func countdown(ctx context.Context, broadcast func(string), seconds int) {
 	tick := time.NewTicker(1 * time.Second)
+	defer tick.Stop()
 	count := seconds
 
 	for {
@@ -145,10 +195,9 @@ func (d *Duel) doCountdown(ctx context.Context, seconds int) {
 			if count == 0 {
 				return
 			}
-			d.broadcast(fmt.Sprintf("%d", count))
+			broadcast(fmt.Sprintf("%d", count))
 			count--
 		case <-ctx.Done():
-			logger.Info().Msg("countdown context canceled")
 			return
 		}
 	}
@@ -188,6 +237,7 @@ func abs(x, y int32) int32 {
 }
 
 func (d *Duel) finish(result DuelResult) {
+	result.Unrated = d.Unrated
 	d.Finished <- DuelDone{
 		Duel:   d,
 		Result: result,
@@ -238,6 +288,11 @@ func (d *Duel) PollDeaths(ctx context.Context) {
 					killed = d.B
 				}
 
+				// Spectators are reset along with the players
+				if killed == nil {
+					continue
+				}
+
 				d.Respawn(ctx, killed)
 
 				d.Mutex.Lock()
@@ -310,8 +365,17 @@ func (d *Duel) Run(ctx context.Context) {
 	go func() {
 		<-matchContext.Done()
 
-		// Take the first result we get (one disconnect could trigger multiple)
-		result := <-matchResult
+		// Take the first result we get (one disconnect could trigger
+		// multiple). Duels that never got going have none.
+		result := DuelResult{
+			Type:    d.Type.Name,
+			Aborted: true,
+		}
+		select {
+		case result = <-matchResult:
+		default:
+		}
+
 		d.Cleanup()
 		d.finish(result)
 	}()
@@ -347,6 +411,7 @@ func (d *Duel) Run(ctx context.Context) {
 	}
 
 	gameServer.Hidden = true
+	gameServer.IdleExempt = true
 
 	d.server = gameServer
 
@@ -396,12 +461,23 @@ func (d *Duel) Run(ctx context.Context) {
 	d.server.Resume()
 	d.broadcast(fmt.Sprintf("Duel: You must win by at least %d frags. You are respawned automatically. Disconnecting counts as a loss.", d.Type.WinThreshold))
 
+	maps := d.chooseMaps(matchContext)
+	if matchContext.Err() != nil {
+		return
+	}
+
+	if len(maps) > 1 {
+		d.broadcast(fmt.Sprintf("Best of %d: %s", len(maps), game.Yellow(strings.Join(maps, ", "))))
+	}
+
+	if maps[0] != "" {
+		gameServer.SetMap(maps[0])
+	}
+
 	// Start with a warmup
 	d.broadcast(game.Blue("Warmup"))
 	d.broadcast("Leaving the match during the warmup does not count as a loss.")
 	d.runPhase(matchContext, d.Type.WarmupSeconds, game.Blue("Warmup"))
-	gameServer.ResetPlayers(true)
-	gameServer.ForceRespawn(nil)
 
 	if matchContext.Err() != nil {
 		return
@@ -409,22 +485,105 @@ func (d *Duel) Run(ctx context.Context) {
 
 	go d.PollDeaths(matchContext)
 
+	// The first player to win most of the games wins the series
+	needed := len(maps)/2 + 1
+	var winsA, winsB int
+	for i, map_ := range maps {
+		if i > 0 {
+			if map_ != "" {
+				gameServer.SetMap(map_)
+			}
+			d.broadcast(game.Blue(fmt.Sprintf("Game %d of %d", i+1, len(maps))))
+		}
+
+		scoreA, scoreB := d.playGame(matchContext)
+		if matchContext.Err() != nil {
+			return
+		}
+
+		d.Mutex.Lock()
+		if scoreA > scoreB {
+			d.winsA++
+		} else if scoreB > scoreA {
+			d.winsB++
+		}
+		winsA, winsB = d.winsA, d.winsB
+		d.Mutex.Unlock()
+
+		if len(maps) > 1 {
+			d.broadcast(fmt.Sprintf(
+				"Series: %s %d - %d %s",
+				d.A.Reference(),
+				winsA,
+				winsB,
+				d.B.Reference(),
+			))
+		}
+
+		if winsA >= needed || winsB >= needed {
+			break
+		}
+	}
+
+	d.setPhase(DuelPhaseDone)
+
+	logger.Info().Msgf("series ended %d:%d", winsA, winsB)
+
+	result := DuelResult{
+		Type:        d.Type.Name,
+		Winner:      d.A,
+		Loser:       d.B,
+		IsDraw:      false,
+		WinnerGames: winsA,
+		LoserGames:  winsB,
+	}
+
+	if len(maps) == 1 {
+		result.WinnerGames = 0
+		result.LoserGames = 0
+	}
+
+	if winsA == winsB {
+		result.IsDraw = true
+	} else if winsB > winsA {
+		result.Winner = d.B
+		result.Loser = d.A
+		result.WinnerGames, result.LoserGames = result.LoserGames, result.WinnerGames
+	}
+
+	matchResult <- result
+}
+
+// playGame plays one game of a series, with overtime until a player is
+// winning by enough frags, and returns the final score.
+func (d *Duel) playGame(ctx context.Context) (int32, int32) {
+	gameServer := d.server
+	logger := d.Logger()
+
+	gameServer.ResetPlayers(true)
+	gameServer.ForceRespawn(nil)
+
+	d.Mutex.Lock()
+	d.scoreA = 0
+	d.scoreB = 0
+	d.Mutex.Unlock()
+
 	d.setPhase(DuelPhaseBattle)
 
 	d.broadcast(game.Red("Get ready!"))
 	gameServer.Pause()
-	d.doCountdown(matchContext, 5)
+	d.doCountdown(ctx, 5)
 	gameServer.Resume()
 	d.broadcast(game.Green("GO!"))
 
-	if matchContext.Err() != nil {
-		return
+	if ctx.Err() != nil {
+		return 0, 0
 	}
 
-	d.runPhase(matchContext, d.Type.GameSeconds, game.Red("Duel"))
+	d.runPhase(ctx, d.Type.GameSeconds, game.Red("Duel"))
 
-	if matchContext.Err() != nil {
-		return
+	if ctx.Err() != nil {
+		return 0, 0
 	}
 
 	// You have to win by three points from where overtime started
@@ -444,38 +603,24 @@ func (d *Duel) Run(ctx context.Context) {
 		gameServer.ResetPlayers(false)
 
 		gameServer.Pause()
-		d.doCountdown(matchContext, 5)
+		d.doCountdown(ctx, 5)
 		gameServer.Resume()
 
 		d.broadcast(game.Red("GO!"))
-		d.runPhase(matchContext, d.Type.OvertimeSeconds, game.Red("Overtime"))
+		d.runPhase(ctx, d.Type.OvertimeSeconds, game.Red("Overtime"))
 
-		if matchContext.Err() != nil {
-			return
+		if ctx.Err() != nil {
+			return 0, 0
 		}
 	}
 
-	d.setPhase(DuelPhaseDone)
-
 	d.Mutex.Lock()
-	logger.Info().Msgf("match ended %d:%d", d.scoreA, d.scoreB)
+	scoreA := d.scoreA
+	scoreB := d.scoreB
 	d.Mutex.Unlock()
 
-	result := DuelResult{
-		Type:   d.Type.Name,
-		Winner: d.A,
-		Loser:  d.B,
-		IsDraw: false,
-	}
-
-	if d.scoreA == d.scoreB {
-		result.IsDraw = true
-	} else if d.scoreB > d.scoreA {
-		result.Winner = d.B
-		result.Loser = d.A
-	}
-
-	matchResult <- result
+	logger.Info().Msgf("match ended %d:%d", scoreA, scoreB)
+	return scoreA, scoreB
 }
 
 type DuelQueue struct {
@@ -500,7 +645,11 @@ type Matchmaker struct {
 	queueEvent chan bool
 	results    chan DuelResult
 	queues     chan DuelQueue
-	mutex      sync.Mutex
+	finished   chan DuelDone
+	// The last opponent of each user, so they are not matched again
+	// right away
+	lastOpponents map[*User]*User
+	mutex         sync.Mutex
 }
 
 func NewMatchmaker(manager *servers.ServerManager, duelTypes []config.DuelType) *Matchmaker {
@@ -511,7 +660,10 @@ func NewMatchmaker(manager *servers.ServerManager, duelTypes []config.DuelType)
 		queueEvent: make(chan bool, 0),
 		results:    make(chan DuelResult, 10),
 		queues:     make(chan DuelQueue, 10),
+		finished:   make(chan DuelDone),
 		manager:    manager,
+
+		lastOpponents: make(map[*User]*User),
 	}
 }
 
@@ -535,13 +687,26 @@ func (m *Matchmaker) FindDuelType(name string) opt.Option[config.DuelType] {
 
 // Inform the client regularly as to how long they've been in the queue.
 func (m *Matchmaker) NotifyProgress(queued *QueuedClient) {
-	tick := time.NewTicker(30 * time.Second)
+	interval := 30 * time.Second
+	duelType := m.FindDuelType(queued.Type)
+	if opt.IsSome(duelType) && duelType.Value.NotifySeconds > 0 {
+		interval = time.Duration(duelType.Value.NotifySeconds) * time.Second
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
 
 	for {
 		select {
-		case <-tick.C:
-			since := time.Now().Sub(queued.JoinTime).Round(time.Second)
-			queued.User.Message(fmt.Sprintf("you have been queued for %s for %s", queued.Type, since))
+		case now := <-tick.C:
+			since := now.Sub(queued.JoinTime).Round(time.Second)
+
+			queued.User.Message(fmt.Sprintf(
+				"you have been queued for %s for %s, looking for opponents rated %s",
+				queued.Type,
+				since,
+				m.SearchRange(queued, now),
+			))
 		case <-queued.Context.Done():
 			return
 		}
@@ -557,8 +722,9 @@ func (m *Matchmaker) Queue(user *User, typeName string) error {
 
 	m.mutex.Lock()
 	for _, queued := range m.queue {
-		if queued.User == user && queued.Type == typeName {
-			user.Message(fmt.Sprintf("you are already in the queue for %s", typeName))
+		if queued.User == user && queued.Type == duelType.Value.Name {
+			m.mutex.Unlock()
+			user.Message(fmt.Sprintf("you are already in the queue for %s", queued.Type))
 			return nil
 		}
 	}
@@ -577,7 +743,11 @@ func (m *Matchmaker) Queue(user *User, typeName string) error {
 	m.queue = append(m.queue, &queued)
 	m.mutex.Unlock()
 	log.Info().Str("user", user.Reference()).Str("type", queued.Type).Msg("queued for dueling")
-	user.Message(fmt.Sprintf("you are now in the queue for %s", queued.Type))
+	user.Message(fmt.Sprintf(
+		"you are now in the queue for %s, looking for opponents rated %s",
+		queued.Type,
+		m.SearchRange(&queued, queued.JoinTime),
+	))
 
 	m.queues <- DuelQueue{
 		User: user,
@@ -606,14 +776,18 @@ func (m *Matchmaker) Dequeue(user *User) {
 }
 
 func (m *Matchmaker) Poll(ctx context.Context) {
-	finished := make(chan DuelDone)
+	ticker := time.NewTicker(MATCH_INTERVAL)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case done := <-finished:
-			m.results <- done.Result
+		case done := <-m.finished:
+			if !done.Result.Aborted {
+				m.results <- done.Result
+			}
+
 			m.mutex.Lock()
 			duels := make([]*Duel, 0)
 			for _, duel := range m.duels {
@@ -625,80 +799,108 @@ func (m *Matchmaker) Poll(ctx context.Context) {
 			m.duels = duels
 			m.mutex.Unlock()
 		case <-m.queueEvent:
-			// Check to see if there are any matches we can arrange
-			m.mutex.Lock()
-
-			// First prune the list of any clients that are gone
-			cleaned := make([]*QueuedClient, 0)
-			for _, queued := range m.queue {
-				if queued.User.Connection.NetworkStatus() == ingress.NetworkStatusDisconnected {
-					logger := queued.User.Logger()
-					logger.Info().Msg("pruning disconnected client")
-					continue
-				}
-				cleaned = append(cleaned, queued)
-			}
-			m.queue = cleaned
-
-			// Then look to see if we can make any matches
-			matched := make(map[*User]bool, 0)
-			for _, queuedA := range m.queue {
-				// We may have already matched this queued
-				// note: can this actually occur?
-				if _, ok := matched[queuedA.User]; ok {
-					continue
-				}
+			m.match(ctx)
+		case <-ticker.C:
+			m.match(ctx)
+		}
+	}
+}
 
-				for _, queuedB := range m.queue {
-					// Same here
-					if _, ok := matched[queuedB.User]; ok {
-						continue
-					}
-					if queuedA.User == queuedB.User || queuedA.Type != queuedB.Type {
-						continue
-					}
+// match starts duels between the queued users that can play each other.
+func (m *Matchmaker) match(ctx context.Context) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 
-					queuedA.Cancel()
-					queuedB.Cancel()
+	// First prune the list of any clients that are gone
+	cleaned := make([]*QueuedClient, 0)
+	for _, queued := range m.queue {
+		if queued.User.Connection.NetworkStatus() == ingress.NetworkStatusDisconnected {
+			logger := queued.User.Logger()
+			logger.Info().Msg("pruning disconnected client")
+			continue
+		}
+		cleaned = append(cleaned, queued)
+	}
+	m.queue = cleaned
 
-					matched[queuedA.User] = true
-					matched[queuedB.User] = true
+	for user := range m.lastOpponents {
+		if user.Ctx().Err() != nil {
+			delete(m.lastOpponents, user)
+		}
+	}
 
-					duelType := m.FindDuelType(queuedA.Type)
+	// Then look to see if we can make any matches
+	matched := make(map[*User]bool, 0)
+	for _, match := range m.findMatches(time.Now()) {
+		queuedA, queuedB := match[0], match[1]
 
-					// This should never happen; we check on queueing
-					if opt.IsNone(duelType) {
-						continue
-					}
+		duelType := m.FindDuelType(queuedA.Type)
 
-					duel := Duel{
-						Type:     duelType.Value,
-						Phase:    DuelPhaseWarmup,
-						A:        queuedA.User,
-						B:        queuedB.User,
-						Manager:  m.manager,
-						Finished: finished,
-					}
-
-					m.duels = append(m.duels, &duel)
+		// This should never happen; we check on queueing
+		if opt.IsNone(duelType) {
+			continue
+		}
 
-					go duel.Run(ctx)
-				}
-			}
+		matched[queuedA.User] = true
+		matched[queuedB.User] = true
+		m.lastOpponents[queuedA.User] = queuedB.User
+		m.lastOpponents[queuedB.User] = queuedA.User
 
-			// Remove the matches we made from the queue
-			cleaned = make([]*QueuedClient, 0)
-			for _, queued := range m.queue {
-				if _, ok := matched[queued.User]; ok {
-					continue
-				}
-				cleaned = append(cleaned, queued)
-			}
-			m.queue = cleaned
+		m.startDuel(ctx, queuedA.User, queuedB.User, duelType.Value, false)
+	}
 
-			m.mutex.Unlock()
+	// Remove the matched users from every queue they were in
+	cleaned = make([]*QueuedClient, 0)
+	for _, queued := range m.queue {
+		if _, ok := matched[queued.User]; ok {
+			queued.Cancel()
+			continue
 		}
+		cleaned = append(cleaned, queued)
 	}
+	m.queue = cleaned
+}
+
+// NewDuel prepares a duel between two users that reports to finished once it
+// is over. The duel starts when it is run.
+func NewDuel(
+	manager *servers.ServerManager,
+	a, b *User,
+	duelType config.DuelType,
+	unrated bool,
+	finished chan DuelDone,
+) *Duel {
+	return &Duel{
+		Type:     duelType,
+		Phase:    DuelPhaseWarmup,
+		A:        a,
+		B:        b,
+		Unrated:  unrated,
+		Manager:  manager,
+		Finished: finished,
+		vetoed:   make(chan bool, 1),
+	}
+}
+
+// startDuel starts a duel between two users. Must be called with the mutex
+// held.
+func (m *Matchmaker) startDuel(ctx context.Context, a, b *User, duelType config.DuelType, unrated bool) *Duel {
+	duel := NewDuel(m.manager, a, b, duelType, unrated, m.finished)
+
+	m.duels = append(m.duels, duel)
+
+	go duel.Run(ctx)
+
+	return duel
+}
+
+// StartDuel starts a duel between two users without them having to queue,
+// e.g. when one challenges the other.
+func (m *Matchmaker) StartDuel(ctx context.Context, a, b *User, duelType config.DuelType, unrated bool) *Duel {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.startDuel(ctx, a, b, duelType, unrated)
 }
 
 func (server *Cluster) PollDuels(ctx context.Context) {
@@ -708,6 +910,13 @@ func (server *Cluster) PollDuels(ctx context.Context) {
 	for {
 		select {
 		case result := <-results:
+			server.offerRematch(result)
+
+			if result.Unrated {
+				server.announceUnrated(result)
+				continue
+			}
+
 			winner := result.Winner
 			loser := result.Loser
 
@@ -737,6 +946,17 @@ func (server *Cluster) PollDuels(ctx context.Context) {
 				loserELO.Losses++
 			}
 
+			if result.Disconnected {
+				kind := accounts.OffenceLeave
+				if result.IsDraw {
+					kind = accounts.OffenceDodge
+				}
+				server.penalize(loser, kind, result.Type, result.Type)
+			}
+
+			go server.SaveRating(winner, result.Type)
+			go server.SaveRating(loser, result.Type)
+
 			if result.IsDraw {
 				message := "the duel ended in a draw, your rating is unchanged"
 				winner.Message(message)
@@ -760,6 +980,10 @@ func (server *Cluster) PollDuels(ctx context.Context) {
 				result.Type,
 			)
 
+			if result.WinnerGames+result.LoserGames > 0 {
+				message += fmt.Sprintf(" (%d-%d)", result.WinnerGames, result.LoserGames)
+			}
+
 			if result.Disconnected {
 				message += " because they disconnected"
 			}
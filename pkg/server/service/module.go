@@ -11,7 +11,11 @@ import (
 	"github.com/cfoust/sour/pkg/game"
 	"github.com/cfoust/sour/pkg/game/commands"
 	P "github.com/cfoust/sour/pkg/game/protocol"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/disconnectreason"
+	"github.com/cfoust/sour/pkg/server/accounts"
+	"github.com/cfoust/sour/pkg/server/bans"
 	"github.com/cfoust/sour/pkg/server/ingress"
+	"github.com/cfoust/sour/pkg/server/race"
 	"github.com/cfoust/sour/pkg/server/servers"
 	"github.com/cfoust/sour/pkg/server/verse"
 
@@ -32,7 +36,10 @@ type Cluster struct {
 	lastCreate map[string]time.Time
 	// host -> the server created by that host
 	// each host can only have one server at once
-	hostServers   map[string]*servers.GameServer
+	hostServers map[string]*servers.GameServer
+	// server -> the user who created it, who owns it for as long as they
+	// stay connected
+	serverOwners  map[*servers.GameServer]*User
 	started       time.Time
 	authDomain    string
 	settings      config.ServerSettings
@@ -41,35 +48,77 @@ type Cluster struct {
 
 	commands *commands.CommandGroup[*User]
 
+	raceMutex sync.Mutex
+	races     map[*servers.GameServer]*raceState
+
+	joinMutex sync.Mutex
+	// Users waiting for a slot on a full server, in order
+	joinQueues map[*servers.GameServer][]*User
+
+	tourneyMutex sync.Mutex
+	tournaments  map[string]*Tournament
+
+	challengeMutex sync.Mutex
+	challenges     []*challenge
+	rematches      map[*User]*rematchOffer
+	// When each pair of players played rated challenges
+	ratedPairs map[string][]time.Time
+
+	offenceMutex sync.Mutex
+	// The games each player left or dodged, by account identity
+	offences map[string][]offence
+
 	// Services
-	Users   *UserOrchestrator
-	servers *servers.ServerManager
-	matches *Matchmaker
-	redis   *redis.Client
-	db      *gorm.DB
-	spaces  *verse.SpaceManager
-	assets  *assets.AssetFetcher
+	Users    *UserOrchestrator
+	servers  *servers.ServerManager
+	matches  *Matchmaker
+	teams    *TeamMatchmaker
+	bans     *bans.BanList
+	records  *race.Records
+	redis    *redis.Client
+	db       *gorm.DB
+	accounts *accounts.Store
+	spaces   *verse.SpaceManager
+	assets   *assets.AssetFetcher
 }
 
 func NewCluster(
 	ctx context.Context,
 	serverManager *servers.ServerManager,
 	maps *assets.AssetFetcher,
+	banList *bans.BanList,
+	raceRecords *race.Records,
+	db *gorm.DB,
 	settings config.ServerSettings,
 ) *Cluster {
 	server := &Cluster{
-		Users:         NewUserOrchestrator(settings.Matchmaking.Duel),
+		Users:         NewUserOrchestrator(settings.Matchmaking.Duel, settings.Flood),
 		serverCtx:     ctx,
 		settings:      settings,
 		hostServers:   make(map[string]*servers.GameServer),
+		serverOwners:  make(map[*servers.GameServer]*User),
 		commands:      commands.NewCommandGroup[*User]("general", game.ColorOrange),
 		lastCreate:    make(map[string]time.Time),
 		matches:       NewMatchmaker(serverManager, settings.Matchmaking.Duel),
+		teams:         NewTeamMatchmaker(serverManager, settings.Matchmaking.Team),
 		serverMessage: make(chan []byte, 1),
 		servers:       serverManager,
 		started:       time.Now(),
 		spaces:        verse.NewSpaceManager(serverManager, maps),
 		assets:        maps,
+		bans:          banList,
+		records:       raceRecords,
+		db:            db,
+		races:         make(map[*servers.GameServer]*raceState),
+		joinQueues:    make(map[*servers.GameServer][]*User),
+		tournaments:   make(map[string]*Tournament),
+		rematches:     make(map[*User]*rematchOffer),
+		ratedPairs:    make(map[string][]time.Time),
+		offences:      make(map[string][]offence),
+	}
+
+	if db != nil {
+		server.accounts = accounts.NewStore(db)
 	}
 
 	server.registerCommands()
@@ -83,7 +132,6 @@ func (server *Cluster) GetServerInfo() *servers.ServerInfo {
 	settings := server.settings.ServerInfo
 
 	info.TimeLeft = int32(settings.TimeLeft)
-	info.MaxClients = 999
 	info.GameSpeed = int32(settings.GameSpeed)
 	info.Map = settings.Map
 	info.Description = settings.Description
@@ -91,14 +139,24 @@ func (server *Cluster) GetServerInfo() *servers.ServerInfo {
 	return info
 }
 
-func (server *Cluster) GetTeamInfo() *servers.TeamInfo {
-	info := servers.TeamInfo{
-		IsDeathmatch: true,
-		GameMode:     0,
-		TimeLeft:     9999,
-		Scores:       make([]servers.TeamScore, 0),
-	}
-	return &info
+// InfoFor reports the cluster as a whole to server browsers. Team scores
+// only make sense for a single game, so those come from the target server.
+func (server *Cluster) InfoFor(target *servers.GameServer) servers.InfoProvider {
+	return &clusterInfo{Cluster: server, target: target}
+}
+
+type clusterInfo struct {
+	*Cluster
+	target *servers.GameServer
+}
+
+func (c *clusterInfo) GetTeamInfo() *servers.TeamInfo {
+	info := c.target.GetTeamInfo()
+
+	// Match what we report in GetServerInfo
+	info.TimeLeft = int(c.settings.ServerInfo.TimeLeft)
+
+	return info
 }
 
 // We need client information, so this is not on the ServerManager like GetServerInfo is
@@ -131,6 +189,7 @@ func (server *Cluster) PollServers(ctx context.Context) {
 	chanLock := chanlock.New()
 
 	forceDisconnects := server.servers.ReceiveKicks()
+	auths := server.servers.ReceiveAuths()
 	gamePackets := server.servers.ReceivePackets()
 
 	health := chanLock.Poll(ctx)
@@ -150,11 +209,43 @@ func (server *Cluster) PollServers(ctx context.Context) {
 			logger := user.Logger()
 			logger.Info().Msgf("user forcibly disconnected %d %s", event.Reason, event.Text)
 
-			user.DisconnectFromServer()
+			// Bans and flood kicks drop the connection, but there is no
+			// reason to make anyone else reconnect
+			if event.Violent || event.Reason == int32(disconnectreason.IPBanned) {
+				user.DisconnectFromServer()
+				user.Connection.Disconnect(int(event.Reason), event.Text)
+				continue
+			}
+
+			// They may have moved on already
+			if user.GetServer() != event.Server {
+				continue
+			}
+
+			reason := disconnectreason.ID(event.Reason)
+			go server.SendToFallback(
+				user,
+				event.Server,
+				reason,
+				describeKick(event.Server, reason),
+			)
+		case event := <-auths:
+			user := server.Users.FindUser(event.Client)
+			if user == nil || user.GetServer() != event.Server {
+				continue
+			}
+
+			logger := user.Logger()
+			logger.Info().Str("identity", event.Identity).Msg("user authenticated")
 
-			// TODO ideally we would move clients back to the lobby if they
-			// were not kicked for violent reasons
-			user.Connection.Disconnect(int(event.Reason), event.Text)
+			// Identity bans can only match now, and the user's
+			// account is linked to their identity
+			go func(user *User, identity string) {
+				if server.EnforceBans(user) {
+					return
+				}
+				server.LoadAccount(user, identity)
+			}(user, event.Identity)
 		case p := <-gamePackets:
 			messages := p.Messages
 			gameServer := p.Server
@@ -214,12 +305,34 @@ func (server *Cluster) StartServers(ctx context.Context) {
 	}
 	go server.servers.PruneServers(ctx)
 	go server.matches.Poll(ctx)
+	go server.teams.Poll(ctx)
+	go server.PollTournaments(ctx)
+	go server.PollJoinQueues(ctx)
+	go server.spaces.PollShards(ctx)
 }
 
 func (server *Cluster) PollUsers(ctx context.Context, newConnections chan ingress.Connection) {
 	for {
 		select {
 		case connection := <-newConnections:
+			// Turn away banned hosts before they take up a slot
+			entry := server.bans.Find(
+				bans.ActionBan,
+				bans.Identity{Host: connection.Host()},
+			)
+			if entry != nil {
+				log.Info().
+					Str("host", connection.Host()).
+					Int("ban", entry.ID).
+					Msg("rejected banned host")
+				connection.Disconnect(
+					int(disconnectreason.IPBanned),
+					banMessage(entry),
+				)
+				connection.Session().Cancel()
+				continue
+			}
+
 			user, err := server.Users.AddUser(ctx, connection)
 			if err != nil {
 				log.Error().Err(err).Msgf("failed to add user")
@@ -237,11 +350,11 @@ func (server *Cluster) Shutdown() {
 	server.servers.Shutdown()
 }
 
-// ForEachClusterServer enumerates running built-in servers (alias, map, mode, players, description)
-func (server *Cluster) ForEachClusterServer(cb func(alias, mapName string, mode, numClients int, desc string)) {
-    server.servers.Mutex.Lock()
-    for _, gs := range server.servers.Servers {
-        cb(gs.Reference(), gs.Map, int(gs.GameMode.ID()), gs.NumClients(), gs.Description)
-    }
-    server.servers.Mutex.Unlock()
+// ForEachClusterServer enumerates running built-in servers (alias, map, mode, players, max players, description)
+func (server *Cluster) ForEachClusterServer(cb func(alias, mapName string, mode, numClients, maxClients int, desc string)) {
+	server.servers.Mutex.Lock()
+	for _, gs := range server.servers.Servers {
+		cb(gs.Reference(), gs.Map, int(gs.GameMode.ID()), gs.NumClients(), gs.MaxClients, gs.Description)
+	}
+	server.servers.Mutex.Unlock()
 }
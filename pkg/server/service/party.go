@@ -0,0 +1,472 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/game/commands"
+	"github.com/cfoust/sour/pkg/ratelimit"
+	"github.com/cfoust/sour/pkg/server/ingress"
+	"github.com/cfoust/sour/pkg/server/servers"
+)
+
+// The most players a party can have, which is also the largest team
+const MAX_PARTY_SIZE = 4
+
+// How long an invite to a party can be accepted
+const PARTY_INVITE_TIMEOUT = 2 * time.Minute
+
+// A Party is a group of players who move between servers together. Wherever
+// the leader goes, the members follow.
+type Party struct {
+	Leader *User
+	// Everyone in the party, including the leader
+	Members []*User
+	// When each invited user was invited
+	invites map[*User]time.Time
+}
+
+// snapshot returns copies of the leader and members, which stay valid once
+// the party mutex is released. Must be called with the party mutex held.
+func (p *Party) snapshot() (*User, []*User) {
+	return p.Leader, append([]*User{}, p.Members...)
+}
+
+// pruneInvites forgets invites that were not accepted in time.
+func (p *Party) pruneInvites(now time.Time) {
+	for user, sent := range p.invites {
+		if now.Sub(sent) > PARTY_INVITE_TIMEOUT || user.Ctx().Err() != nil {
+			delete(p.invites, user)
+		}
+	}
+}
+
+func (p *Party) remove(user *User) {
+	members := make([]*User, 0)
+	for _, member := range p.Members {
+		if member == user {
+			continue
+		}
+		members = append(members, member)
+	}
+	p.Members = members
+
+	if p.Leader == user && len(members) > 0 {
+		p.Leader = members[0]
+	}
+}
+
+// sendParty tells the user's web client which party they are in.
+func sendParty(user *User, leader *User, members []*User) {
+	if user.Connection.Type() != ingress.ClientTypeWS {
+		return
+	}
+
+	ws, ok := user.Connection.(*ingress.WSClient)
+	if !ok {
+		return
+	}
+
+	leaderName := ""
+	if leader != nil {
+		leaderName = leader.GetName()
+	}
+
+	names := make([]string, 0)
+	for _, member := range members {
+		names = append(names, member.GetName())
+	}
+
+	ws.SendParty(leaderName, names)
+}
+
+// GetParty returns the leader and members of the user's party, or nil if
+// they are not in one.
+func (u *UserOrchestrator) GetParty(user *User) (*User, []*User) {
+	u.partyMutex.Lock()
+	defer u.partyMutex.Unlock()
+
+	party, ok := u.parties[user]
+	if !ok {
+		return nil, nil
+	}
+
+	return party.snapshot()
+}
+
+// InviteToParty invites the target to the user's party, starting one if the
+// user is not in a party yet.
+func (u *UserOrchestrator) InviteToParty(user *User, target *User) error {
+	if user == target {
+		return fmt.Errorf("you cannot invite yourself")
+	}
+
+	u.partyMutex.Lock()
+	defer u.partyMutex.Unlock()
+
+	party, inParty := u.parties[user]
+	if inParty && party.Leader != user {
+		return fmt.Errorf("only the party leader can invite players")
+	}
+
+	if other, ok := u.parties[target]; ok && len(other.Members) > 1 {
+		return fmt.Errorf("%s is already in a party", target.GetName())
+	}
+
+	if inParty && len(party.Members) >= MAX_PARTY_SIZE {
+		return fmt.Errorf("parties can have at most %d players", MAX_PARTY_SIZE)
+	}
+
+	// Only start a party once the invite is sure to go out
+	if !inParty {
+		party = &Party{
+			Leader:  user,
+			Members: []*User{user},
+			invites: make(map[*User]time.Time),
+		}
+		u.parties[user] = party
+	}
+
+	party.pruneInvites(time.Now())
+	party.invites[target] = time.Now()
+
+	user.Message(fmt.Sprintf("you invited %s to your party", target.GetName()))
+	target.Message(fmt.Sprintf(
+		"%s invited you to their party, join it with %s",
+		user.GetName(),
+		game.Green("#party accept"),
+	))
+	return nil
+}
+
+// AcceptPartyInvite puts the user in the party of the player who invited
+// them. If name is empty, the latest invite is accepted.
+func (u *UserOrchestrator) AcceptPartyInvite(user *User, name string) error {
+	u.partyMutex.Lock()
+
+	if party, ok := u.parties[user]; ok {
+		if len(party.Members) > 1 {
+			u.partyMutex.Unlock()
+			return fmt.Errorf("you are already in a party, leave it with #party leave first")
+		}
+
+		// Nobody accepted their own invites yet
+		delete(u.parties, user)
+	}
+
+	now := time.Now()
+	var invited *Party
+	var latest time.Time
+	for _, party := range u.parties {
+		party.pruneInvites(now)
+
+		sent, ok := party.invites[user]
+		if !ok {
+			continue
+		}
+
+		if name != "" && !strings.EqualFold(party.Leader.GetName(), name) {
+			continue
+		}
+
+		if invited == nil || sent.After(latest) {
+			invited = party
+			latest = sent
+		}
+	}
+
+	if invited == nil {
+		u.partyMutex.Unlock()
+		if name != "" {
+			return fmt.Errorf("%s has not invited you to a party", name)
+		}
+		return fmt.Errorf("no one has invited you to a party")
+	}
+
+	delete(invited.invites, user)
+
+	if len(invited.Members) >= MAX_PARTY_SIZE {
+		u.partyMutex.Unlock()
+		return fmt.Errorf("the party is full")
+	}
+
+	invited.Members = append(invited.Members, user)
+	u.parties[user] = invited
+	leader, members := invited.snapshot()
+	u.partyMutex.Unlock()
+
+	for _, member := range members {
+		if member == user {
+			member.Message(fmt.Sprintf("you joined %s's party", leader.GetName()))
+		} else {
+			member.Message(fmt.Sprintf("%s joined the party", user.GetName()))
+		}
+		sendParty(member, leader, members)
+	}
+
+	return nil
+}
+
+// removeFromParty takes the user out of their party. The party breaks up if
+// only one player is left.
+func (u *UserOrchestrator) removeFromParty(user *User, message string) {
+	u.partyMutex.Lock()
+	party, ok := u.parties[user]
+	if !ok {
+		u.partyMutex.Unlock()
+		return
+	}
+
+	delete(u.parties, user)
+	party.remove(user)
+
+	if len(party.Members) <= 1 {
+		for _, member := range party.Members {
+			delete(u.parties, member)
+		}
+	}
+
+	leader, members := party.snapshot()
+	u.partyMutex.Unlock()
+
+	sendParty(user, nil, nil)
+
+	if len(members) <= 1 {
+		for _, member := range members {
+			member.Message(fmt.Sprintf("%s, so the party broke up", message))
+			sendParty(member, nil, nil)
+		}
+		return
+	}
+
+	for _, member := range members {
+		member.Message(fmt.Sprintf("%s, %s leads the party", message, leader.GetName()))
+		sendParty(member, leader, members)
+	}
+}
+
+// LeaveParty takes the user out of their party, if they are in one.
+func (u *UserOrchestrator) LeaveParty(user *User) {
+	u.removeFromParty(user, fmt.Sprintf("%s left", user.GetName()))
+}
+
+// KickFromParty lets the leader of a party remove one of its members.
+func (u *UserOrchestrator) KickFromParty(user *User, name string) (*User, error) {
+	u.partyMutex.Lock()
+	party, ok := u.parties[user]
+	if !ok {
+		u.partyMutex.Unlock()
+		return nil, fmt.Errorf("you are not in a party")
+	}
+
+	if party.Leader != user {
+		u.partyMutex.Unlock()
+		return nil, fmt.Errorf("only the party leader can kick players")
+	}
+
+	var target *User
+	for _, member := range party.Members {
+		if member != user && strings.EqualFold(member.GetName(), name) {
+			target = member
+		}
+	}
+	u.partyMutex.Unlock()
+
+	if target == nil {
+		return nil, fmt.Errorf("%s is not in your party", name)
+	}
+
+	target.Message(fmt.Sprintf("%s kicked you from the party", user.GetName()))
+	u.removeFromParty(target, fmt.Sprintf("%s was kicked", target.GetName()))
+	return target, nil
+}
+
+// followLeader brings the members of the user's party to the server the
+// user just joined, if the user leads the party. Matches are only for the
+// players in them, so nobody follows the leader into one.
+func (c *Cluster) followLeader(user *User, server *servers.GameServer) {
+	if server.Hidden {
+		return
+	}
+
+	leader, members := c.Users.GetParty(user)
+	if leader != user {
+		return
+	}
+
+	for _, member := range members {
+		if member == leader || member.GetServer() == server {
+			continue
+		}
+
+		if isPlayingMatch(member) {
+			member.Message(fmt.Sprintf(
+				"%s went to %s, but you are playing a match",
+				leader.GetName(),
+				server.GetFormattedReference(),
+			))
+			continue
+		}
+
+		// The leader was let in, so their party is too
+		if server.HasPassword() {
+			server.AllowSession(member.Ctx(), uint32(member.Id))
+		}
+
+		member.Message(fmt.Sprintf(
+			"following %s to %s",
+			leader.GetName(),
+			server.GetFormattedReference(),
+		))
+
+		err := c.joinOrQueue(member, server)
+		if err != nil {
+			member.Message(game.Red(err.Error()))
+		}
+	}
+}
+
+// partyChat sends a message to every member of the user's party, wherever
+// they are.
+func (c *Cluster) partyChat(user *User, message string) error {
+	_, members := c.Users.GetParty(user)
+	if members == nil {
+		return fmt.Errorf("you are not in a party")
+	}
+
+	if message == "" {
+		return fmt.Errorf("you have to say something")
+	}
+
+	// Party chat is held to the same limits as normal chat, and
+	// CheckFlood already told the user if they hit them
+	if !c.CheckFlood(user, ratelimit.ClassChat) {
+		return nil
+	}
+
+	if muted := c.muteMessage(user); muted != "" {
+		return errors.New(muted)
+	}
+
+	formatted := fmt.Sprintf(
+		"%s %s: %s",
+		game.Magenta("[party]"),
+		user.GetFormattedName(),
+		game.Green(message),
+	)
+	for _, member := range members {
+		member.RawMessage(formatted)
+	}
+	return nil
+}
+
+func (c *Cluster) partyCommands() []commands.Command {
+	partyCommand := commands.Command{
+		Name:        "party",
+		ArgFormat:   "[invite|accept|leave|kick|list] [player]",
+		Description: "play with your friends, who follow you between servers",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			if len(args) == 0 {
+				args = []string{"list"}
+			}
+
+			name := ""
+			if len(args) > 1 {
+				name = args[1]
+			}
+
+			switch args[0] {
+			case "list":
+				leader, members := c.Users.GetParty(user)
+				if members == nil {
+					user.Message("you are not in a party, start one with #party invite [player]")
+					return nil
+				}
+
+				names := make([]string, 0)
+				for _, member := range members {
+					names = append(names, member.Reference())
+				}
+				user.Message(fmt.Sprintf(
+					"%s's party: %s",
+					leader.GetName(),
+					strings.Join(names, ", "),
+				))
+				return nil
+			case "invite":
+				if name == "" {
+					return fmt.Errorf("you have to name the player you want to invite")
+				}
+
+				target := c.Users.FindUserByName(name)
+				if target == nil {
+					return fmt.Errorf("could not find player '%s'", name)
+				}
+
+				err := c.Users.InviteToParty(user, target)
+				if err != nil {
+					return err
+				}
+
+				leader, members := c.Users.GetParty(user)
+				sendParty(user, leader, members)
+				return nil
+			case "accept":
+				err := c.Users.AcceptPartyInvite(user, name)
+				if err != nil {
+					return err
+				}
+
+				// The party has to queue again, together
+				leader, _ := c.Users.GetParty(user)
+				c.teams.Dequeue(user)
+				c.teams.Dequeue(leader)
+				return nil
+			case "leave":
+				_, members := c.Users.GetParty(user)
+				if members == nil {
+					return fmt.Errorf("you are not in a party")
+				}
+
+				// The rest of the party cannot play in their place
+				c.teams.Dequeue(user)
+				c.Users.LeaveParty(user)
+				user.Message("you left the party")
+				return nil
+			case "kick":
+				if name == "" {
+					return fmt.Errorf("you have to name the player you want to kick")
+				}
+
+				target, err := c.Users.KickFromParty(user, name)
+				if err != nil {
+					return err
+				}
+
+				c.teams.Dequeue(target)
+				return nil
+			}
+
+			return fmt.Errorf("unknown subcommand '%s'", args[0])
+		},
+	}
+
+	partyChatCommand := commands.Command{
+		Name:        "p",
+		Aliases:     []string{"pc"},
+		ArgFormat:   "[message]",
+		Description: "send a message to your party, wherever they are",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			return c.partyChat(user, strings.Join(args, " "))
+		},
+	}
+
+	return []commands.Command{
+		partyCommand,
+		partyChatCommand,
+	}
+}
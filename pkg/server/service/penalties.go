@@ -0,0 +1,203 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/server/accounts"
+)
+
+// An offence is a player leaving a matchmade game before it ended or
+// dodging it before it began.
+type offence struct {
+	Kind string
+	Time time.Time
+}
+
+func describeOffence(kind string) string {
+	if kind == accounts.OffenceDodge {
+		return "dodged"
+	}
+	return "left"
+}
+
+func (c *Cluster) offenceMemory() time.Duration {
+	return time.Duration(c.settings.Matchmaking.Penalties.MemoryHours) * time.Hour
+}
+
+// recentOffences forgets a player's offences that no longer count against
+// them and returns the rest. Must be called with the offence mutex held.
+func (c *Cluster) recentOffences(key string, now time.Time) []offence {
+	recent := make([]offence, 0)
+	for _, offence := range c.offences[key] {
+		if now.Sub(offence.Time) < c.offenceMemory() {
+			recent = append(recent, offence)
+		}
+	}
+
+	if len(recent) == 0 {
+		delete(c.offences, key)
+		return recent
+	}
+
+	c.offences[key] = recent
+	return recent
+}
+
+// cooldown returns how long a player with the given number of offences
+// cannot queue after their last one.
+func (c *Cluster) cooldown(numOffences int) time.Duration {
+	cooldowns := c.settings.Matchmaking.Penalties.CooldownSeconds
+	if numOffences == 0 || len(cooldowns) == 0 {
+		return 0
+	}
+
+	index := numOffences - 1
+	if index >= len(cooldowns) {
+		index = len(cooldowns) - 1
+	}
+	return time.Duration(cooldowns[index]) * time.Second
+}
+
+// canQueue explains why the user cannot enter a matchmaking queue right
+// now, if they cannot.
+func (c *Cluster) canQueue(user *User) error {
+	if isPlayingMatch(user) {
+		return fmt.Errorf("you cannot queue while you are playing a match")
+	}
+
+	account := user.GetAccount()
+	if account == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	c.offenceMutex.Lock()
+	recent := c.recentOffences(account.Identity, now)
+	c.offenceMutex.Unlock()
+
+	if len(recent) == 0 {
+		return nil
+	}
+
+	last := recent[len(recent)-1]
+	remaining := last.Time.Add(c.cooldown(len(recent))).Sub(now)
+	if remaining <= 0 {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"you %s a match %s ago and have left or dodged %d in the last %d hours, so you cannot queue for another %s",
+		describeOffence(last.Kind),
+		now.Sub(last.Time).Round(time.Second),
+		len(recent),
+		c.settings.Matchmaking.Penalties.MemoryHours,
+		remaining.Round(time.Second),
+	)
+}
+
+// penalize records an offence against the user and, if they keep
+// offending, lowers their rating, which is kept under ratingKey. The caller
+// is responsible for saving the rating. Offences follow accounts, so nothing is
+// recorded against players who have not authenticated.
+func (c *Cluster) penalize(user *User, kind string, matchType string, ratingKey string) {
+	account := user.GetAccount()
+	if account == nil {
+		return
+	}
+
+	settings := c.settings.Matchmaking.Penalties
+	key := account.Identity
+	now := time.Now()
+
+	c.offenceMutex.Lock()
+	recent := append(c.recentOffences(key, now), offence{
+		Kind: kind,
+		Time: now,
+	})
+	c.offences[key] = recent
+	c.offenceMutex.Unlock()
+
+	logger := user.Logger()
+	logger.Info().
+		Str("kind", kind).
+		Str("type", matchType).
+		Int("offences", len(recent)).
+		Msg("penalized player")
+
+	if c.accounts != nil {
+		go func() {
+			err := c.accounts.RecordOffence(account.ID, kind, now)
+			if err != nil {
+				logger.Warn().Err(err).Msg("failed to record offence")
+			}
+		}()
+	}
+
+	user.Message(game.Red(fmt.Sprintf(
+		"you %s the match, so you cannot queue for %s",
+		describeOffence(kind),
+		c.cooldown(len(recent)).Round(time.Second),
+	)))
+
+	if settings.RatingPenalty == 0 || uint(len(recent)) < settings.RatingPenaltyAfter {
+		return
+	}
+
+	user.ELO.Mutex.Lock()
+	elo, ok := user.ELO.Ratings[ratingKey]
+	if !ok {
+		elo = NewELO()
+		user.ELO.Ratings[ratingKey] = elo
+	}
+	if elo.Rating > settings.RatingPenalty {
+		elo.Rating -= settings.RatingPenalty
+	} else {
+		elo.Rating = 0
+	}
+	user.ELO.Mutex.Unlock()
+
+	user.Message(game.Red(fmt.Sprintf(
+		"you have left or dodged %d matches recently, so you also lose %d rating in %s",
+		len(recent),
+		settings.RatingPenalty,
+		matchType,
+	)))
+}
+
+// loadOffences picks up the offences a player committed in earlier
+// sessions once they log into their account.
+func (c *Cluster) loadOffences(user *User, account *accounts.Account) {
+	now := time.Now()
+	stored, err := c.accounts.Offences(account.ID, now.Add(-c.offenceMemory()))
+	if err != nil {
+		logger := user.Logger()
+		logger.Warn().Err(err).Msg("failed to load offences")
+		return
+	}
+
+	if len(stored) == 0 {
+		return
+	}
+
+	key := account.Identity
+
+	c.offenceMutex.Lock()
+	defer c.offenceMutex.Unlock()
+
+	// Offences from this session were already stored
+	if len(c.recentOffences(key, now)) > 0 {
+		return
+	}
+
+	offences := make([]offence, 0)
+	for _, stored := range stored {
+		offences = append(offences, offence{
+			Kind: stored.Kind,
+			Time: stored.CreatedAt,
+		})
+	}
+	c.offences[key] = offences
+}
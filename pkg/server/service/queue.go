@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/game/commands"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/disconnectreason"
+	"github.com/cfoust/sour/pkg/server/ingress"
+	"github.com/cfoust/sour/pkg/server/servers"
+)
+
+// How often we check whether a slot has opened up on a full server
+const JOIN_QUEUE_INTERVAL = time.Second
+
+var ErrServerFull = errors.New("server is full")
+
+// EnqueueJoin puts the user at the back of the queue for a full server,
+// removing them from any other queue they were in. Returns their position
+// in the queue, starting at one.
+func (c *Cluster) EnqueueJoin(user *User, server *servers.GameServer) int {
+	c.joinMutex.Lock()
+	defer c.joinMutex.Unlock()
+
+	c.dequeueJoin(user)
+
+	queue := append(c.joinQueues[server], user)
+	c.joinQueues[server] = queue
+	return len(queue)
+}
+
+// dequeueJoin removes the user from the queue they are in. Must be called
+// with the join mutex held. Returns the server they were waiting for, if
+// any.
+func (c *Cluster) dequeueJoin(user *User) *servers.GameServer {
+	for server, queue := range c.joinQueues {
+		for i, queued := range queue {
+			if queued != user {
+				continue
+			}
+
+			queue = append(queue[:i], queue[i+1:]...)
+			if len(queue) == 0 {
+				delete(c.joinQueues, server)
+			} else {
+				c.joinQueues[server] = queue
+			}
+			return server
+		}
+	}
+
+	return nil
+}
+
+// DequeueJoin removes the user from the queue they are in and returns the
+// server they were waiting for, if any.
+func (c *Cluster) DequeueJoin(user *User) *servers.GameServer {
+	c.joinMutex.Lock()
+	defer c.joinMutex.Unlock()
+	return c.dequeueJoin(user)
+}
+
+// takeJoinQueue removes the users at the front of a server's queue who fit
+// into its free slots and returns them. Must be called with the join mutex
+// held.
+func (c *Cluster) takeJoinQueue(server *servers.GameServer) []*User {
+	queue := c.joinQueues[server]
+
+	free := len(queue)
+	if server.MaxClients > 0 {
+		free = server.MaxClients - server.NumPlayers()
+	}
+
+	moving := make([]*User, 0)
+	for len(queue) > 0 && len(moving) < free {
+		user := queue[0]
+		queue = queue[1:]
+
+		// They left the cluster while they were waiting
+		if user.Session.Ctx().Err() != nil || user.GetServer() == server {
+			continue
+		}
+
+		moving = append(moving, user)
+	}
+
+	if len(queue) == 0 {
+		delete(c.joinQueues, server)
+	} else {
+		c.joinQueues[server] = queue
+	}
+
+	return moving
+}
+
+// PollJoinQueues moves queued users into the servers they are waiting for
+// as slots open up.
+func (c *Cluster) PollJoinQueues(ctx context.Context) {
+	ticker := time.NewTicker(JOIN_QUEUE_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			moves := make(map[*servers.GameServer][]*User)
+
+			c.joinMutex.Lock()
+			for server := range c.joinQueues {
+				if server.Ctx().Err() != nil {
+					for _, user := range c.joinQueues[server] {
+						user.Message(game.Red(fmt.Sprintf(
+							"%s was shut down while you were waiting",
+							server.Reference(),
+						)))
+					}
+					delete(c.joinQueues, server)
+					continue
+				}
+
+				if moving := c.takeJoinQueue(server); len(moving) > 0 {
+					moves[server] = moving
+				}
+			}
+			c.joinMutex.Unlock()
+
+			// Users take the join mutex once they arrive, so connect them
+			// without holding it
+			for server, users := range moves {
+				for _, user := range users {
+					_, err := user.Connect(server)
+					if err != nil {
+						logger := user.Logger()
+						logger.Warn().Err(err).Msg("failed to move queued user")
+						continue
+					}
+
+					user.Message(game.Green(fmt.Sprintf(
+						"a slot opened up on %s",
+						server.Reference(),
+					)))
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// joinOrQueue connects the user to the server or, if it is full, puts them
+// in its queue.
+func (c *Cluster) joinOrQueue(user *User, server *servers.GameServer) error {
+	_, err := user.Connect(server)
+	if err == nil {
+		c.DequeueJoin(user)
+		return nil
+	}
+
+	if !errors.Is(err, ErrServerFull) {
+		return err
+	}
+
+	full := fmt.Sprintf(
+		"%s is full (%d/%d)",
+		server.Reference(),
+		server.NumPlayers(),
+		server.MaxClients,
+	)
+
+	// Clients that are not in a game yet have nowhere to wait
+	if user.GetServer() == nil {
+		// Desktop clients joining a server directly never see the
+		// command's result, so tell them why they were dropped
+		if user.Connection.Type() == ingress.ClientTypeENet {
+			user.Connection.Disconnect(
+				int(disconnectreason.Full),
+				fmt.Sprintf("%s, try again later", full),
+			)
+			user.Connection.Session().Cancel()
+		}
+		return fmt.Errorf("%s, try again later", full)
+	}
+
+	position := c.EnqueueJoin(user, server)
+	user.Message(fmt.Sprintf(
+		"%s, you are #%d in the queue. use #leavequeue to stop waiting",
+		full,
+		position,
+	))
+
+	c.queueParty(user, server)
+	return nil
+}
+
+// queueParty puts the members of the user's party in the queue for a server
+// behind the user, if the user leads the party. Members who are playing a
+// match or are already on the server stay where they are.
+func (c *Cluster) queueParty(user *User, server *servers.GameServer) {
+	leader, members := c.Users.GetParty(user)
+	if leader != user {
+		return
+	}
+
+	for _, member := range members {
+		if member == leader || member.GetServer() == server || isPlayingMatch(member) {
+			continue
+		}
+
+		position := c.EnqueueJoin(member, server)
+		member.Message(fmt.Sprintf(
+			"%s is waiting for a slot on %s, you are #%d in the queue behind them",
+			leader.GetName(),
+			server.Reference(),
+			position,
+		))
+	}
+}
+
+func (c *Cluster) queueCommands() []commands.Command {
+	leaveQueueCommand := commands.Command{
+		Name:        "leavequeue",
+		Description: "stop waiting for a slot on a full server",
+		Callback: func(ctx context.Context, user *User) error {
+			server := c.DequeueJoin(user)
+			if server == nil {
+				return fmt.Errorf("you are not waiting for a server")
+			}
+
+			user.Message(fmt.Sprintf(
+				"you are no longer waiting for %s",
+				server.Reference(),
+			))
+			return nil
+		},
+	}
+
+	return []commands.Command{
+		leaveQueueCommand,
+	}
+}
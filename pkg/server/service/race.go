@@ -0,0 +1,374 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/game/commands"
+	P "github.com/cfoust/sour/pkg/game/protocol"
+	"github.com/cfoust/sour/pkg/gameserver/protocol/gamemode"
+	"github.com/cfoust/sour/pkg/server/race"
+	"github.com/cfoust/sour/pkg/server/servers"
+)
+
+// How many times #times shows
+const NUM_RACE_TIMES = 5
+
+// The race on a single game server.
+type raceState struct {
+	// Set by the server's owner with #race off
+	disabled atomic.Bool
+	// Bumped when everyone's run has to start over
+	epoch atomic.Int64
+	// The map the course was read from
+	mapName string
+	// nil if the map has no course
+	course *race.Course
+}
+
+// userRace is a user's run on the course of the server they are on. Only the
+// goroutine handling the user's packets touches it, so positions can be
+// handled without taking the race mutex.
+type userRace struct {
+	server *servers.GameServer
+	// The user's session on the server
+	session context.Context
+	state   *raceState
+	mapName string
+	course  *race.Course
+	epoch   int64
+	run     race.Run
+}
+
+// Races only run in modes without teams, objectives or items, where players
+// are free to go wherever the course takes them.
+func isRaceMode(mode gamemode.ID) bool {
+	return mode == gamemode.FFA || mode == gamemode.CoopEdit
+}
+
+// raceIdentity is who the user's race times are saved under, which is empty
+// if they have not authenticated. Anyone can take a name, so names are not
+// enough.
+func (c *Cluster) raceIdentity(user *User) string {
+	if account := user.GetAccount(); account != nil {
+		return account.Identity
+	}
+	return strings.ToLower(c.accountIdentity(user))
+}
+
+// getRace returns the race state for a server. Must be called with the race
+// mutex held.
+func (c *Cluster) getRace(server *servers.GameServer) *raceState {
+	state, ok := c.races[server]
+	if ok {
+		return state
+	}
+
+	state = &raceState{}
+	c.races[server] = state
+
+	go func() {
+		<-server.Ctx().Done()
+		c.raceMutex.Lock()
+		delete(c.races, server)
+		c.raceMutex.Unlock()
+	}()
+
+	return state
+}
+
+// updateCourse reads the course from the server's map if it has changed.
+// Must be called with the race mutex held.
+func (c *Cluster) updateCourse(server *servers.GameServer, state *raceState) {
+	mapName := server.Map
+	if state.mapName == mapName {
+		return
+	}
+
+	state.course = nil
+
+	server.Mutex.RLock()
+	entities := server.Entities
+	entitiesMap := server.EntitiesMap
+	server.Mutex.RUnlock()
+
+	// The map's entities have not been read yet, try again later
+	if entitiesMap != mapName {
+		state.mapName = ""
+		return
+	}
+
+	state.mapName = mapName
+
+	course, err := race.NewCourse(entities)
+	if err != nil {
+		return
+	}
+
+	state.course = course
+	logger := server.Logger()
+	logger.Info().
+		Str("map", mapName).
+		Int("checkpoints", len(course.Checkpoints)).
+		Msg("found race course")
+}
+
+// joinRace starts a run for the user on the course of the server they are
+// on. It only takes the race mutex when the user gets to a new server or map.
+func (c *Cluster) joinRace(user *User, server *servers.GameServer) *userRace {
+	c.raceMutex.Lock()
+	defer c.raceMutex.Unlock()
+
+	state := c.getRace(server)
+	c.updateCourse(server, state)
+
+	return &userRace{
+		server:  server,
+		session: user.ServerSessionContext(),
+		state:   state,
+		mapName: state.mapName,
+		course:  state.course,
+		epoch:   state.epoch.Load(),
+	}
+}
+
+// ResetRace cancels the user's run, e.g. because they respawned.
+func (c *Cluster) ResetRace(user *User) {
+	if user.race != nil {
+		user.race.run.Reset()
+	}
+}
+
+// HandleRacePosition moves the user along the course of the map they are
+// playing, if there is one.
+func (c *Cluster) HandleRacePosition(user *User, server *servers.GameServer, pos P.Pos) {
+	if int(pos.Client) != user.GetClientNum() || !isRaceMode(server.GameMode.ID()) {
+		return
+	}
+
+	current := user.race
+	if current == nil ||
+		current.server != server ||
+		current.mapName != server.Map ||
+		current.session.Err() != nil {
+		current = c.joinRace(user, server)
+		user.race = current
+	}
+
+	if current.course == nil || current.state.disabled.Load() {
+		return
+	}
+
+	// The race was turned off and on again
+	if epoch := current.state.epoch.Load(); epoch != current.epoch {
+		current.run.Reset()
+		current.epoch = epoch
+	}
+
+	position := race.Vector{
+		X: pos.State.O.X,
+		Y: pos.State.O.Y,
+		Z: pos.State.O.Z,
+	}
+	event := current.course.Update(&current.run, position, time.Now())
+
+	switch event.Type {
+	case race.EventStarted:
+		user.Message(game.Green("go!"))
+	case race.EventCheckpoint:
+		message := fmt.Sprintf(
+			"checkpoint %d/%d: %s",
+			event.Checkpoint+1,
+			len(current.course.Checkpoints),
+			race.FormatTime(event.Time),
+		)
+
+		if identity := c.raceIdentity(user); identity != "" {
+			best := c.records.Best(current.mapName, identity)
+			if best != nil && event.Checkpoint < len(best.Splits) {
+				message += " " + formatRaceDelta(event.Time, best.Splits[event.Checkpoint])
+			}
+		}
+
+		user.Message(message)
+	case race.EventFinished:
+		splits := append([]time.Duration{}, current.run.Splits...)
+		c.finishRace(user, server, current.mapName, event.Time, splits)
+	}
+}
+
+// Deltas are green when the player is ahead of their best.
+func formatRaceDelta(elapsed, reference time.Duration) string {
+	delta := race.FormatDelta(elapsed, reference)
+	if elapsed < reference {
+		return game.Green(delta)
+	}
+	return game.Red(delta)
+}
+
+func (c *Cluster) finishRace(user *User, server *servers.GameServer, mapName string, elapsed time.Duration, splits []time.Duration) {
+	logger := user.Logger()
+
+	message := fmt.Sprintf(
+		"%s finished in %s",
+		user.GetFormattedName(),
+		game.Green(race.FormatTime(elapsed)),
+	)
+
+	identity := c.raceIdentity(user)
+	if identity == "" {
+		c.AnnounceInServer(user.Ctx(), server, message)
+		user.Message("authenticate to save your race times")
+		return
+	}
+
+	result, err := c.records.Submit(mapName, race.Record{
+		Identity: identity,
+		Name:     user.GetName(),
+		Time:     elapsed,
+		Splits:   splits,
+	})
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to save race time")
+	}
+
+	logger.Info().
+		Str("map", mapName).
+		Dur("time", elapsed).
+		Msg("finished race")
+
+	switch {
+	case result.NewMapRecord:
+		message += game.Yellow(" (new map record!)")
+	case result.PersonalBest:
+		message += " (personal best)"
+	}
+
+	c.AnnounceInServer(user.Ctx(), server, message)
+
+	if result.Previous != nil {
+		user.Message(fmt.Sprintf(
+			"your best is %s, that was %s",
+			race.FormatTime(result.Previous.Time),
+			formatRaceDelta(elapsed, result.Previous.Time),
+		))
+	}
+}
+
+func (c *Cluster) raceCommands() []commands.Command {
+	raceCommand := commands.Command{
+		Name:        "race",
+		ArgFormat:   "[on|off]",
+		Description: "show whether this map has a race course, or turn the race on or off",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			server := user.GetServer()
+			if server == nil {
+				return fmt.Errorf("you are not on a server")
+			}
+
+			c.raceMutex.Lock()
+			state := c.getRace(server)
+			c.updateCourse(server, state)
+			course := state.course
+			c.raceMutex.Unlock()
+
+			disabled := state.disabled.Load()
+
+			if len(args) == 0 {
+				switch {
+				case course == nil:
+					user.Message("this map has no race course")
+				case disabled:
+					user.Message("the race is turned off")
+				case !isRaceMode(server.GameMode.ID()):
+					user.Message("races only run in ffa and coop edit")
+				default:
+					user.Message(fmt.Sprintf(
+						"race on %s with %d checkpoints",
+						server.Map,
+						len(course.Checkpoints),
+					))
+				}
+				return nil
+			}
+
+			if !user.IsAdmin() && !c.IsServerOwner(user, server) {
+				return fmt.Errorf("only the server's owner can do that")
+			}
+
+			switch strings.ToLower(args[0]) {
+			case "on":
+				disabled = false
+			case "off":
+				disabled = true
+			default:
+				return fmt.Errorf("expected on or off")
+			}
+
+			state.disabled.Store(disabled)
+			state.epoch.Add(1)
+
+			status := "on"
+			if disabled {
+				status = "off"
+			}
+			c.AnnounceInServer(ctx, server, fmt.Sprintf(
+				"%s turned the race %s",
+				user.GetFormattedName(),
+				status,
+			))
+			return nil
+		},
+	}
+
+	timesCommand := commands.Command{
+		Name:        "times",
+		ArgFormat:   "[map]",
+		Description: "show the best race times on a map",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			var mapName string
+			if len(args) > 0 {
+				mapName = args[0]
+			} else if server := user.GetServer(); server != nil {
+				mapName = server.Map
+			} else {
+				return fmt.Errorf("you are not on a server")
+			}
+
+			times := c.records.Top(mapName, NUM_RACE_TIMES)
+			if len(times) == 0 {
+				user.Message(fmt.Sprintf("no one has finished %s yet", mapName))
+				return nil
+			}
+
+			user.Message(fmt.Sprintf("best times on %s:", mapName))
+			for i, record := range times {
+				user.Message(fmt.Sprintf(
+					"%d. %s %s",
+					i+1,
+					game.Green(race.FormatTime(record.Time)),
+					record.Name,
+				))
+			}
+
+			identity := c.raceIdentity(user)
+			if best := c.records.Best(mapName, identity); identity != "" && best != nil {
+				user.Message(fmt.Sprintf(
+					"your best: %s",
+					race.FormatTime(best.Time),
+				))
+			}
+
+			return nil
+		},
+	}
+
+	return []commands.Command{
+		raceCommand,
+		timesCommand,
+	}
+}
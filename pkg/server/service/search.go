@@ -0,0 +1,134 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cfoust/sour/pkg/config"
+
+	"github.com/repeale/fp-go/option"
+)
+
+// How often the matchmaker looks for matches, since search windows widen
+// over time even when no one new queues
+const MATCH_INTERVAL = time.Second
+
+// searchWindow returns how far apart two players' ratings can be for one
+// who has waited this long.
+func searchWindow(duelType config.DuelType, waited time.Duration) int {
+	window := duelType.SearchWindow
+
+	if duelType.SearchGrowthSeconds > 0 {
+		steps := uint(waited / (time.Duration(duelType.SearchGrowthSeconds) * time.Second))
+		window += steps * duelType.SearchGrowth
+	}
+
+	if duelType.MaxSearchWindow > 0 && window > duelType.MaxSearchWindow {
+		window = duelType.MaxSearchWindow
+	}
+
+	return int(window)
+}
+
+// GetRating returns the user's rating in a type of duel.
+func (u *User) GetRating(duelType string) int {
+	u.ELO.Mutex.Lock()
+	defer u.ELO.Mutex.Unlock()
+
+	elo, ok := u.ELO.Ratings[duelType]
+	if !ok {
+		return int(NewELO().Rating)
+	}
+	return int(elo.Rating)
+}
+
+// SearchRange describes the ratings of the opponents a queued user can
+// currently be matched with, e.g. "1100-1300".
+func (m *Matchmaker) SearchRange(queued *QueuedClient, now time.Time) string {
+	duelType := m.FindDuelType(queued.Type)
+	if opt.IsNone(duelType) {
+		return "any"
+	}
+
+	rating := queued.User.GetRating(queued.Type)
+	window := searchWindow(duelType.Value, now.Sub(queued.JoinTime))
+
+	low := rating - window
+	if low < 0 {
+		low = 0
+	}
+	return fmt.Sprintf("%d-%d", low, rating+window)
+}
+
+// canMatch reports whether two queued users of the same duel type may be
+// paired right now. Both of their windows have to cover the difference in
+// their ratings.
+func (m *Matchmaker) canMatch(duelType config.DuelType, a, b *QueuedClient, now time.Time) (int, bool) {
+	waitedA := now.Sub(a.JoinTime)
+	waitedB := now.Sub(b.JoinTime)
+
+	// Avoid the same two players dueling over and over
+	rematchWait := time.Duration(duelType.RematchSeconds) * time.Second
+	isRematch := m.lastOpponents[a.User] == b.User || m.lastOpponents[b.User] == a.User
+	if isRematch && (waitedA < rematchWait || waitedB < rematchWait) {
+		return 0, false
+	}
+
+	difference := a.User.GetRating(a.Type) - b.User.GetRating(b.Type)
+	if difference < 0 {
+		difference = -difference
+	}
+
+	if difference > searchWindow(duelType, waitedA) || difference > searchWindow(duelType, waitedB) {
+		return 0, false
+	}
+
+	return difference, true
+}
+
+// findMatches pairs up queued users, longest waiting first, each with the
+// closest rated opponent they can play. Must be called with the mutex held.
+func (m *Matchmaker) findMatches(now time.Time) [][2]*QueuedClient {
+	matches := make([][2]*QueuedClient, 0)
+	// Users can queue for several types of duel at once
+	matched := make(map[*User]bool)
+
+	// The queue is in the order users joined it
+	for i, a := range m.queue {
+		if matched[a.User] {
+			continue
+		}
+
+		duelType := m.FindDuelType(a.Type)
+		if opt.IsNone(duelType) {
+			continue
+		}
+
+		var best *QueuedClient
+		bestDifference := 0
+		for _, b := range m.queue[i+1:] {
+			if matched[b.User] || a.User == b.User || a.Type != b.Type {
+				continue
+			}
+
+			difference, ok := m.canMatch(duelType.Value, a, b, now)
+			if !ok {
+				continue
+			}
+
+			if best == nil || difference < bestDifference {
+				best, bestDifference = b, difference
+			}
+		}
+
+		if best == nil {
+			continue
+		}
+
+		matched[a.User] = true
+		matched[best.User] = true
+		matches = append(matches, [2]*QueuedClient{a, best})
+	}
+
+	return matches
+}
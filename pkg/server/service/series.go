@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/game/commands"
+)
+
+// vetoSteps decides the order of vetoes and picks (true) that narrows a pool
+// of maps down to the maps of a series. Players first veto half of the maps
+// that will not be played, then pick all but the last map of the series, then
+// veto the rest. The map that is left over is the decider.
+func vetoSteps(poolSize int, bestOf int) []bool {
+	vetoes := poolSize - bestOf
+	picks := bestOf - 1
+	first := (vetoes + 1) / 2
+
+	steps := make([]bool, 0)
+	for i := 0; i < first; i++ {
+		steps = append(steps, false)
+	}
+	for i := 0; i < picks; i++ {
+		steps = append(steps, true)
+	}
+	for i := first; i < vetoes; i++ {
+		steps = append(steps, false)
+	}
+	return steps
+}
+
+// A mapVeto is two players taking turns vetoing and picking maps for a
+// series.
+type mapVeto struct {
+	players   [2]*User
+	steps     []bool
+	step      int
+	remaining []string
+	picked    []string
+}
+
+func newMapVeto(players [2]*User, pool []string, bestOf int) *mapVeto {
+	return &mapVeto{
+		players:   players,
+		steps:     vetoSteps(len(pool), bestOf),
+		remaining: append([]string{}, pool...),
+		picked:    make([]string, 0),
+	}
+}
+
+func (v *mapVeto) done() bool {
+	return v.step >= len(v.steps)
+}
+
+// turn returns whose turn it is and whether they are picking (rather than
+// vetoing) a map.
+func (v *mapVeto) turn() (*User, bool) {
+	return v.players[v.step%2], v.steps[v.step]
+}
+
+func (v *mapVeto) choose(map_ string) error {
+	for i, other := range v.remaining {
+		if other != map_ {
+			continue
+		}
+
+		if v.steps[v.step] {
+			v.picked = append(v.picked, map_)
+		}
+		v.remaining = append(v.remaining[:i], v.remaining[i+1:]...)
+		v.step++
+		return nil
+	}
+
+	return fmt.Errorf("%s is not in the map pool (%s)", map_, strings.Join(v.remaining, ", "))
+}
+
+// maps returns the maps of the series in the order they are played.
+func (v *mapVeto) maps() []string {
+	return append(append([]string{}, v.picked...), v.remaining...)
+}
+
+func describeChoice(pick bool) string {
+	if pick {
+		return "pick"
+	}
+	return "veto"
+}
+
+// Choose vetoes or picks a map on the user's behalf, if it is their turn.
+func (d *Duel) Choose(user *User, map_ string, pick bool) error {
+	d.Mutex.Lock()
+	veto := d.veto
+	if veto == nil || veto.done() {
+		d.Mutex.Unlock()
+		return fmt.Errorf("there are no maps to choose right now")
+	}
+
+	player, isPick := veto.turn()
+	if player != user {
+		d.Mutex.Unlock()
+		return fmt.Errorf("it is not your turn")
+	}
+
+	if isPick != pick {
+		d.Mutex.Unlock()
+		return fmt.Errorf("you have to #%s a map", describeChoice(isPick))
+	}
+
+	err := veto.choose(map_)
+	d.Mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case d.vetoed <- true:
+	default:
+	}
+
+	d.broadcast(fmt.Sprintf("%s %sed %s", user.Reference(), describeChoice(pick), map_))
+	return nil
+}
+
+// chooseMaps has the players veto and pick the maps of the series from the
+// duel type's pool. An empty map means the preset's map.
+func (d *Duel) chooseMaps(ctx context.Context) []string {
+	bestOf := int(d.Type.BestOf)
+	if bestOf == 0 {
+		bestOf = 1
+	}
+
+	pool := d.Type.Maps
+	if len(pool) == 0 {
+		return make([]string, bestOf)
+	}
+
+	// Not enough maps to veto any, so play them in order
+	if len(pool) <= bestOf {
+		maps := make([]string, 0)
+		for len(maps) < bestOf {
+			maps = append(maps, pool[len(maps)%len(pool)])
+		}
+		return maps
+	}
+
+	// Either player may go first
+	players := [2]*User{d.A, d.B}
+	if rand.Intn(2) == 1 {
+		players = [2]*User{d.B, d.A}
+	}
+
+	veto := newMapVeto(players, pool, bestOf)
+	d.Mutex.Lock()
+	d.veto = veto
+	d.Mutex.Unlock()
+
+	timeout := time.Duration(d.Type.VetoSeconds) * time.Second
+	for {
+		d.Mutex.Lock()
+		if veto.done() {
+			maps := veto.maps()
+			d.Mutex.Unlock()
+			return maps
+		}
+		player, pick := veto.turn()
+		step := veto.step
+		remaining := strings.Join(veto.remaining, ", ")
+		d.Mutex.Unlock()
+
+		d.broadcast(fmt.Sprintf(
+			"%s, #%s a map within %d seconds: %s",
+			player.Reference(),
+			describeChoice(pick),
+			d.Type.VetoSeconds,
+			game.Yellow(remaining),
+		))
+
+		timer := time.NewTimer(timeout)
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-d.vetoed:
+				d.Mutex.Lock()
+				advanced := veto.step != step
+				d.Mutex.Unlock()
+
+				if advanced {
+					timer.Stop()
+					break wait
+				}
+			case <-timer.C:
+				d.Mutex.Lock()
+				if veto.step == step {
+					map_ := veto.remaining[rand.Intn(len(veto.remaining))]
+					veto.choose(map_)
+					d.Mutex.Unlock()
+					d.broadcast(fmt.Sprintf(
+						"%s ran out of time, %sing %s for them",
+						player.Reference(),
+						describeChoice(pick),
+						map_,
+					))
+				} else {
+					d.Mutex.Unlock()
+				}
+				break wait
+			}
+		}
+	}
+}
+
+// FindDuel returns the duel the user is playing in, if any.
+func (m *Matchmaker) FindDuel(user *User) *Duel {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, duel := range m.duels {
+		if duel.A == user || duel.B == user {
+			return duel
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) vetoCommands() []commands.Command {
+	choose := func(user *User, map_ string, pick bool) error {
+		duel := c.matches.FindDuel(user)
+		if duel == nil {
+			duel = c.findTournamentDuel(user)
+		}
+		if duel == nil {
+			return fmt.Errorf("you are not in a duel")
+		}
+
+		if map_ == "" {
+			return fmt.Errorf("you have to name a map")
+		}
+
+		return duel.Choose(user, map_, pick)
+	}
+
+	vetoCommand := commands.Command{
+		Name:        "veto",
+		ArgFormat:   "[map]",
+		Description: "remove a map from your duel's map pool",
+		Callback: func(ctx context.Context, user *User, map_ string) error {
+			return choose(user, map_, false)
+		},
+	}
+
+	pickCommand := commands.Command{
+		Name:        "pick",
+		ArgFormat:   "[map]",
+		Description: "pick a map from your duel's map pool to be played",
+		Callback: func(ctx context.Context, user *User, map_ string) error {
+			return choose(user, map_, true)
+		},
+	}
+
+	return []commands.Command{
+		vetoCommand,
+		pickCommand,
+	}
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/game/commands"
+	"github.com/cfoust/sour/pkg/server/servers"
+)
+
+var ErrSpectatorsFull = fmt.Errorf("there are too many spectators")
+
+// A liveMatch is a duel, team match or private game that is being played
+// right now.
+type liveMatch struct {
+	server      *servers.GameServer
+	players     []*User
+	description string
+}
+
+func (d *Duel) describe() string {
+	d.Mutex.Lock()
+	defer d.Mutex.Unlock()
+
+	description := fmt.Sprintf(
+		"%s %d - %d %s (%s, %s)",
+		d.A.GetName(),
+		d.scoreA,
+		d.scoreB,
+		d.B.GetName(),
+		d.Type.Name,
+		d.Phase,
+	)
+
+	if d.Type.BestOf > 1 {
+		description += fmt.Sprintf(" games %d-%d", d.winsA, d.winsB)
+	}
+
+	return description
+}
+
+func (t *TeamMatch) describe() string {
+	var names [2]string
+	for team, users := range t.Teams {
+		members := make([]string, 0)
+		for _, user := range users {
+			members = append(members, user.GetName())
+		}
+		names[team] = strings.Join(members, ", ")
+	}
+
+	return fmt.Sprintf("%s vs %s (%s)", names[0], names[1], t.Type.Name)
+}
+
+// privateGames describes the private games that have players in them,
+// including ones protected by a password. Joining those still requires the
+// password.
+func (c *Cluster) privateGames() []liveMatch {
+	c.createMutex.Lock()
+	owners := make(map[*servers.GameServer]*User, len(c.serverOwners))
+	for gameServer, owner := range c.serverOwners {
+		owners[gameServer] = owner
+	}
+	c.createMutex.Unlock()
+
+	games := make([]liveMatch, 0)
+	for gameServer, owner := range owners {
+		c.Users.Mutex.RLock()
+		players := append([]*User{}, c.Users.Servers[gameServer]...)
+		c.Users.Mutex.RUnlock()
+
+		if len(players) == 0 {
+			continue
+		}
+
+		description := fmt.Sprintf(
+			"%s's private game (%s on %s)",
+			owner.GetName(),
+			gameServer.GameMode.ID(),
+			gameServer.Map,
+		)
+		if gameServer.HasPassword() {
+			description += " [password]"
+		}
+
+		games = append(games, liveMatch{
+			server:      gameServer,
+			players:     players,
+			description: description,
+		})
+	}
+
+	return games
+}
+
+// liveMatches returns every match with a server that can be watched, in a
+// stable order.
+func (c *Cluster) liveMatches() []liveMatch {
+	matches := make([]liveMatch, 0)
+
+	addDuel := func(duel *Duel) {
+		if duel.server == nil {
+			return
+		}
+
+		matches = append(matches, liveMatch{
+			server:      duel.server,
+			players:     []*User{duel.A, duel.B},
+			description: duel.describe(),
+		})
+	}
+
+	addTeamMatch := func(match *TeamMatch) {
+		if match.server == nil {
+			return
+		}
+
+		matches = append(matches, liveMatch{
+			server:      match.server,
+			players:     match.users(),
+			description: match.describe(),
+		})
+	}
+
+	c.matches.mutex.Lock()
+	duels := append([]*Duel{}, c.matches.duels...)
+	c.matches.mutex.Unlock()
+
+	c.teams.mutex.Lock()
+	teamMatches := append([]*TeamMatch{}, c.teams.matches...)
+	c.teams.mutex.Unlock()
+
+	c.tourneyMutex.Lock()
+	for _, tourney := range c.tournaments {
+		tourney.mutex.Lock()
+		for duel := range tourney.duels {
+			duels = append(duels, duel)
+		}
+		for match := range tourney.teamMatches {
+			teamMatches = append(teamMatches, match)
+		}
+		tourney.mutex.Unlock()
+	}
+	c.tourneyMutex.Unlock()
+
+	for _, duel := range duels {
+		addDuel(duel)
+	}
+	for _, match := range teamMatches {
+		addTeamMatch(match)
+	}
+	matches = append(matches, c.privateGames()...)
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].server.Started.Before(matches[j].server.Started)
+	})
+
+	return matches
+}
+
+// findLiveMatch finds a match by its number in #matches or by the name of
+// one of its players.
+func (c *Cluster) findLiveMatch(target string) (*liveMatch, error) {
+	matches := c.liveMatches()
+
+	if number, err := strconv.Atoi(target); err == nil {
+		if number < 1 || number > len(matches) {
+			return nil, fmt.Errorf("there is no match %d, see #matches", number)
+		}
+		return &matches[number-1], nil
+	}
+
+	for i, match := range matches {
+		for _, player := range match.players {
+			if strings.EqualFold(player.GetName(), target) {
+				return &matches[i], nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%s is not playing a match", target)
+}
+
+// checkSpectatePassword lets a user watch a password protected game if they
+// know the password or were already allowed in.
+func (c *Cluster) checkSpectatePassword(user *User, match *liveMatch, args []string) error {
+	gameServer := match.server
+	if !gameServer.HasPassword() ||
+		gameServer.IsSessionAllowed(uint32(user.Id)) ||
+		c.IsServerOwner(user, gameServer) {
+		return nil
+	}
+
+	if len(args) < 2 {
+		return fmt.Errorf(
+			"this game is password protected, use #spectate %s [password]",
+			args[0],
+		)
+	}
+
+	if !gameServer.CheckPassword(args[1]) {
+		return fmt.Errorf("incorrect password")
+	}
+
+	gameServer.AllowSession(user.Ctx(), uint32(user.Id))
+	return nil
+}
+
+func (c *Cluster) spectateCommands() []commands.Command {
+	matchesCommand := commands.Command{
+		Name:        "matches",
+		Description: "list the duels, team matches and private games being played",
+		Callback: func(ctx context.Context, user *User) {
+			matches := c.liveMatches()
+			if len(matches) == 0 {
+				user.Message("there are no matches being played right now")
+				return
+			}
+
+			for i, match := range matches {
+				user.Message(fmt.Sprintf(
+					"%d. %s %s",
+					i+1,
+					match.description,
+					game.Blue(fmt.Sprintf("[%d watching]", match.server.NumSpectators())),
+				))
+			}
+			user.Message("watch one with #spectate [number|player]")
+		},
+	}
+
+	spectateCommand := commands.Command{
+		Name:        "spectate",
+		Aliases:     []string{"watch"},
+		ArgFormat:   "[number|player] [password]",
+		Description: "watch a duel, team match or private game",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("you have to give a match number or player, see #matches")
+			}
+
+			if isPlayingMatch(user) {
+				return fmt.Errorf("you cannot spectate while you are playing a match")
+			}
+
+			match, err := c.findLiveMatch(args[0])
+			if err != nil {
+				return err
+			}
+
+			err = c.checkSpectatePassword(user, match, args)
+			if err != nil {
+				return err
+			}
+
+			connected, err := user.SpectateServer(match.server)
+			if err != nil {
+				return err
+			}
+
+			go func() {
+				if !<-connected {
+					return
+				}
+
+				watching := match.server.NumSpectators()
+				for _, player := range match.players {
+					player.Message(fmt.Sprintf(
+						"%s is watching your match (%d watching)",
+						user.GetName(),
+						watching,
+					))
+				}
+			}()
+
+			user.Message(fmt.Sprintf(
+				"you are spectating %s, leave with #go %s",
+				match.description,
+				c.settings.FallbackSpace,
+			))
+			return nil
+		},
+	}
+
+	return []commands.Command{
+		matchesCommand,
+		spectateCommand,
+	}
+}
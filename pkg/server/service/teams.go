@@ -0,0 +1,912 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cfoust/sour/pkg/config"
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/game/commands"
+	"github.com/cfoust/sour/pkg/mmr"
+	"github.com/cfoust/sour/pkg/server/accounts"
+	"github.com/cfoust/sour/pkg/server/ingress"
+	"github.com/cfoust/sour/pkg/server/servers"
+
+	"github.com/repeale/fp-go/option"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// A TeamQueued is a group of users (a party, or just one user) waiting for a
+// team match. Groups are always put on the same team.
+type TeamQueued struct {
+	Users    []*User
+	Type     string
+	JoinTime time.Time
+	// Valid for the duration of the group being in the queue
+	Context context.Context
+	Cancel  context.CancelFunc
+}
+
+func (q *TeamQueued) has(user *User) bool {
+	for _, other := range q.Users {
+		if other == user {
+			return true
+		}
+	}
+	return false
+}
+
+type TeamMatchResult struct {
+	Type  string
+	Teams [2][]*User
+	// The index of the winning team in Teams, or -1 for a draw
+	Winner int
+	// Whether the losing team left before the end of the match
+	Forfeit bool
+	// The players who left the match early, and whether they left or
+	// dodged it
+	Leavers map[*User]string
+}
+
+type TeamMatchDone struct {
+	Match *TeamMatch
+	// nil if the match could not be played
+	Result *TeamMatchResult
+}
+
+type TeamMatch struct {
+	Type  config.TeamMatchType
+	Teams [2][]*User
+	// The names of the teams on the server, in the same order as Teams
+	names [2]string
+
+	// The servers users were on prior to joining the match
+	oldServers map[*User]*servers.GameServer
+
+	Manager  *servers.ServerManager
+	Finished chan TeamMatchDone
+	server   *servers.GameServer
+
+	mutex sync.Mutex
+	// Whether the game has begun, after which leaving is no longer dodging
+	started bool
+	leavers map[*User]string
+}
+
+func (t *TeamMatch) users() []*User {
+	return append(append([]*User{}, t.Teams[0]...), t.Teams[1]...)
+}
+
+func (t *TeamMatch) Logger() zerolog.Logger {
+	names := make([]string, 0)
+	for _, user := range t.users() {
+		names = append(names, user.Reference())
+	}
+
+	logger := log.With().
+		Str("type", t.Type.Name).
+		Strs("users", names).
+		Logger()
+
+	if t.server != nil {
+		logger = logger.With().Str("server", t.server.Reference()).Logger()
+	}
+
+	return logger
+}
+
+func (t *TeamMatch) broadcast(message string) {
+	for _, user := range t.users() {
+		user.Message(message)
+	}
+}
+
+// scores returns the score of each team on the server.
+func (t *TeamMatch) scores() [2]int {
+	var scores [2]int
+
+	info := t.server.GetTeamInfo()
+	for _, score := range info.Scores {
+		for i, name := range t.names {
+			if score.Team == name {
+				scores[i] = score.Score
+			}
+		}
+	}
+
+	return scores
+}
+
+// Free up resources and move clients back to their original servers
+func (t *TeamMatch) Cleanup() {
+	for _, user := range t.users() {
+		oldServer := t.oldServers[user]
+		if t.server != nil && user.GetServer() == t.server && oldServer != nil {
+			user.Connect(oldServer)
+		}
+	}
+
+	if t.server != nil {
+		t.Manager.RemoveServer(t.server)
+	}
+}
+
+// report records the result of the match, unless it already has one.
+func (t *TeamMatch) report(matchResult chan TeamMatchResult, result TeamMatchResult) {
+	select {
+	case matchResult <- result:
+	default:
+	}
+}
+
+// MonitorPlayer records the user as a leaver if they leave the server before
+// the match is over, and ends the match in favor of the other team once every
+// member of the user's team has left.
+func (t *TeamMatch) MonitorPlayer(
+	ctx context.Context,
+	team int,
+	user *User,
+	cancelMatch context.CancelFunc,
+	matchResult chan TeamMatchResult,
+) {
+	logger := t.Logger()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-user.ServerSessionContext().Done():
+	}
+
+	// Everyone leaves the server once the match is over
+	if ctx.Err() != nil {
+		return
+	}
+
+	t.mutex.Lock()
+	kind := accounts.OffenceDodge
+	if t.started {
+		kind = accounts.OffenceLeave
+	}
+	t.leavers[user] = kind
+
+	left := 0
+	for _, member := range t.Teams[team] {
+		if _, ok := t.leavers[member]; ok {
+			left++
+		}
+	}
+	t.mutex.Unlock()
+
+	logger.Info().Str("user", user.Reference()).Msg("player left the match")
+
+	if left < len(t.Teams[team]) {
+		return
+	}
+
+	logger.Info().Msgf("team %s left the server, ending match", t.names[team])
+	t.report(matchResult, TeamMatchResult{
+		Type:    t.Type.Name,
+		Teams:   t.Teams,
+		Winner:  1 - team,
+		Forfeit: true,
+	})
+	cancelMatch()
+}
+
+func (t *TeamMatch) Run(ctx context.Context) {
+	logger := t.Logger()
+	logger.Info().Msg("initiating team match")
+
+	matchContext, cancelMatch := context.WithCancel(ctx)
+	defer cancelMatch()
+
+	t.oldServers = make(map[*User]*servers.GameServer)
+	t.leavers = make(map[*User]string)
+	for _, user := range t.users() {
+		t.oldServers[user] = user.GetServer()
+	}
+
+	matchResult := make(chan TeamMatchResult, 1)
+
+	go func() {
+		<-matchContext.Done()
+
+		// Matches that never got going have no result
+		var result *TeamMatchResult
+		select {
+		case done := <-matchResult:
+			t.mutex.Lock()
+			done.Leavers = make(map[*User]string)
+			for user, kind := range t.leavers {
+				done.Leavers[user] = kind
+			}
+			t.mutex.Unlock()
+			result = &done
+		default:
+		}
+
+		t.Cleanup()
+		t.Finished <- TeamMatchDone{
+			Match:  t,
+			Result: result,
+		}
+	}()
+
+	failure := func() {
+		t.broadcast(game.Red("error starting match server"))
+		cancelMatch()
+	}
+
+	t.broadcast(game.Green("Found a match!"))
+	t.broadcast("starting match server")
+
+	gameServer, err := t.Manager.NewServer(ctx, t.Type.Preset, true)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to create server")
+		failure()
+		return
+	}
+
+	gameServer.Hidden = true
+	gameServer.IdleExempt = true
+	gameServer.KeepTeams = true
+	gameServer.LockTeams = true
+
+	t.server = gameServer
+
+	// So we get the server in the log context
+	logger = t.Logger()
+
+	names := gameServer.TeamNames()
+	if len(names) < 2 {
+		logger.Error().Str("preset", t.Type.Preset).Msg("preset is not a team mode")
+		failure()
+		return
+	}
+	t.names = [2]string{names[0], names[1]}
+
+	go func() {
+		select {
+		case <-gameServer.Ctx().Done():
+			cancelMatch()
+		case <-matchContext.Done():
+			return
+		}
+	}()
+
+	gameServer.Pause()
+	gameServer.SetDescription(fmt.Sprintf("Sour %s", game.Red(t.Type.Name)))
+
+	if matchContext.Err() != nil {
+		return
+	}
+
+	// Move the clients to the new server and onto their teams
+	for team, users := range t.Teams {
+		for _, user := range users {
+			connected, err := user.ConnectToServer(gameServer, "", true, false)
+			if err != nil {
+				logger.Error().Err(err).Msg("client failed to connect")
+				failure()
+				return
+			}
+
+			select {
+			case result := <-connected:
+				if !result {
+					logger.Error().Str("user", user.Reference()).Msg("client failed to connect")
+					failure()
+					return
+				}
+			case <-matchContext.Done():
+				return
+			}
+
+			gameServer.SetTeam(user.ServerClient, t.names[team])
+		}
+	}
+
+	for team, users := range t.Teams {
+		for _, user := range users {
+			go t.MonitorPlayer(matchContext, team, user, cancelMatch, matchResult)
+		}
+	}
+
+	if matchContext.Err() != nil {
+		return
+	}
+
+	for team, users := range t.Teams {
+		names := make([]string, 0)
+		for _, user := range users {
+			names = append(names, user.Reference())
+		}
+
+		message := fmt.Sprintf("you are on team %s with %s", t.names[team], strings.Join(names, ", "))
+		for _, user := range users {
+			user.Message(message)
+		}
+	}
+
+	gameServer.Resume()
+	t.broadcast(fmt.Sprintf("%s: %dv%d. Teams are locked. Leaving is penalized, and if your whole team leaves, you lose.", t.Type.Name, t.Type.TeamSize, t.Type.TeamSize))
+
+	t.broadcast(game.Blue("Warmup"))
+	runPhase(matchContext, gameServer, t.broadcast, t.Type.WarmupSeconds, game.Blue("Warmup"))
+	gameServer.ResetPlayers(true)
+	gameServer.ForceRespawn(nil)
+
+	if matchContext.Err() != nil {
+		return
+	}
+
+	t.broadcast(game.Red("Get ready!"))
+	gameServer.Pause()
+	countdown(matchContext, t.broadcast, 5)
+	gameServer.Resume()
+	t.broadcast(game.Green("GO!"))
+
+	t.mutex.Lock()
+	t.started = true
+	t.mutex.Unlock()
+
+	if matchContext.Err() != nil {
+		return
+	}
+
+	// Flags captured during the warmup are not reset with the players, so
+	// only count what happened after this
+	start := t.scores()
+
+	runPhase(matchContext, gameServer, t.broadcast, t.Type.GameSeconds, game.Red(t.Type.Name))
+
+	if matchContext.Err() != nil {
+		return
+	}
+
+	end := t.scores()
+	scoreA := end[0] - start[0]
+	scoreB := end[1] - start[1]
+	logger.Info().Msgf("match ended %d:%d", scoreA, scoreB)
+
+	result := TeamMatchResult{
+		Type:   t.Type.Name,
+		Teams:  t.Teams,
+		Winner: -1,
+	}
+
+	if scoreA > scoreB {
+		result.Winner = 0
+	} else if scoreB > scoreA {
+		result.Winner = 1
+	}
+
+	t.report(matchResult, result)
+}
+
+type TeamMatchmaker struct {
+	types   []config.TeamMatchType
+	manager *servers.ServerManager
+	matches []*TeamMatch
+	queue   []*TeamQueued
+	results chan TeamMatchResult
+	mutex   sync.Mutex
+}
+
+func NewTeamMatchmaker(manager *servers.ServerManager, types []config.TeamMatchType) *TeamMatchmaker {
+	return &TeamMatchmaker{
+		types:   types,
+		manager: manager,
+		matches: make([]*TeamMatch, 0),
+		queue:   make([]*TeamQueued, 0),
+		results: make(chan TeamMatchResult, 10),
+	}
+}
+
+func (m *TeamMatchmaker) ReceiveResults() <-chan TeamMatchResult {
+	return m.results
+}
+
+func (m *TeamMatchmaker) FindType(name string) opt.Option[config.TeamMatchType] {
+	for _, matchType := range m.types {
+		if matchType.Name == name || (len(name) == 0 && matchType.Default) {
+			return opt.Some(matchType)
+		}
+	}
+
+	return opt.None[config.TeamMatchType]()
+}
+
+// IsQueued reports whether the user is waiting for any team match.
+func (m *TeamMatchmaker) IsQueued(user *User) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, queued := range m.queue {
+		if queued.has(user) {
+			return true
+		}
+	}
+	return false
+}
+
+// Inform the group regularly as to how long they've been in the queue.
+func (m *TeamMatchmaker) NotifyProgress(queued *TeamQueued) {
+	tick := time.NewTicker(30 * time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case now := <-tick.C:
+			since := now.Sub(queued.JoinTime).Round(time.Second)
+			for _, user := range queued.Users {
+				user.Message(fmt.Sprintf(
+					"you have been queued for %s for %s",
+					queued.Type,
+					since,
+				))
+			}
+		case <-queued.Context.Done():
+			return
+		}
+	}
+}
+
+// Queue puts a group of users in the queue for a type of team match. The
+// group will play on the same team.
+func (m *TeamMatchmaker) Queue(users []*User, typeName string) error {
+	matchType := m.FindType(typeName)
+	if opt.IsNone(matchType) {
+		return fmt.Errorf("team match type '%s' does not exist", typeName)
+	}
+
+	teamSize := int(matchType.Value.TeamSize)
+	if len(users) > teamSize {
+		return fmt.Errorf(
+			"%s is played in teams of %d, but your party has %d players",
+			matchType.Value.Name,
+			teamSize,
+			len(users),
+		)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, queued := range m.queue {
+		if queued.Type != matchType.Value.Name {
+			continue
+		}
+
+		for _, user := range users {
+			if queued.has(user) {
+				return fmt.Errorf("%s is already in the queue for %s", user.Reference(), queued.Type)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(users[0].Ctx())
+	queued := TeamQueued{
+		Users:    users,
+		Type:     matchType.Value.Name,
+		JoinTime: time.Now(),
+		Context:  ctx,
+		Cancel:   cancel,
+	}
+	go m.NotifyProgress(&queued)
+	m.queue = append(m.queue, &queued)
+
+	for _, user := range users {
+		log.Info().Str("user", user.Reference()).Str("type", queued.Type).Msg("queued for team match")
+		user.Message(fmt.Sprintf("you are now in the queue for %s", queued.Type))
+	}
+
+	return nil
+}
+
+// Dequeue takes the user, and anyone they queued with, out of every team
+// queue.
+func (m *TeamMatchmaker) Dequeue(user *User) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	cleaned := make([]*TeamQueued, 0)
+	for _, queued := range m.queue {
+		if queued.has(user) {
+			for _, member := range queued.Users {
+				log.Info().Str("user", member.Reference()).Str("type", queued.Type).Msg("left team queue")
+				member.Message(fmt.Sprintf("you left the queue for %s", queued.Type))
+			}
+			queued.Cancel()
+			continue
+		}
+		cleaned = append(cleaned, queued)
+	}
+	m.queue = cleaned
+}
+
+func (m *TeamMatchmaker) Poll(ctx context.Context) {
+	finished := make(chan TeamMatchDone)
+
+	ticker := time.NewTicker(MATCH_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case done := <-finished:
+			if done.Result != nil {
+				m.results <- *done.Result
+			}
+
+			m.mutex.Lock()
+			matches := make([]*TeamMatch, 0)
+			for _, match := range m.matches {
+				if match == done.Match {
+					continue
+				}
+				matches = append(matches, match)
+			}
+			m.matches = matches
+			m.mutex.Unlock()
+		case <-ticker.C:
+			m.match(ctx, finished)
+		}
+	}
+}
+
+// match starts team matches for the queued groups that fill one.
+func (m *TeamMatchmaker) match(ctx context.Context, finished chan TeamMatchDone) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// First prune any group with a member that is gone
+	cleaned := make([]*TeamQueued, 0)
+	for _, queued := range m.queue {
+		gone := false
+		for _, user := range queued.Users {
+			if user.Connection.NetworkStatus() == ingress.NetworkStatusDisconnected {
+				gone = true
+			}
+		}
+
+		if gone {
+			log.Info().Str("type", queued.Type).Msg("pruning group with disconnected client")
+			queued.Cancel()
+			continue
+		}
+		cleaned = append(cleaned, queued)
+	}
+	m.queue = cleaned
+
+	// Users can queue for several types of match at once
+	matched := make(map[*User]bool)
+	for _, matchType := range m.types {
+		for {
+			available := make([]*TeamQueued, 0)
+			for _, queued := range m.queue {
+				if queued.Type != matchType.Name {
+					continue
+				}
+
+				busy := false
+				for _, user := range queued.Users {
+					if matched[user] {
+						busy = true
+					}
+				}
+				if !busy {
+					available = append(available, queued)
+				}
+			}
+
+			picked, teams, ok := findTeamMatch(available, int(matchType.TeamSize))
+			if !ok {
+				break
+			}
+
+			for _, queued := range picked {
+				for _, user := range queued.Users {
+					matched[user] = true
+				}
+			}
+
+			match := TeamMatch{
+				Type:     matchType,
+				Teams:    teams,
+				Manager:  m.manager,
+				Finished: finished,
+			}
+
+			m.matches = append(m.matches, &match)
+
+			go match.Run(ctx)
+		}
+	}
+
+	// Remove the matched users from every queue they were in
+	cleaned = make([]*TeamQueued, 0)
+	for _, queued := range m.queue {
+		busy := false
+		for _, user := range queued.Users {
+			if matched[user] {
+				busy = true
+			}
+		}
+
+		if busy {
+			queued.Cancel()
+			continue
+		}
+		cleaned = append(cleaned, queued)
+	}
+	m.queue = cleaned
+}
+
+// findTeamMatch picks groups from the queue that together fill two teams of
+// teamSize, preferring the groups that have waited longest, and splits them
+// into the two teams.
+func findTeamMatch(queue []*TeamQueued, teamSize int) ([]*TeamQueued, [2][]*User, bool) {
+	var teams [2][]*User
+
+	var search func(start int, picked []*TeamQueued, count int) []*TeamQueued
+	search = func(start int, picked []*TeamQueued, count int) []*TeamQueued {
+		if count == 2*teamSize {
+			if _, ok := balanceTeams(picked, teamSize); ok {
+				return picked
+			}
+			return nil
+		}
+
+		for i := start; i < len(queue); i++ {
+			size := len(queue[i].Users)
+			if count+size > 2*teamSize {
+				continue
+			}
+
+			found := search(i+1, append(picked, queue[i]), count+size)
+			if found != nil {
+				return found
+			}
+		}
+
+		return nil
+	}
+
+	// The group that has waited longest should get into a match first
+	for i := range queue {
+		picked := search(i+1, []*TeamQueued{queue[i]}, len(queue[i].Users))
+		if picked == nil {
+			continue
+		}
+
+		teams, _ = balanceTeams(picked, teamSize)
+		return picked, teams, true
+	}
+
+	return nil, teams, false
+}
+
+// teamRatingKey is where a player's rating in a type of team match is kept,
+// both in their ELO state and in their account. Team match types get their
+// own namespace so that they never share a rating with a duel type of the
+// same name.
+func teamRatingKey(matchType string) string {
+	return "team:" + matchType
+}
+
+func groupRating(queued *TeamQueued) int {
+	total := 0
+	for _, user := range queued.Users {
+		total += user.GetRating(teamRatingKey(queued.Type))
+	}
+	return total
+}
+
+// balanceTeams splits groups into two teams of teamSize players whose total
+// ratings are as close as possible, without splitting up any group.
+func balanceTeams(groups []*TeamQueued, teamSize int) ([2][]*User, bool) {
+	var best [2][]*User
+	bestDifference := -1
+
+	// The first group is always on the first team, which halves the
+	// assignments we have to try
+	for mask := 1; mask < 1<<len(groups); mask += 2 {
+		var teams [2][]*User
+		var ratings [2]int
+		for i, queued := range groups {
+			team := 1
+			if mask&(1<<i) != 0 {
+				team = 0
+			}
+
+			teams[team] = append(teams[team], queued.Users...)
+			ratings[team] += groupRating(queued)
+		}
+
+		if len(teams[0]) != teamSize || len(teams[1]) != teamSize {
+			continue
+		}
+
+		difference := ratings[0] - ratings[1]
+		if difference < 0 {
+			difference = -difference
+		}
+
+		if bestDifference == -1 || difference < bestDifference {
+			best, bestDifference = teams, difference
+		}
+	}
+
+	return best, bestDifference != -1
+}
+
+func averageRating(users []*User, key string) int {
+	total := 0
+	for _, user := range users {
+		total += user.GetRating(key)
+	}
+	return total / len(users)
+}
+
+// PollTeamMatches updates the ratings of everyone who played in a team match.
+// Each player's rating changes as though they had played the other team's
+// average rating.
+func (server *Cluster) PollTeamMatches(ctx context.Context) {
+	results := server.teams.ReceiveResults()
+
+	for {
+		select {
+		case result := <-results:
+			calc := mmr.NewElo()
+			key := teamRatingKey(result.Type)
+
+			var averages [2]int
+			for team, users := range result.Teams {
+				averages[team] = averageRating(users, key)
+			}
+
+			for team, users := range result.Teams {
+				var score float64 = 0.5
+				if result.Winner == team {
+					score = 1
+				} else if result.Winner != -1 {
+					score = 0
+				}
+
+				for _, user := range users {
+					user.ELO.Mutex.Lock()
+					elo, ok := user.ELO.Ratings[key]
+					if !ok {
+						elo = NewELO()
+						user.ELO.Ratings[key] = elo
+					}
+
+					outcome, _ := calc.Outcome(
+						int(elo.Rating),
+						averages[1-team],
+						score,
+					)
+					elo.Rating = uint(outcome.Rating)
+
+					switch score {
+					case 1:
+						elo.Wins++
+					case 0:
+						elo.Losses++
+					default:
+						elo.Draws++
+					}
+					user.ELO.Mutex.Unlock()
+
+					if kind, ok := result.Leavers[user]; ok {
+						server.penalize(user, kind, result.Type, key)
+					}
+
+					go server.SaveRating(user, key)
+
+					switch score {
+					case 1:
+						user.Message(game.Green("your team won! ") + outcome.String())
+					case 0:
+						user.Message(game.Red("your team lost! ") + outcome.String())
+					default:
+						user.Message("the match ended in a draw " + outcome.String())
+					}
+				}
+			}
+
+			if result.Winner == -1 {
+				continue
+			}
+
+			winners := make([]string, 0)
+			for _, user := range result.Teams[result.Winner] {
+				winners = append(winners, user.Name)
+			}
+			losers := make([]string, 0)
+			for _, user := range result.Teams[1-result.Winner] {
+				losers = append(losers, user.Name)
+			}
+
+			message := fmt.Sprintf(
+				"%s beat %s in %s",
+				strings.Join(winners, ", "),
+				strings.Join(losers, ", "),
+				result.Type,
+			)
+
+			if result.Forfeit {
+				message += " because they left"
+			}
+
+			played := make(map[*User]bool)
+			for _, users := range result.Teams {
+				for _, user := range users {
+					played[user] = true
+				}
+			}
+
+			server.Users.Mutex.RLock()
+			for _, user := range server.Users.Users {
+				if played[user] {
+					continue
+				}
+				user.Message(message)
+			}
+			server.Users.Mutex.RUnlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Cluster) teamCommands() []commands.Command {
+	teamQueueCommand := commands.Command{
+		Name:        "teamqueue",
+		ArgFormat:   "[type]",
+		Aliases:     []string{"tq"},
+		Description: "queue for a matchmade team game",
+		Callback: func(ctx context.Context, user *User, matchType string) error {
+			// Parties queue together
+			users := []*User{user}
+			leader, members := c.Users.GetParty(user)
+			if members != nil {
+				if leader != user {
+					return fmt.Errorf("only your party's leader can queue for team games")
+				}
+				users = members
+			}
+
+			for _, member := range users {
+				err := c.canQueue(member)
+				if err != nil && member != user {
+					return fmt.Errorf("%s cannot queue: %s", member.GetName(), err)
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			return c.teams.Queue(users, matchType)
+		},
+	}
+
+	stopTeamQueueCommand := commands.Command{
+		Name:        "stopteamqueue",
+		Description: "leave the queue for team games",
+		Callback: func(ctx context.Context, user *User) {
+			c.teams.Dequeue(user)
+		},
+	}
+
+	return []commands.Command{
+		teamQueueCommand,
+		stopTeamQueueCommand,
+	}
+}
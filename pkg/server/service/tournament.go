@@ -0,0 +1,876 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cfoust/sour/pkg/config"
+	"github.com/cfoust/sour/pkg/game"
+	"github.com/cfoust/sour/pkg/game/commands"
+	"github.com/cfoust/sour/pkg/server/tournament"
+
+	"github.com/repeale/fp-go/option"
+	"github.com/rs/zerolog/log"
+)
+
+// How often tournaments check whether the players of ready matches are
+// around
+const TOURNAMENT_INTERVAL = 5 * time.Second
+
+var TOURNAMENT_NAME_REGEX = regexp.MustCompile(`^[\w-]+$`)
+
+type tourneyMember struct {
+	// The player's auth identity, or their name if they have none
+	Key  string
+	Name string
+}
+
+// A tourneyEntrant is a player or, in team tournaments, a team.
+type tourneyEntrant struct {
+	Name    string
+	Members []tourneyMember
+}
+
+// A Tournament is played either in duels or in team matches. Tournaments
+// do not affect ratings and are never stored: the entrants, bracket and
+// results of a tournament are lost when the cluster restarts.
+type Tournament struct {
+	Name   string
+	Format tournament.Format
+	// Canceled along with the tournament, which ends its running matches
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Exactly one of these is set
+	duelType *config.DuelType
+	teamType *config.TeamMatchType
+
+	entrants []*tourneyEntrant
+	// nil until the tournament starts
+	bracket *tournament.Bracket
+	// The matches being played right now
+	running map[int]bool
+	// The duels being played, so that players can veto maps in them
+	duels map[*Duel]bool
+	// The team matches being played, so that they can be spectated
+	teamMatches map[*TeamMatch]bool
+	// The matches whose players have been told that they are up
+	announced map[int]bool
+	mutex     sync.Mutex
+}
+
+func (t *Tournament) typeName() string {
+	if t.duelType != nil {
+		return t.duelType.Name
+	}
+	return t.teamType.Name
+}
+
+// ratingKey is where players' ratings in the tournament's type are kept.
+func (t *Tournament) ratingKey() string {
+	if t.duelType != nil {
+		return t.duelType.Name
+	}
+	return teamRatingKey(t.teamType.Name)
+}
+
+func (t *Tournament) teamSize() int {
+	if t.duelType != nil {
+		return 1
+	}
+	return int(t.teamType.TeamSize)
+}
+
+// findEntrant returns the index of the entrant a player is in, or -1. Must be
+// called with the mutex held.
+func (t *Tournament) findEntrant(key string) int {
+	for i, entrant := range t.entrants {
+		for _, member := range entrant.Members {
+			if member.Key == key {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// describe summarizes the state of the tournament. Must be called with the
+// mutex held.
+func (t *Tournament) describe() string {
+	state := "registering"
+	if t.bracket != nil {
+		state = "in progress"
+		if champion := t.bracket.Champion(); champion >= 0 {
+			state = fmt.Sprintf("won by %s", game.Green(t.entrants[champion].Name))
+		}
+	}
+
+	return fmt.Sprintf(
+		"%s: %s %s, %d entrants, %s",
+		game.Yellow(t.Name),
+		t.Format,
+		t.typeName(),
+		len(t.entrants),
+		state,
+	)
+}
+
+// describeMatch must be called with the mutex held.
+func (t *Tournament) describeMatch(match *tournament.Match) string {
+	status := "waiting for players"
+	if t.running[match.ID] {
+		status = game.Green("playing")
+	}
+
+	return fmt.Sprintf(
+		"match %d: %s vs %s (%s)",
+		match.ID,
+		t.entrants[match.Entrants[0]].Name,
+		t.entrants[match.Entrants[1]].Name,
+		status,
+	)
+}
+
+// findOnline returns the connected user with the given key, if any.
+func (c *Cluster) findOnline(key string) *User {
+	c.Users.Mutex.RLock()
+	defer c.Users.Mutex.RUnlock()
+
+	for _, user := range c.Users.Users {
+		if c.playerKey(user) == key {
+			return user
+		}
+	}
+	return nil
+}
+
+// findTournament looks up a tournament by name. An empty name refers to the
+// only tournament, if there is just one.
+func (c *Cluster) findTournament(name string) (*Tournament, error) {
+	c.tourneyMutex.Lock()
+	defer c.tourneyMutex.Unlock()
+
+	if name == "" {
+		if len(c.tournaments) == 1 {
+			for _, tourney := range c.tournaments {
+				return tourney, nil
+			}
+		}
+		return nil, fmt.Errorf("you have to name a tournament (see #tourney list)")
+	}
+
+	tourney, ok := c.tournaments[name]
+	if !ok {
+		return nil, fmt.Errorf("tournament '%s' does not exist", name)
+	}
+	return tourney, nil
+}
+
+// findTournamentDuel returns the tournament duel the user is playing in, if
+// any.
+func (c *Cluster) findTournamentDuel(user *User) *Duel {
+	c.tourneyMutex.Lock()
+	defer c.tourneyMutex.Unlock()
+
+	for _, tourney := range c.tournaments {
+		tourney.mutex.Lock()
+		for duel := range tourney.duels {
+			if duel.A == user || duel.B == user {
+				tourney.mutex.Unlock()
+				return duel
+			}
+		}
+		tourney.mutex.Unlock()
+	}
+	return nil
+}
+
+func (c *Cluster) announce(message string) {
+	c.Users.Mutex.RLock()
+	for _, user := range c.Users.Users {
+		user.Message(message)
+	}
+	c.Users.Mutex.RUnlock()
+}
+
+func (c *Cluster) createTournament(user *User, name string, formatName string, typeName string) error {
+	if !user.IsAdmin() {
+		return fmt.Errorf("you must be an admin to do that")
+	}
+
+	if !TOURNAMENT_NAME_REGEX.MatchString(name) {
+		return fmt.Errorf("tournament names can only contain letters, numbers, - and _")
+	}
+
+	format, err := tournament.ParseFormat(formatName)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(c.serverCtx)
+	tourney := &Tournament{
+		Name:        name,
+		Format:      format,
+		ctx:         ctx,
+		cancel:      cancel,
+		entrants:    make([]*tourneyEntrant, 0),
+		running:     make(map[int]bool),
+		duels:       make(map[*Duel]bool),
+		teamMatches: make(map[*TeamMatch]bool),
+		announced:   make(map[int]bool),
+	}
+
+	if duelType := c.matches.FindDuelType(typeName); opt.IsSome(duelType) {
+		tourney.duelType = &duelType.Value
+	} else if teamType := c.teams.FindType(typeName); opt.IsSome(teamType) {
+		tourney.teamType = &teamType.Value
+	} else {
+		cancel()
+		return fmt.Errorf("there is no duel or team match type '%s'", typeName)
+	}
+
+	c.tourneyMutex.Lock()
+	if _, ok := c.tournaments[name]; ok {
+		c.tourneyMutex.Unlock()
+		cancel()
+		return fmt.Errorf("tournament '%s' already exists", name)
+	}
+	c.tournaments[name] = tourney
+	c.tourneyMutex.Unlock()
+
+	log.Info().Str("tournament", name).Str("format", string(format)).Msg("created tournament")
+
+	joining := "#tourney join " + name
+	if tourney.teamType != nil {
+		joining += " [team]"
+	}
+	c.announce(fmt.Sprintf(
+		"%s created the tournament %s (%s %s), enter with %s",
+		user.Reference(),
+		game.Yellow(name),
+		format,
+		tourney.typeName(),
+		game.Blue(joining),
+	))
+	user.Message("tournaments are not saved, so this one is lost if the server restarts")
+	return nil
+}
+
+func (c *Cluster) joinTournament(user *User, name string, team string) error {
+	tourney, err := c.findTournament(name)
+	if err != nil {
+		return err
+	}
+
+	key := c.playerKey(user)
+	member := tourneyMember{
+		Key:  key,
+		Name: user.GetName(),
+	}
+
+	tourney.mutex.Lock()
+	defer tourney.mutex.Unlock()
+
+	if tourney.bracket != nil {
+		return fmt.Errorf("%s has already started", tourney.Name)
+	}
+
+	if tourney.findEntrant(key) != -1 {
+		return fmt.Errorf("you are already in %s", tourney.Name)
+	}
+
+	if tourney.duelType != nil {
+		tourney.entrants = append(tourney.entrants, &tourneyEntrant{
+			Name:    member.Name,
+			Members: []tourneyMember{member},
+		})
+		user.Message(fmt.Sprintf("you entered %s", tourney.Name))
+		return nil
+	}
+
+	if team == "" {
+		return fmt.Errorf("you have to name the team you are entering with")
+	}
+
+	for _, entrant := range tourney.entrants {
+		if !strings.EqualFold(entrant.Name, team) {
+			continue
+		}
+
+		if len(entrant.Members) >= tourney.teamSize() {
+			return fmt.Errorf("%s is full", entrant.Name)
+		}
+
+		entrant.Members = append(entrant.Members, member)
+		user.Message(fmt.Sprintf("you joined %s in %s", entrant.Name, tourney.Name))
+		return nil
+	}
+
+	tourney.entrants = append(tourney.entrants, &tourneyEntrant{
+		Name:    team,
+		Members: []tourneyMember{member},
+	})
+	user.Message(fmt.Sprintf(
+		"you entered %s with the team %s, which needs %d more players",
+		tourney.Name,
+		team,
+		tourney.teamSize()-1,
+	))
+	return nil
+}
+
+func (c *Cluster) leaveTournament(user *User, name string) error {
+	tourney, err := c.findTournament(name)
+	if err != nil {
+		return err
+	}
+
+	key := c.playerKey(user)
+
+	tourney.mutex.Lock()
+	defer tourney.mutex.Unlock()
+
+	if tourney.bracket != nil {
+		return fmt.Errorf("%s has already started", tourney.Name)
+	}
+
+	index := tourney.findEntrant(key)
+	if index == -1 {
+		return fmt.Errorf("you are not in %s", tourney.Name)
+	}
+
+	entrant := tourney.entrants[index]
+	members := make([]tourneyMember, 0)
+	for _, member := range entrant.Members {
+		if member.Key != key {
+			members = append(members, member)
+		}
+	}
+	entrant.Members = members
+
+	if len(members) == 0 {
+		tourney.entrants = append(tourney.entrants[:index], tourney.entrants[index+1:]...)
+	}
+
+	user.Message(fmt.Sprintf("you left %s", tourney.Name))
+	return nil
+}
+
+// entrantRating is the average rating of an entrant's members who are online,
+// which decides their seed.
+func (c *Cluster) entrantRating(entrant *tourneyEntrant, ratingKey string) int {
+	total := 0
+	count := 0
+	for _, member := range entrant.Members {
+		user := c.findOnline(member.Key)
+		if user == nil {
+			continue
+		}
+		total += user.GetRating(ratingKey)
+		count++
+	}
+
+	if count == 0 {
+		return int(NewELO().Rating)
+	}
+	return total / count
+}
+
+func (c *Cluster) startTournament(user *User, name string) error {
+	if !user.IsAdmin() {
+		return fmt.Errorf("you must be an admin to do that")
+	}
+
+	tourney, err := c.findTournament(name)
+	if err != nil {
+		return err
+	}
+
+	tourney.mutex.Lock()
+	defer tourney.mutex.Unlock()
+
+	if tourney.bracket != nil {
+		return fmt.Errorf("%s has already started", tourney.Name)
+	}
+
+	for _, entrant := range tourney.entrants {
+		if len(entrant.Members) != tourney.teamSize() {
+			return fmt.Errorf(
+				"%s only has %d of %d players",
+				entrant.Name,
+				len(entrant.Members),
+				tourney.teamSize(),
+			)
+		}
+	}
+
+	// The best rated entrants are seeded first
+	ratings := make(map[*tourneyEntrant]int)
+	for _, entrant := range tourney.entrants {
+		ratings[entrant] = c.entrantRating(entrant, tourney.ratingKey())
+	}
+	sort.SliceStable(tourney.entrants, func(i, j int) bool {
+		return ratings[tourney.entrants[i]] > ratings[tourney.entrants[j]]
+	})
+
+	names := make([]string, 0)
+	for _, entrant := range tourney.entrants {
+		names = append(names, entrant.Name)
+	}
+
+	bracket, err := tournament.New(tourney.Format, names)
+	if err != nil {
+		return err
+	}
+	tourney.bracket = bracket
+
+	log.Info().Str("tournament", tourney.Name).Strs("entrants", names).Msg("started tournament")
+	c.announce(fmt.Sprintf(
+		"the tournament %s has started with %d entrants, see #tourney status %s",
+		game.Yellow(tourney.Name),
+		len(names),
+		tourney.Name,
+	))
+	return nil
+}
+
+func (c *Cluster) tournamentStatus(user *User, name string) error {
+	tourney, err := c.findTournament(name)
+	if err != nil {
+		return err
+	}
+
+	key := c.playerKey(user)
+
+	tourney.mutex.Lock()
+	defer tourney.mutex.Unlock()
+
+	user.Message(tourney.describe())
+
+	if tourney.bracket == nil {
+		names := make([]string, 0)
+		for _, entrant := range tourney.entrants {
+			names = append(names, fmt.Sprintf(
+				"%s (%d/%d)",
+				entrant.Name,
+				len(entrant.Members),
+				tourney.teamSize(),
+			))
+		}
+		if len(names) > 0 {
+			user.Message("entrants: " + strings.Join(names, ", "))
+		}
+		return nil
+	}
+
+	mine := tourney.findEntrant(key)
+	for _, match := range tourney.bracket.Ready() {
+		description := tourney.describeMatch(match)
+		if mine != -1 && (match.Entrants[0] == mine || match.Entrants[1] == mine) {
+			description = game.Blue("your ") + description
+		}
+		user.Message(description)
+	}
+	return nil
+}
+
+func (c *Cluster) cancelTournament(user *User, name string) error {
+	if !user.IsAdmin() {
+		return fmt.Errorf("you must be an admin to do that")
+	}
+
+	tourney, err := c.findTournament(name)
+	if err != nil {
+		return err
+	}
+
+	c.tourneyMutex.Lock()
+	delete(c.tournaments, tourney.Name)
+	c.tourneyMutex.Unlock()
+
+	// Matches that are being played end and report nothing
+	tourney.cancel()
+
+	log.Info().Str("tournament", tourney.Name).Msg("canceled tournament")
+	c.announce(fmt.Sprintf("the tournament %s was canceled", game.Yellow(tourney.Name)))
+	return nil
+}
+
+// finishTournamentMatch records the result of a match, or lets it be played
+// again if it did not have a winner.
+func (c *Cluster) finishTournamentMatch(tourney *Tournament, id int, winner int) {
+	tourney.mutex.Lock()
+	defer tourney.mutex.Unlock()
+
+	delete(tourney.running, id)
+
+	if tourney.ctx.Err() != nil {
+		return
+	}
+	match := tourney.bracket.Matches[id]
+
+	if winner < 0 {
+		delete(tourney.announced, id)
+		for _, entrant := range match.Entrants {
+			for _, member := range tourney.entrants[entrant].Members {
+				if user := c.findOnline(member.Key); user != nil {
+					user.Message("your tournament match did not have a winner, so it will be played again")
+				}
+			}
+		}
+		return
+	}
+
+	loser := match.Entrants[0]
+	if loser == winner {
+		loser = match.Entrants[1]
+	}
+
+	err := tourney.bracket.Report(id, winner)
+	if err != nil {
+		log.Error().Err(err).Str("tournament", tourney.Name).Msg("failed to report match")
+		return
+	}
+
+	c.announce(fmt.Sprintf(
+		"%s: %s beat %s",
+		game.Yellow(tourney.Name),
+		tourney.entrants[winner].Name,
+		tourney.entrants[loser].Name,
+	))
+
+	if champion := tourney.bracket.Champion(); champion >= 0 {
+		log.Info().Str("tournament", tourney.Name).Str("champion", tourney.entrants[champion].Name).Msg("tournament finished")
+		c.announce(fmt.Sprintf(
+			"%s won the tournament %s!",
+			game.Green(tourney.entrants[champion].Name),
+			game.Yellow(tourney.Name),
+		))
+	}
+}
+
+// startTournamentMatch plays a match between two entrants whose players are
+// all online. Must be called with the tournament's mutex held.
+func (c *Cluster) startTournamentMatch(tourney *Tournament, match *tournament.Match, teams [2][]*User) {
+	id := match.ID
+	tourney.running[id] = true
+
+	for _, users := range teams {
+		for _, user := range users {
+			user.Message(fmt.Sprintf("your %s match is starting", game.Yellow(tourney.Name)))
+		}
+	}
+
+	if tourney.duelType != nil {
+		finished := make(chan DuelDone, 1)
+		duel := NewDuel(c.servers, teams[0][0], teams[1][0], *tourney.duelType, false, finished)
+		tourney.duels[duel] = true
+
+		go duel.Run(tourney.ctx)
+		go func() {
+			done := <-finished
+
+			tourney.mutex.Lock()
+			delete(tourney.duels, duel)
+			tourney.mutex.Unlock()
+
+			result := done.Result
+			winner := -1
+			if !result.Aborted && !result.IsDraw {
+				winner = match.Entrants[0]
+				if result.Winner == duel.B {
+					winner = match.Entrants[1]
+				}
+			}
+			c.finishTournamentMatch(tourney, id, winner)
+		}()
+		return
+	}
+
+	finished := make(chan TeamMatchDone, 1)
+	teamMatch := &TeamMatch{
+		Type:     *tourney.teamType,
+		Teams:    teams,
+		Manager:  c.servers,
+		Finished: finished,
+	}
+	tourney.teamMatches[teamMatch] = true
+
+	go teamMatch.Run(tourney.ctx)
+	go func() {
+		done := <-finished
+
+		tourney.mutex.Lock()
+		delete(tourney.teamMatches, teamMatch)
+		tourney.mutex.Unlock()
+
+		winner := -1
+		if done.Result != nil && done.Result.Winner >= 0 {
+			winner = match.Entrants[done.Result.Winner]
+		}
+		c.finishTournamentMatch(tourney, id, winner)
+	}()
+}
+
+// advanceTournament starts the ready matches whose players are all online
+// and not busy playing another match.
+func (c *Cluster) advanceTournament(tourney *Tournament) {
+	tourney.mutex.Lock()
+	defer tourney.mutex.Unlock()
+
+	if tourney.bracket == nil || tourney.ctx.Err() != nil {
+		return
+	}
+
+	for _, match := range tourney.bracket.Ready() {
+		if tourney.running[match.ID] {
+			continue
+		}
+
+		var teams [2][]*User
+		missing := make([]string, 0)
+		for slot, entrant := range match.Entrants {
+			for _, member := range tourney.entrants[entrant].Members {
+				user := c.findOnline(member.Key)
+				if user == nil || isPlayingMatch(user) {
+					missing = append(missing, member.Name)
+					continue
+				}
+				teams[slot] = append(teams[slot], user)
+			}
+		}
+
+		if len(missing) == 0 {
+			c.startTournamentMatch(tourney, match, teams)
+			continue
+		}
+
+		if tourney.announced[match.ID] {
+			continue
+		}
+		tourney.announced[match.ID] = true
+
+		message := fmt.Sprintf(
+			"your %s match is up, waiting for %s",
+			game.Yellow(tourney.Name),
+			strings.Join(missing, ", "),
+		)
+		for _, users := range teams {
+			for _, user := range users {
+				user.Message(message)
+			}
+		}
+	}
+}
+
+// isPlayingMatch reports whether the user is playing in a matchmade game,
+// which are always played on hidden servers, rather than spectating one.
+func isPlayingMatch(user *User) bool {
+	server := user.GetServer()
+	if server == nil || !server.Hidden {
+		return false
+	}
+
+	client := user.ServerClient
+	return client == nil || !client.ForcedSpectator
+}
+
+func (c *Cluster) PollTournaments(ctx context.Context) {
+	ticker := time.NewTicker(TOURNAMENT_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.tourneyMutex.Lock()
+			tournaments := make([]*Tournament, 0)
+			for _, tourney := range c.tournaments {
+				tournaments = append(tournaments, tourney)
+			}
+			c.tourneyMutex.Unlock()
+
+			for _, tourney := range tournaments {
+				c.advanceTournament(tourney)
+			}
+		}
+	}
+}
+
+func (c *Cluster) tournamentCommands() []commands.Command {
+	tourneyCommand := commands.Command{
+		Name:        "tourney",
+		Aliases:     []string{"tournament"},
+		ArgFormat:   "[list|status|join|leave|create|start|cancel] [name] ..",
+		Description: "enter and follow tournaments",
+		Callback: func(ctx context.Context, user *User, args []string) error {
+			if len(args) == 0 {
+				args = []string{"status"}
+			}
+
+			arg := func(i int) string {
+				if len(args) > i {
+					return args[i]
+				}
+				return ""
+			}
+
+			switch args[0] {
+			case "list":
+				c.tourneyMutex.Lock()
+				tournaments := make([]*Tournament, 0)
+				for _, tourney := range c.tournaments {
+					tournaments = append(tournaments, tourney)
+				}
+				c.tourneyMutex.Unlock()
+
+				if len(tournaments) == 0 {
+					user.Message("there are no tournaments right now")
+					return nil
+				}
+
+				for _, tourney := range tournaments {
+					tourney.mutex.Lock()
+					user.Message(tourney.describe())
+					tourney.mutex.Unlock()
+				}
+				return nil
+			case "status":
+				return c.tournamentStatus(user, arg(1))
+			case "join":
+				return c.joinTournament(user, arg(1), arg(2))
+			case "leave":
+				return c.leaveTournament(user, arg(1))
+			case "create":
+				if len(args) < 3 {
+					return fmt.Errorf("usage: #tourney create [name] [single|double|roundrobin] [duel or team match type]")
+				}
+				return c.createTournament(user, args[1], args[2], arg(3))
+			case "start":
+				return c.startTournament(user, arg(1))
+			case "cancel":
+				return c.cancelTournament(user, arg(1))
+			}
+
+			return fmt.Errorf("unknown subcommand '%s'", args[0])
+		},
+	}
+
+	return []commands.Command{
+		tourneyCommand,
+	}
+}
+
+type tourneyEntrantResponse struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+type tournamentResponse struct {
+	Name     string                   `json:"name"`
+	Format   tournament.Format        `json:"format"`
+	Type     string                   `json:"type"`
+	Started  bool                     `json:"started"`
+	Champion string                   `json:"champion,omitempty"`
+	Entrants []tourneyEntrantResponse `json:"entrants"`
+	// The entrants in the bracket refer to Entrants by index
+	Bracket *tournament.Bracket `json:"bracket,omitempty"`
+	// The matches being played right now
+	Running []int `json:"running"`
+}
+
+// response must be called with the mutex held.
+func (t *Tournament) response() tournamentResponse {
+	response := tournamentResponse{
+		Name:     t.Name,
+		Format:   t.Format,
+		Type:     t.typeName(),
+		Started:  t.bracket != nil,
+		Entrants: make([]tourneyEntrantResponse, 0),
+		Bracket:  t.bracket,
+		Running:  make([]int, 0),
+	}
+
+	for _, entrant := range t.entrants {
+		members := make([]string, 0)
+		for _, member := range entrant.Members {
+			members = append(members, member.Name)
+		}
+		response.Entrants = append(response.Entrants, tourneyEntrantResponse{
+			Name:    entrant.Name,
+			Members: members,
+		})
+	}
+
+	if t.bracket != nil {
+		if champion := t.bracket.Champion(); champion >= 0 {
+			response.Champion = t.entrants[champion].Name
+		}
+	}
+
+	for id := range t.running {
+		response.Running = append(response.Running, id)
+	}
+	sort.Ints(response.Running)
+
+	return response
+}
+
+// serveTournaments responds with every tournament, or just the one named.
+func (c *Cluster) serveTournaments(w http.ResponseWriter, name string) {
+	var data []byte
+	var err error
+
+	if name == "" {
+		c.tourneyMutex.Lock()
+		tournaments := make([]*Tournament, 0)
+		for _, tourney := range c.tournaments {
+			tournaments = append(tournaments, tourney)
+		}
+		c.tourneyMutex.Unlock()
+
+		sort.Slice(tournaments, func(i, j int) bool {
+			return tournaments[i].Name < tournaments[j].Name
+		})
+
+		responses := make([]tournamentResponse, 0)
+		for _, tourney := range tournaments {
+			tourney.mutex.Lock()
+			response := tourney.response()
+			tourney.mutex.Unlock()
+
+			// The list only gives an overview
+			response.Bracket = nil
+			responses = append(responses, response)
+		}
+
+		data, err = json.Marshal(responses)
+	} else {
+		tourney, findErr := c.findTournament(name)
+		if findErr != nil {
+			w.WriteHeader(404)
+			return
+		}
+
+		// The bracket is shared, so it has to be encoded with the lock held
+		tourney.mutex.Lock()
+		data, err = json.Marshal(tourney.response())
+		tourney.mutex.Unlock()
+	}
+
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+
+	header := w.Header()
+	header.Add("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -6,15 +6,18 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"strings"
 	"time"
 
 	"github.com/cfoust/sour/pkg/game"
 	"github.com/cfoust/sour/pkg/game/io"
 	P "github.com/cfoust/sour/pkg/game/protocol"
 	"github.com/cfoust/sour/pkg/gameserver"
+	"github.com/cfoust/sour/pkg/ratelimit"
 	"github.com/cfoust/sour/pkg/utils"
 
 	"github.com/cfoust/sour/pkg/config"
+	"github.com/cfoust/sour/pkg/server/accounts"
 	"github.com/cfoust/sour/pkg/server/ingress"
 	"github.com/cfoust/sour/pkg/server/servers"
 	"github.com/cfoust/sour/pkg/server/verse"
@@ -63,6 +66,15 @@ type User struct {
 	ServerClient  *gameserver.Client
 
 	ELO *ELOState
+	// nil until the user authenticates
+	account *accounts.Account
+	// Held while the account is loaded
+	accountMutex deadlock.Mutex
+	// Limits how quickly the user can chat, change names, etc
+	Flood *ratelimit.Limiter
+	// The user's race on their server, only used by the goroutine that
+	// handles their packets
+	race *userRace
 
 	// True when the user is loading the map
 	delayMessages bool
@@ -323,7 +335,7 @@ func (u *User) SetName(ctx context.Context, name string) {
 }
 
 func (u *User) AnnounceELO() {
-	u.Mutex.RLock()
+	u.ELO.Mutex.Lock()
 	result := "ratings: "
 	for _, duel := range u.o.Duels {
 		name := duel.Name
@@ -337,7 +349,7 @@ func (u *User) AnnounceELO() {
 			game.Red(fmt.Sprint(state.Losses)),
 		)
 	}
-	u.Mutex.RUnlock()
+	u.ELO.Mutex.Unlock()
 
 	u.Message(result)
 }
@@ -351,14 +363,37 @@ func (u *User) Connect(server *servers.GameServer) (<-chan bool, error) {
 }
 
 func (u *User) ConnectToServer(server *servers.GameServer, target string, shouldCopy bool, isSpace bool) (<-chan bool, error) {
+	if u.GetServer() != server && !server.HasFreeSlot() {
+		return nil, ErrServerFull
+	}
+
+	return u.connectToServer(server, target, shouldCopy, false)
+}
+
+// SpectateServer connects the user to a server as a spectator who cannot
+// join the game.
+func (u *User) SpectateServer(server *servers.GameServer) (<-chan bool, error) {
+	if u.GetServer() == server {
+		return nil, fmt.Errorf("you are already on that server")
+	}
+
+	if !server.HasSpectatorSlot() {
+		return nil, ErrSpectatorsFull
+	}
+
+	return u.connectToServer(server, "", false, true)
+}
+
+func (u *User) connectToServer(server *servers.GameServer, target string, shouldCopy bool, spectate bool) (<-chan bool, error) {
 	if u.Connection.NetworkStatus() == ingress.NetworkStatusDisconnected {
 		log.Warn().Msgf("client not connected to cluster but attempted connect")
 		return nil, fmt.Errorf("client not connected to cluster")
 	}
 
+	oldServer := u.GetServer()
+
 	u.DelayMessages()
 
-	oldServer := u.GetServer()
 	if oldServer != nil {
 		oldServer.Leave(uint32(u.Id))
 		u.ServerSession.Cancel()
@@ -396,6 +431,9 @@ func (u *User) ConnectToServer(server *servers.GameServer, target string, should
 
 	serverClient, serverConnected := server.Connect(uint32(u.Id))
 	u.ServerClient = serverClient
+	if serverClient != nil {
+		serverClient.ForcedSpectator = spectate
+	}
 
 	serverName := server.Reference()
 	if target != "" {
@@ -467,16 +505,23 @@ func (u *User) DisconnectFromServer() error {
 
 type UserOrchestrator struct {
 	Duels   []config.DuelType
+	Flood   ratelimit.Config
 	Users   []*User
 	Servers map[*servers.GameServer][]*User
 	Mutex   deadlock.RWMutex
+
+	// The party each user is in, if any
+	parties    map[*User]*Party
+	partyMutex deadlock.Mutex
 }
 
-func NewUserOrchestrator(duels []config.DuelType) *UserOrchestrator {
+func NewUserOrchestrator(duels []config.DuelType, flood ratelimit.Config) *UserOrchestrator {
 	return &UserOrchestrator{
 		Duels:   duels,
+		Flood:   flood,
 		Users:   make([]*User, 0),
 		Servers: make(map[*servers.GameServer][]*User),
+		parties: make(map[*User]*Party),
 	}
 }
 
@@ -525,6 +570,7 @@ func (u *UserOrchestrator) AddUser(ctx context.Context, connection ingress.Conne
 		Connection:        connection,
 		Session:           connection.Session(),
 		ELO:               NewELOState(u.Duels),
+		Flood:             ratelimit.New(u.Flood),
 		Name:              "unnamed",
 		From:              P.NewMessageProxy(true),
 		To:                P.NewMessageProxy(false),
@@ -547,6 +593,8 @@ func (u *UserOrchestrator) AddUser(ctx context.Context, connection ingress.Conne
 }
 
 func (u *UserOrchestrator) RemoveUser(user *User) {
+	u.LeaveParty(user)
+
 	u.Mutex.Lock()
 
 	newUsers := make([]*User, 0)
@@ -586,3 +634,19 @@ func (u *UserOrchestrator) FindUser(id ingress.ClientID) *User {
 
 	return nil
 }
+
+// FindUserByName returns the online user with the given name, ignoring
+// case.
+func (u *UserOrchestrator) FindUserByName(name string) *User {
+	u.Mutex.RLock()
+	defer u.Mutex.RUnlock()
+	for _, user := range u.Users {
+		if !strings.EqualFold(user.GetName(), name) {
+			continue
+		}
+
+		return user
+	}
+
+	return nil
+}
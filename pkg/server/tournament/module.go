@@ -0,0 +1,376 @@
+package tournament
+
+import (
+	"fmt"
+)
+
+type Format string
+
+const (
+	FormatSingle     Format = "single"
+	FormatDouble     Format = "double"
+	FormatRoundRobin Format = "roundrobin"
+)
+
+func ParseFormat(value string) (Format, error) {
+	switch Format(value) {
+	case FormatSingle, FormatDouble, FormatRoundRobin:
+		return Format(value), nil
+	}
+
+	return "", fmt.Errorf("unknown format '%s' (single, double or roundrobin)", value)
+}
+
+// Slots in a match hold the index of an entrant, or one of these.
+const (
+	// Waiting for the result of another match
+	SlotPending = -1
+	// Nobody will ever fill the slot, so whoever is in the other one
+	// advances without playing
+	SlotBye = -2
+)
+
+// The sides of an elimination bracket
+const (
+	SideWinners = "winners"
+	SideLosers  = "losers"
+	SideFinal   = "final"
+)
+
+// A Link is where an entrant goes after a match.
+type Link struct {
+	Match int `json:"match"`
+	Slot  int `json:"slot"`
+}
+
+type Match struct {
+	ID    int `json:"id"`
+	Round int `json:"round"`
+	// Empty for round robin brackets
+	Side     string `json:"side,omitempty"`
+	Entrants [2]int `json:"entrants"`
+	// SlotPending until the match has been played
+	Winner   int   `json:"winner"`
+	WinnerTo *Link `json:"winnerTo,omitempty"`
+	LoserTo  *Link `json:"loserTo,omitempty"`
+}
+
+// Ready reports whether both entrants are known and the match has not been
+// played yet.
+func (m *Match) Ready() bool {
+	return m.Entrants[0] >= 0 && m.Entrants[1] >= 0 && m.Winner == SlotPending
+}
+
+func (m *Match) Done() bool {
+	return m.Winner != SlotPending
+}
+
+// A Bracket is the schedule of a tournament. Entrants are given in order of
+// seed, best first.
+type Bracket struct {
+	Format   Format   `json:"format"`
+	Entrants []string `json:"entrants"`
+	Matches  []*Match `json:"matches"`
+}
+
+func New(format Format, entrants []string) (*Bracket, error) {
+	if len(entrants) < 2 {
+		return nil, fmt.Errorf("a tournament needs at least two entrants")
+	}
+
+	bracket := &Bracket{
+		Format:   format,
+		Entrants: entrants,
+		Matches:  make([]*Match, 0),
+	}
+
+	switch format {
+	case FormatSingle:
+		bracket.eliminate(false)
+	case FormatDouble:
+		bracket.eliminate(true)
+	case FormatRoundRobin:
+		bracket.roundRobin()
+	default:
+		return nil, fmt.Errorf("unknown format '%s'", format)
+	}
+
+	// Advance everyone who has a bye
+	for _, match := range bracket.Matches {
+		bracket.resolve(match)
+	}
+
+	return bracket, nil
+}
+
+func (b *Bracket) addMatch(round int, side string) *Match {
+	match := &Match{
+		ID:       len(b.Matches),
+		Round:    round,
+		Side:     side,
+		Entrants: [2]int{SlotPending, SlotPending},
+		Winner:   SlotPending,
+	}
+	b.Matches = append(b.Matches, match)
+	return match
+}
+
+// seedOrder returns the seeds (starting at zero) of a bracket of size
+// players in the order they are placed, so that the best seeds only meet
+// in the last rounds.
+func seedOrder(size int) []int {
+	order := []int{0}
+	for len(order) < size {
+		next := make([]int, 0, len(order)*2)
+		for _, seed := range order {
+			next = append(next, seed, len(order)*2-1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// eliminate creates a single or double elimination bracket. Double
+// elimination ends with a single grand final between the winners of the
+// winners' and losers' brackets.
+func (b *Bracket) eliminate(double bool) {
+	size := 2
+	for size < len(b.Entrants) {
+		size *= 2
+	}
+
+	// The matches in each round of the winners' bracket
+	winners := make([][]*Match, 0)
+
+	order := seedOrder(size)
+	first := make([]*Match, 0)
+	for i := 0; i < size; i += 2 {
+		match := b.addMatch(1, SideWinners)
+		for slot, seed := range order[i : i+2] {
+			if seed < len(b.Entrants) {
+				match.Entrants[slot] = seed
+			} else {
+				match.Entrants[slot] = SlotBye
+			}
+		}
+		first = append(first, match)
+	}
+	winners = append(winners, first)
+
+	for round := 2; len(winners[len(winners)-1]) > 1; round++ {
+		previous := winners[len(winners)-1]
+		matches := make([]*Match, 0)
+		for i := 0; i < len(previous); i += 2 {
+			match := b.addMatch(round, SideWinners)
+			previous[i].WinnerTo = &Link{Match: match.ID, Slot: 0}
+			previous[i+1].WinnerTo = &Link{Match: match.ID, Slot: 1}
+			matches = append(matches, match)
+		}
+		winners = append(winners, matches)
+	}
+
+	if !double {
+		return
+	}
+
+	rounds := len(winners)
+	winnersFinal := winners[rounds-1][0]
+	final := b.addMatch(rounds+1, SideFinal)
+	winnersFinal.WinnerTo = &Link{Match: final.ID, Slot: 0}
+
+	// With two entrants, the loser of the first match gets another
+	// chance in the final
+	if rounds == 1 {
+		winnersFinal.LoserTo = &Link{Match: final.ID, Slot: 1}
+		return
+	}
+
+	// The losers of the first round play each other
+	round := 1
+	previous := make([]*Match, 0)
+	for i := 0; i < len(winners[0]); i += 2 {
+		match := b.addMatch(round, SideLosers)
+		winners[0][i].LoserTo = &Link{Match: match.ID, Slot: 0}
+		winners[0][i+1].LoserTo = &Link{Match: match.ID, Slot: 1}
+		previous = append(previous, match)
+	}
+
+	for r := 1; r < rounds; r++ {
+		// The survivors play the losers of the next winners' round,
+		// in reverse so they are unlikely to meet again right away
+		round++
+		dropped := winners[r]
+		matches := make([]*Match, 0)
+		for i, match := range previous {
+			next := b.addMatch(round, SideLosers)
+			match.WinnerTo = &Link{Match: next.ID, Slot: 0}
+			dropped[len(dropped)-1-i].LoserTo = &Link{Match: next.ID, Slot: 1}
+			matches = append(matches, next)
+		}
+		previous = matches
+
+		if len(previous) == 1 {
+			break
+		}
+
+		// Then each other
+		round++
+		matches = make([]*Match, 0)
+		for i := 0; i < len(previous); i += 2 {
+			next := b.addMatch(round, SideLosers)
+			previous[i].WinnerTo = &Link{Match: next.ID, Slot: 0}
+			previous[i+1].WinnerTo = &Link{Match: next.ID, Slot: 1}
+			matches = append(matches, next)
+		}
+		previous = matches
+	}
+
+	previous[0].WinnerTo = &Link{Match: final.ID, Slot: 1}
+}
+
+// roundRobin schedules every entrant to play every other entrant once using
+// the circle method, so that everyone plays at most once a round.
+func (b *Bracket) roundRobin() {
+	players := make([]int, 0)
+	for i := range b.Entrants {
+		players = append(players, i)
+	}
+	if len(players)%2 == 1 {
+		players = append(players, SlotBye)
+	}
+
+	count := len(players)
+	for round := 1; round < count; round++ {
+		for i := 0; i < count/2; i++ {
+			a := players[i]
+			c := players[count-1-i]
+			if a == SlotBye || c == SlotBye {
+				continue
+			}
+
+			match := b.addMatch(round, "")
+			match.Entrants = [2]int{a, c}
+		}
+
+		// Keep the first player in place and rotate the rest
+		last := players[count-1]
+		copy(players[2:], players[1:count-1])
+		players[1] = last
+	}
+}
+
+// resolve advances the entrant in a match against a bye.
+func (b *Bracket) resolve(match *Match) {
+	if match.Done() {
+		return
+	}
+
+	a, c := match.Entrants[0], match.Entrants[1]
+	if a == SlotPending || c == SlotPending {
+		return
+	}
+
+	if a == SlotBye {
+		b.finish(match, c, SlotBye)
+	} else if c == SlotBye {
+		b.finish(match, a, SlotBye)
+	}
+}
+
+func (b *Bracket) place(link *Link, entrant int) {
+	if link == nil {
+		return
+	}
+
+	match := b.Matches[link.Match]
+	match.Entrants[link.Slot] = entrant
+	b.resolve(match)
+}
+
+func (b *Bracket) finish(match *Match, winner, loser int) {
+	match.Winner = winner
+	b.place(match.WinnerTo, winner)
+	b.place(match.LoserTo, loser)
+}
+
+// Report records the winner of a match and moves both entrants on.
+func (b *Bracket) Report(id int, winner int) error {
+	if id < 0 || id >= len(b.Matches) {
+		return fmt.Errorf("match %d does not exist", id)
+	}
+
+	match := b.Matches[id]
+	if !match.Ready() {
+		return fmt.Errorf("match %d cannot be played", id)
+	}
+
+	loser := SlotPending
+	if match.Entrants[0] == winner {
+		loser = match.Entrants[1]
+	} else if match.Entrants[1] == winner {
+		loser = match.Entrants[0]
+	} else {
+		return fmt.Errorf("%d is not in match %d", winner, id)
+	}
+
+	b.finish(match, winner, loser)
+	return nil
+}
+
+// Ready returns the matches that can be played right now.
+func (b *Bracket) Ready() []*Match {
+	ready := make([]*Match, 0)
+	for _, match := range b.Matches {
+		if match.Ready() {
+			ready = append(ready, match)
+		}
+	}
+	return ready
+}
+
+func (b *Bracket) Done() bool {
+	for _, match := range b.Matches {
+		if !match.Done() {
+			return false
+		}
+	}
+	return true
+}
+
+// Wins counts the matches each entrant has won.
+func (b *Bracket) Wins() []int {
+	wins := make([]int, len(b.Entrants))
+	for _, match := range b.Matches {
+		if match.Winner >= 0 && match.Entrants[0] >= 0 && match.Entrants[1] >= 0 {
+			wins[match.Winner]++
+		}
+	}
+	return wins
+}
+
+// Champion returns the entrant who won the tournament, or SlotPending if it
+// is not over. Round robin ties go to the better seed.
+func (b *Bracket) Champion() int {
+	if !b.Done() {
+		return SlotPending
+	}
+
+	if b.Format == FormatRoundRobin {
+		champion := 0
+		wins := b.Wins()
+		for entrant, count := range wins {
+			if count > wins[champion] {
+				champion = entrant
+			}
+		}
+		return champion
+	}
+
+	// The final is the only match nobody advances from
+	for _, match := range b.Matches {
+		if match.WinnerTo == nil {
+			return match.Winner
+		}
+	}
+	return SlotPending
+}
@@ -0,0 +1,97 @@
+package tournament
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// play reports the better seed as the winner of every ready match until the
+// tournament is over.
+func play(t *testing.T, bracket *Bracket) int {
+	played := 0
+	for {
+		ready := bracket.Ready()
+		if len(ready) == 0 {
+			break
+		}
+
+		for _, match := range ready {
+			winner := match.Entrants[0]
+			if match.Entrants[1] < winner {
+				winner = match.Entrants[1]
+			}
+			require.NoError(t, bracket.Report(match.ID, winner))
+			played++
+		}
+	}
+
+	require.True(t, bracket.Done())
+	return played
+}
+
+func TestSingleElimination(t *testing.T) {
+	_, err := New(FormatSingle, []string{"alice"})
+	require.Error(t, err)
+
+	bracket, err := New(FormatSingle, []string{"a", "b", "c", "d", "e"})
+	require.NoError(t, err)
+
+	// The top three seeds have byes, so the second and third already
+	// meet in the second round
+	ready := bracket.Ready()
+	require.Len(t, ready, 2)
+	require.Equal(t, [2]int{3, 4}, ready[0].Entrants)
+	require.Equal(t, [2]int{1, 2}, ready[1].Entrants)
+
+	require.Error(t, bracket.Report(ready[0].ID, 0))
+	require.Equal(t, 4, play(t, bracket))
+	require.Equal(t, 0, bracket.Champion())
+}
+
+func TestDoubleElimination(t *testing.T) {
+	bracket, err := New(FormatDouble, []string{"a", "b", "c", "d"})
+	require.NoError(t, err)
+
+	// Three in the winners' bracket, two in the losers' and the final
+	require.Len(t, bracket.Matches, 6)
+
+	// The favorite loses their first match but wins everything after
+	for _, match := range bracket.Ready() {
+		winner := match.Entrants[0]
+		if winner == 0 {
+			winner = match.Entrants[1]
+		}
+		require.NoError(t, bracket.Report(match.ID, winner))
+	}
+
+	require.Equal(t, SlotPending, bracket.Champion())
+	play(t, bracket)
+	require.Equal(t, 0, bracket.Champion())
+
+	// Two entrants play again in the final
+	bracket, err = New(FormatDouble, []string{"a", "b"})
+	require.NoError(t, err)
+	require.NoError(t, bracket.Report(0, 1))
+	require.Equal(t, [2]int{1, 0}, bracket.Matches[1].Entrants)
+}
+
+func TestRoundRobin(t *testing.T) {
+	bracket, err := New(FormatRoundRobin, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	require.Len(t, bracket.Matches, 3)
+
+	played := make(map[[2]int]bool)
+	for _, match := range bracket.Matches {
+		a, b := match.Entrants[0], match.Entrants[1]
+		if b < a {
+			a, b = b, a
+		}
+		require.False(t, played[[2]int{a, b}])
+		played[[2]int{a, b}] = true
+	}
+
+	play(t, bracket)
+	require.Equal(t, []int{2, 1, 0}, bracket.Wins())
+	require.Equal(t, 0, bracket.Champion())
+}
@@ -0,0 +1,179 @@
+package verse
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gameServers "github.com/cfoust/sour/pkg/server/servers"
+)
+
+const (
+	// How long an extra instance of a space can be empty before we shut
+	// it down
+	SHARD_MAX_IDLE_TIME = time.Duration(5 * time.Minute)
+	SHARD_POLL_INTERVAL = time.Duration(30 * time.Second)
+)
+
+// capacity returns how many players fit in an instance before newcomers are
+// sent elsewhere, or zero if there is no limit.
+func (s *SpaceInstance) capacity() int {
+	if s.PresetSpace.Capacity > 0 {
+		return s.PresetSpace.Capacity
+	}
+	return s.Server.MaxClients
+}
+
+func (s *SpaceInstance) isFull() bool {
+	capacity := s.capacity()
+	return capacity > 0 && s.Server.NumPlayers() >= capacity
+}
+
+// isExtra reports whether the instance was started because the space
+// filled up, as opposed to being the space's original server.
+func (s *SpaceInstance) isExtra() bool {
+	return s.id != s.PresetSpace.Config.Alias
+}
+
+// shards returns all of the instances of the space with the given alias.
+// Must be called with the mutex held.
+func (s *SpaceManager) shards(alias string) []*SpaceInstance {
+	shards := make([]*SpaceInstance, 0)
+	for _, instance := range s.instances {
+		if instance.PresetSpace.Config.Alias == alias {
+			shards = append(shards, instance)
+		}
+	}
+	return shards
+}
+
+// FindShard picks the instance of a space that a newcomer should join: the
+// least full one that still has room, starting a new instance if they are
+// all full and the space allows more. Players who are already on an instance
+// of the space (current) stay where they are. Returns nil if there is no
+// space with that alias.
+func (s *SpaceManager) FindShard(ctx context.Context, alias string, current *gameServers.GameServer) *gameServers.GameServer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	shards := s.shards(alias)
+	if len(shards) == 0 {
+		return nil
+	}
+
+	for _, instance := range shards {
+		if instance.Server == current && current.Ctx().Err() == nil {
+			return current
+		}
+	}
+
+	// The emptiest instance with room, and the emptiest overall
+	var open, emptiest *SpaceInstance
+	for _, instance := range shards {
+		if instance.Server.Ctx().Err() != nil {
+			continue
+		}
+
+		players := instance.Server.NumPlayers()
+		if emptiest == nil || players < emptiest.Server.NumPlayers() {
+			emptiest = instance
+		}
+
+		if instance.isFull() {
+			continue
+		}
+
+		if open == nil || players < open.Server.NumPlayers() {
+			open = instance
+		}
+	}
+
+	if open != nil {
+		return open.Server
+	}
+
+	// Everything is full, so the caller can queue for the emptiest one
+	var fallback *gameServers.GameServer
+	if emptiest != nil {
+		fallback = emptiest.Server
+	}
+
+	presetSpace := *shards[0].PresetSpace
+	if len(shards) >= presetSpace.Instances {
+		return fallback
+	}
+
+	// Use the lowest free suffix, e.g. lobby-2
+	id := ""
+	for i := 2; ; i++ {
+		id = fmt.Sprintf("%s-%d", alias, i)
+		if _, ok := s.instances[id]; !ok {
+			break
+		}
+	}
+
+	instance, err := s.startInstance(ctx, presetSpace, id)
+	if err != nil {
+		return fallback
+	}
+
+	return instance.Server
+}
+
+// PollShards shuts down extra instances of spaces once they have been empty
+// for a while.
+func (s *SpaceManager) PollShards(ctx context.Context) {
+	ticker := time.NewTicker(SHARD_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	emptySince := make(map[*SpaceInstance]time.Time)
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			toPrune := make([]*SpaceInstance, 0)
+
+			s.mutex.RLock()
+			seen := make(map[*SpaceInstance]struct{})
+			for _, instance := range s.instances {
+				if !instance.isExtra() {
+					continue
+				}
+				seen[instance] = struct{}{}
+
+				if instance.Server.NumClients() > 0 {
+					delete(emptySince, instance)
+					continue
+				}
+
+				since, ok := emptySince[instance]
+				if !ok {
+					emptySince[instance] = now
+					continue
+				}
+
+				if now.Sub(since) >= SHARD_MAX_IDLE_TIME {
+					toPrune = append(toPrune, instance)
+				}
+			}
+			s.mutex.RUnlock()
+
+			for instance := range emptySince {
+				if _, ok := seen[instance]; !ok {
+					delete(emptySince, instance)
+				}
+			}
+
+			for _, instance := range toPrune {
+				logger := instance.Server.Logger()
+				logger.Info().Msg("shutting down idle space instance")
+				delete(emptySince, instance)
+				instance.Server.Shutdown()
+				instance.Cancel()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
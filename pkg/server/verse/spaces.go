@@ -167,12 +167,10 @@ func (s *SpaceManager) DoExploreMode(ctx context.Context, gameServer *gameServer
 	}
 }
 
-func (s *SpaceManager) StartPresetSpace(ctx context.Context, presetSpace config.PresetSpace) (*SpaceInstance, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
+// startInstance starts a server for a preset space under the given id.
+// Must be called with the mutex held.
+func (s *SpaceManager) startInstance(ctx context.Context, presetSpace config.PresetSpace, id string) (*SpaceInstance, error) {
 	c := presetSpace.Config
-	id := c.Alias
 
 	links := make([]config.SpaceLink, 0)
 	for _, link := range c.Links {
@@ -191,15 +189,15 @@ func (s *SpaceManager) StartPresetSpace(ctx context.Context, presetSpace config.
 		return nil, err
 	}
 
-	gameServer.Alias = c.Alias
+	gameServer.Alias = id
 
 	if c.Description != "" {
 		gameServer.SetDescription(c.Description)
 	} else {
-		gameServer.SetDescription(fmt.Sprintf("Sour [%s]", c.Alias))
+		gameServer.SetDescription(fmt.Sprintf("Sour [%s]", id))
 	}
 
-	logger.Info().Msgf("started space %s", c.Alias)
+	logger.Info().Msgf("started space %s", id)
 
 	if presetSpace.ExploreMode {
 		go s.DoExploreMode(ctx, gameServer, presetSpace.ExploreModeSkip)
@@ -209,6 +207,7 @@ func (s *SpaceManager) StartPresetSpace(ctx context.Context, presetSpace config.
 		Session:     utils.NewSession(s.Ctx()),
 		Server:      gameServer,
 		PresetSpace: &presetSpace,
+		links:       links,
 	}
 
 	go s.WatchInstance(ctx, &instance)
@@ -218,3 +217,10 @@ func (s *SpaceManager) StartPresetSpace(ctx context.Context, presetSpace config.
 
 	return &instance, nil
 }
+
+func (s *SpaceManager) StartPresetSpace(ctx context.Context, presetSpace config.PresetSpace) (*SpaceInstance, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.startInstance(ctx, presetSpace, presetSpace.Config.Alias)
+}
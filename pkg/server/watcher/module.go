@@ -3,6 +3,7 @@ package watcher
 import (
 	"errors"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
@@ -96,20 +97,33 @@ type Servers map[Address]Server
 type Watcher struct {
 	serverMutex sync.Mutex
 	servers     Servers
+	// The address of the master server, e.g. master.sauerbraten.org:28787
+	master string
 }
 
-func NewWatcher() *Watcher {
+func NewWatcher(master string) *Watcher {
 	watcher := &Watcher{
 		servers: make(Servers),
+		master:  master,
 	}
 
 	return watcher
 }
 
-func FetchServers() ([]Address, error) {
+func FetchServers(master string) ([]Address, error) {
 	var servers []Address
 
-	socket, err := enet.NewConnectSocket("master.sauerbraten.org", 28787)
+	host, masterPort, err := net.SplitHostPort(master)
+	if err != nil {
+		return servers, err
+	}
+
+	port, err := strconv.Atoi(masterPort)
+	if err != nil {
+		return servers, err
+	}
+
+	socket, err := enet.NewConnectSocket(host, port)
 	if err != nil {
 		fmt.Println("Error creating socket")
 		return servers, err
@@ -154,7 +168,7 @@ func FetchServers() ([]Address, error) {
 }
 
 func (watcher *Watcher) UpdateServerList() {
-	newServers, err := FetchServers()
+	newServers, err := FetchServers(watcher.master)
 	if err != nil {
 		fmt.Println("Failed to fetch servers")
 		return